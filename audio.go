@@ -2,16 +2,53 @@ package audiogo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/QuincyGao/audio-go/file"
 	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/pcm"
 	"github.com/QuincyGao/audio-go/stream"
+	"github.com/QuincyGao/audio-go/utils"
+	"github.com/QuincyGao/audio-go/vad"
 )
 
 type AudioEngine struct {
-	processor Processor
-	running   bool
+	processor  Processor
+	engineType AudioEngineType
+	running    bool
+	// started once Start ran ffmpeg, reaped once it was waited for, closed by
+	// Close. mu guards running, reaped, closed and usageSent, Close may run
+	// while another goroutine is in Wait
+	started bool
+	reaped  bool
+	closed  bool
+	mu      sync.Mutex
+	// reapOnce waits for the processor once per run, reapErr is what it returned
+	reapOnce sync.Once
+	reapErr  error
+	// config template the engine was built from
+	config formats.AudioConfig
+	stats  engineStats
+	// logger reapplied to processors built by Reset
+	logger *slog.Logger
+	// faults of WithFaults, nil outside tests
+	faults *faultState
+	// recorder session of Record, nil when not recording
+	recorder *recorder
+	// usage emitter of WithUsage, nil when not metering, usageSent once the
+	// run's record went out
+	usage     UsageEmitter
+	usageSent bool
+	// ctx of the current run, bounds the ffprobe calls made after it
+	ctx context.Context
+	// maxRuntime wall-clock cap of a run, runtime the context enforcing it
+	maxRuntime  time.Duration
+	runtime     context.Context
+	stopRuntime context.CancelFunc
 }
 
 type AudioEngineType int
@@ -23,52 +60,259 @@ const (
 
 func NewAudioEngine(engineType AudioEngineType,
 	config formats.AudioConfig) *AudioEngine {
-	engine := &AudioEngine{}
+	// the caller may keep mutating config, the engine and its processor own private copies
+	engine := &AudioEngine{engineType: engineType, config: config.Clone()}
+	engine.processor = newProcessor(engineType, config)
+	return engine
+}
+
+// errUnknownType Start, reads and writes of an engine newProcessor had no processor for
+func (ae *AudioEngine) errUnknownType() error {
+	return fmt.Errorf("unknown engine type %d", ae.engineType)
+}
+
+// newProcessor nil for an unknown engineType, Start then fails
+func newProcessor(engineType AudioEngineType, config formats.AudioConfig) Processor {
 	switch engineType {
 	case Stream:
-		engine.processor = stream.NewStreamHandle(config)
+		// plain PCM/G.711 conversions need no ffmpeg process
+		if pcm.Supported(config) {
+			return pcm.NewPCMHandle(config.Clone())
+		}
+		return stream.NewStreamHandle(config.Clone())
 	case File:
-		engine.processor = file.NewFileHandle(config)
+		return file.NewFileHandle(config.Clone())
 	}
-	return engine
+	return nil
+}
+
+// Reset stops a running engine, reaps its processes and rebuilds it from
+// config, ready for Start. Logger, WithMaxRuntime, WithUsage and WithFaults
+// are kept, the faults counting from zero again. A Record session ends with
+// the run, OnProgress and OnBargeIn callbacks must be registered again
+func (ae *AudioEngine) Reset(config formats.AudioConfig) {
+	ae.Close()
+	ae.started, ae.reaped, ae.closed = false, false, false
+	ae.reapOnce = sync.Once{}
+	ae.recorder = nil
+	if ae.faults != nil {
+		ae.WithFaults(ae.faults.Faults)
+	}
+	ae.config = config.Clone()
+	ae.processor = newProcessor(ae.engineType, config)
+	ae.stats = engineStats{}
+	if ae.logger != nil {
+		ae.SetLogger(ae.logger)
+	}
+}
+
+// Restart resets the engine with its current config and starts it again
+func (ae *AudioEngine) Restart(ctx context.Context) error {
+	ae.Reset(ae.config)
+	return ae.Start(ctx)
+}
+
+// Config returns a copy of the config the engine was built from
+func (ae *AudioEngine) Config() formats.AudioConfig {
+	return ae.config.Clone()
+}
+
+// SetLogger logs the ffmpeg command line, lifecycle transitions and ffmpeg
+// stderr lines at debug level, must be called before Start. nil disables logging
+func (ae *AudioEngine) SetLogger(l *slog.Logger) {
+	ae.logger = l
+	if p, ok := ae.processor.(interface{ SetLogger(*slog.Logger) }); ok {
+		p.SetLogger(l)
+	}
+}
+
+// WithMaxRuntime caps every run at d of wall-clock time whatever ctx Start
+// gets, ffmpeg is then cancelled and Wait returns ErrMaxRuntime. Must be
+// called before Start, 0 disables the cap
+func (ae *AudioEngine) WithMaxRuntime(d time.Duration) *AudioEngine {
+	ae.maxRuntime = d
+	return ae
 }
 
 func (ae *AudioEngine) Start(ctx context.Context) error {
+	if ae.processor == nil {
+		return ae.errUnknownType()
+	}
+	ae.recorder.begin()
+	ae.ctx, ae.usageSent = ctx, false
+	if ae.maxRuntime > 0 {
+		ctx, ae.stopRuntime = context.WithTimeoutCause(ctx, ae.maxRuntime, utils.ErrMaxRuntime)
+		ae.runtime = ctx
+	}
 	if err := ae.processor.Init(ctx); err != nil {
+		ae.endRuntime()
 		return err
 	}
 	if err := ae.processor.Run(); err != nil {
+		ae.endRuntime()
 		return err
 	}
+	ae.stats.start(ae.config)
 	ae.running = true
+	ae.started = true
 	return nil
 }
 
 func (ae *AudioEngine) Wait() error {
-	if !ae.running {
+	ae.mu.Lock()
+	running := ae.running
+	ae.mu.Unlock()
+	if !running {
 		return fmt.Errorf("engine not running")
 	}
-	return ae.processor.Wait()
+	err := ae.reap()
+	if err != nil && ae.runtime != nil && context.Cause(ae.runtime) == utils.ErrMaxRuntime {
+		err = fmt.Errorf("%w after %v: %w", utils.ErrMaxRuntime, ae.maxRuntime, err)
+	}
+	ae.endRuntime()
+	ae.mu.Lock()
+	ae.reaped = true
+	ae.mu.Unlock()
+	if err == nil && ae.config.VerifyDuration > 0 {
+		err = ae.verifyDuration()
+	}
+	ae.emitUsage(err)
+	return err
 }
 
 // WritePrimary write main channel
 func (ae *AudioEngine) WritePrimary(data []byte) error {
-	return ae.processor.WriteTo(0, data)
+	return ae.write(0, data)
 }
 
 // WriteSecondary write second channel for merge
 func (ae *AudioEngine) WriteSecondary(data []byte) error {
-	return ae.processor.WriteTo(1, data)
+	return ae.write(1, data)
+}
+
+// WriteInput write input i, 0 is the primary input
+func (ae *AudioEngine) WriteInput(i int, data []byte) error {
+	return ae.write(i, data)
+}
+
+// WritePrimaryContext writes the main channel, returning ErrWriteStalled when
+// ctx ends first so real-time callers can drop the frame instead of blocking.
+// File mode engines return errors.ErrUnsupported for a ctx that can end
+func (ae *AudioEngine) WritePrimaryContext(ctx context.Context, data []byte) error {
+	return ae.writeContext(ctx, 0, data)
+}
+
+// WriteInputContext writes input i like WritePrimaryContext
+func (ae *AudioEngine) WriteInputContext(ctx context.Context, i int, data []byte) error {
+	return ae.writeContext(ctx, i, data)
+}
+
+// Inject mixes clip, s16le PCM matching the primary input, into the live
+// stream: InjectDuck lowers the program under it, InjectReplace mutes it.
+// Stream mode with a S16LE primary input only
+func (ae *AudioEngine) Inject(clip []byte, mode stream.InjectMode) error {
+	sh, ok := ae.processor.(*stream.StreamHandle)
+	if !ok {
+		return errInjectUnsupported
+	}
+	return sh.Inject(clip, mode)
+}
+
+var errInjectUnsupported = fmt.Errorf("inject is only supported by ffmpeg Stream engines, set FFmpeg.Always for plain PCM conversions")
+
+// InjectFile decodes path and injects it like Inject
+func (ae *AudioEngine) InjectFile(ctx context.Context, path string, mode stream.InjectMode) error {
+	sh, ok := ae.processor.(*stream.StreamHandle)
+	if !ok {
+		return errInjectUnsupported
+	}
+	return sh.InjectFile(ctx, path, mode)
+}
+
+// OnBargeIn registers a callback fired when input energy rises over a playing
+// prompt, an injected clip or one marked with SetPromptPlaying. Needs BargeIn
+// in the config, must be called before Start. fn runs on the writing goroutine
+func (ae *AudioEngine) OnBargeIn(fn func(stream.BargeInEvent)) error {
+	if ae.running {
+		return fmt.Errorf("engine already running")
+	}
+	sh, ok := ae.processor.(*stream.StreamHandle)
+	if !ok || ae.config.BargeIn == nil {
+		return fmt.Errorf("barge-in needs a Stream engine with BargeIn configured")
+	}
+	sh.OnBargeIn(fn)
+	return nil
+}
+
+// SetPromptPlaying arms barge-in while a prompt plays outside Inject
+func (ae *AudioEngine) SetPromptPlaying(playing bool) {
+	if sh, ok := ae.processor.(*stream.StreamHandle); ok {
+		sh.SetPromptPlaying(playing)
+	}
 }
 
 // ReadLeft read left or first channel
 func (ae *AudioEngine) ReadLeft(p []byte) (int, error) {
-	return ae.processor.ReadFrom(0, p)
+	return ae.read(0, p)
 }
 
 // ReadRight read right or second channel for split
 func (ae *AudioEngine) ReadRight(p []byte) (int, error) {
-	return ae.processor.ReadFrom(1, p)
+	return ae.read(1, p)
+}
+
+// OnProgress registers a progress callback for File mode, must be called before Start.
+// fn runs on an internal goroutine
+func (ae *AudioEngine) OnProgress(fn func(file.ProgressInfo)) error {
+	if ae.running {
+		return fmt.Errorf("engine already running")
+	}
+	fh, ok := ae.processor.(*file.FileHandle)
+	if !ok {
+		return fmt.Errorf("progress is only supported in File mode")
+	}
+	fh.OnProgress(fn)
+	return nil
+}
+
+// Segments speech segments emitted by a VADSEGMENT stream,
+// the channel is closed once ffmpeg output ends. nil for other ops or File mode
+func (ae *AudioEngine) Segments() <-chan vad.Segment {
+	if src, ok := ae.processor.(interface{ Segments() <-chan vad.Segment }); ok {
+		return src.Segments()
+	}
+	return nil
+}
+
+// Utterances "utterance complete" events of a VADSEGMENT stream with VAD.EndOfUtterance set,
+// byte offsets index the output PCM. Drain it together with Segments, nil otherwise
+func (ae *AudioEngine) Utterances() <-chan vad.Utterance {
+	if src, ok := ae.processor.(interface{ Utterances() <-chan vad.Utterance }); ok {
+		return src.Utterances()
+	}
+	return nil
+}
+
+// ReadLeftContext reads like ReadLeft, returning ErrNoData when ctx ends
+// before output arrives, so one goroutine can poll many engines. File mode
+// engines return errors.ErrUnsupported like WritePrimaryContext
+func (ae *AudioEngine) ReadLeftContext(ctx context.Context, p []byte) (int, error) {
+	return ae.readContext(ctx, 0, p)
+}
+
+// ReadRightContext reads like ReadRight with ReadLeftContext semantics
+func (ae *AudioEngine) ReadRightContext(ctx context.Context, p []byte) (int, error) {
+	return ae.readContext(ctx, 1, p)
+}
+
+// ReadOutputContext reads output i with ReadLeftContext semantics
+func (ae *AudioEngine) ReadOutputContext(ctx context.Context, i int, p []byte) (int, error) {
+	return ae.readContext(ctx, i, p)
+}
+
+// ReadOutput read output i, e.g. channel i of a multichannel split
+func (ae *AudioEngine) ReadOutput(i int, p []byte) (int, error) {
+	return ae.read(i, p)
 }
 
 // CloseInPut must close input after write done
@@ -76,13 +320,66 @@ func (ae *AudioEngine) CloseInput() {
 	if !ae.running {
 		return
 	}
+	ae.recorder.record(recCloseInput, allInputs, nil)
 	ae.processor.CloseInput()
 }
 
 func (ae *AudioEngine) Done() {
-	if !ae.running {
-		return
+	ae.mu.Lock()
+	running := ae.running
+	ae.running = false
+	ae.mu.Unlock()
+	if running {
+		ae.processor.Done()
 	}
-	ae.processor.Done()
+}
+
+// Close implements io.Closer: cancels ffmpeg, reaps it and its stages and
+// closes every pipe. Safe on an engine that never started and after Done or
+// Wait, calls after the first return nil
+func (ae *AudioEngine) Close() error {
+	ae.mu.Lock()
+	if ae.closed {
+		ae.mu.Unlock()
+		return nil
+	}
+	ae.closed = true
 	ae.running = false
+	reap := ae.started && !ae.reaped
+	ae.reaped = true
+	ae.mu.Unlock()
+	defer ae.endRuntime()
+	if ae.processor != nil {
+		ae.processor.Done()
+	}
+	if reap {
+		err := ae.reap()
+		// the cancel above is the expected way out
+		if err != nil && !errors.Is(err, context.Canceled) {
+			ae.emitUsage(err)
+			return err
+		}
+		ae.emitUsage(nil)
+	}
+	return ae.recorder.error()
+}
+
+// reap waits for the processor and records its rusage, once per run
+// whether Wait or Close gets there first
+func (ae *AudioEngine) reap() error {
+	ae.reapOnce.Do(func() {
+		ae.reapErr = ae.processor.Wait()
+		ae.stats.finish(ae.processor)
+	})
+	return ae.reapErr
+}
+
+// endRuntime releases the WithMaxRuntime timer
+func (ae *AudioEngine) endRuntime() {
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+	if ae.stopRuntime != nil {
+		ae.stopRuntime()
+		ae.stopRuntime = nil
+	}
 }
@@ -1,18 +1,26 @@
 package audiogo
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/stream"
+	"github.com/QuincyGao/audio-go/utils"
 )
 
 const (
@@ -438,7 +446,7 @@ func TestStreamChannelMerge(t *testing.T) {
 					err = engine.WriteSecondary(remaining[:n])
 				}
 				if err != nil {
-					if !errors.Is(err, os.ErrClosed) && !strings.Contains(err.Error(), "closed") {
+					if !errors.Is(err, ErrBrokenPipe) {
 						errChan <- fmt.Errorf("write error: %v", err)
 					}
 					return
@@ -513,3 +521,1009 @@ func TestFileAudioMerge(t *testing.T) {
 	}
 	t.Logf("File merge successful: %s", audioStereoFile)
 }
+
+func TestFileStatsCPU(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "ffmpeg")
+	// burns some CPU like a conversion would
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\ni=0\nwhile [ $i -lt 50000 ]; do i=$((i+1)); done\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.wav")
+	if err := os.WriteFile(in, []byte("RIFF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ae := NewAudioEngine(File, formats.AudioConfig{
+		InputArgs:   []formats.AudioArgs{{AudioFileFormat: formats.WAV}},
+		OutputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.MP3}},
+		InputFiles:  []string{in},
+		OutputFiles: []string{filepath.Join(dir, "out.mp3")},
+		FFmpeg:      formats.FFmpegOptions{Path: bin},
+	})
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ae.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	defer ae.Close()
+	if st := ae.Stats(); st.UserCPU+st.SystemCPU <= 0 || st.WallTime <= 0 {
+		t.Errorf("CPU %v+%v wall %v, want the ffmpeg process usage", st.UserCPU, st.SystemCPU, st.WallTime)
+	}
+}
+
+// TestParseProbeOutput tests ffprobe json parsing without running ffprobe
+func TestParseProbeOutput(t *testing.T) {
+	data := []byte(`{
+		"streams": [{"codec_name": "mp3", "sample_rate": "24000", "channels": 1, "bit_rate": "48000", "duration": "2.500000"}],
+		"format": {"format_name": "mp3", "duration": "2.520000", "bit_rate": "48500"}
+	}`)
+	info, err := parseProbeOutput(data)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	want := MediaInfo{FormatName: "mp3", Codec: "mp3", SampleRate: 24000, Channels: 1, Duration: 2500 * time.Millisecond, BitRate: 48000}
+	if *info != want {
+		t.Errorf("got %+v, want %+v", *info, want)
+	}
+	if args := info.AudioArgs(); args.AudioFileFormat != formats.MP3 || args.SampleRate != 24000 {
+		t.Errorf("unexpected AudioArgs: %+v", args)
+	}
+
+	if _, err := parseProbeOutput([]byte(`{"streams": [], "format": {}}`)); err == nil {
+		t.Errorf("expected error for missing audio stream")
+	}
+
+	// fileDuration finds ffprobe through the config's FFmpeg options
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncat <<'EOF'\n" + string(data) + "\nEOF\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffprobe"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	opts := formats.FFmpegOptions{Path: filepath.Join(dir, "ffmpeg")}
+	d, err := fileDuration(context.Background(), opts, "in.mp3", formats.AudioArgs{AudioFileFormat: formats.MP3})
+	if err != nil || d != 2500*time.Millisecond {
+		t.Errorf("fileDuration = %v, %v, want 2.5s from the stub ffprobe", d, err)
+	}
+}
+
+// TestExitErrorClassification tests sentinel errors parsed from ffmpeg stderr
+func TestExitErrorClassification(t *testing.T) {
+	exitErr := errors.New("exit status 1")
+	cases := []struct {
+		stderr string
+		want   error
+	}{
+		{"[in#0 @ 0x1] Unknown input format: 'foo'\nError opening input: Invalid argument", ErrUnknownFormat},
+		{"out.wav: Permission denied", ErrPermissionDenied},
+		{"Unknown encoder 'libfdk_aac'", ErrCodecNotFound},
+		{"Unrecognized option 'foo'.\nError splitting the argument list: Option not found", ErrInvalidArgument},
+		{"av_interleaved_write_frame(): Broken pipe", ErrBrokenPipe},
+	}
+	for _, c := range cases {
+		err := utils.ExitError(exitErr, c.stderr)
+		if !errors.Is(err, c.want) || !errors.Is(err, exitErr) {
+			t.Errorf("ExitError(%q) = %v, want %v", c.stderr, err, c.want)
+		}
+	}
+	if err := utils.PipeError(os.ErrClosed); !errors.Is(err, ErrBrokenPipe) {
+		t.Errorf("closed pipe write should be ErrBrokenPipe, got %v", err)
+	}
+}
+
+func TestMigrateOutputPath(t *testing.T) {
+	opts := &MigrateOptions{Ext: "flac", DestDir: "/archive/flac"}
+	got, err := migrateOutputPath("/archive/raw", "/archive/raw/2024/call.wav", opts)
+	if err != nil || got != "/archive/flac/2024/call.flac" {
+		t.Errorf("migrateOutputPath = %q, %v", got, err)
+	}
+
+	opts = &MigrateOptions{Ext: "wav"}
+	if _, err := migrateOutputPath("/archive", "/archive/call.wav", opts); err == nil {
+		t.Errorf("expected error when the output overwrites the source")
+	}
+}
+
+func TestProbeFormat(t *testing.T) {
+	cases := []struct {
+		formatName, codec string
+		want              formats.AudioFileFormat
+	}{
+		{"mov,mp4,m4a,3gp,3g2,mj2", "aac", formats.M4A},
+		{"ogg", "opus", formats.OPUS},
+		{"ogg", "vorbis", formats.OGG},
+		{"wav", "pcm_s16le", formats.WAV},
+		{"wav", "adpcm_ms", formats.ADPCMMS},
+		{"amr", "amr_wb", formats.AMRWB},
+		{"mp3", "mp3", formats.MP3},
+	}
+	for _, c := range cases {
+		data := fmt.Sprintf(`{"streams": [{"codec_name": %q, "sample_rate": "48000", "channels": 2}], "format": {"format_name": %q}}`, c.codec, c.formatName)
+		info, err := parseProbeOutput([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := info.Format()
+		if err != nil || got != c.want {
+			t.Errorf("%s/%s: Format = %q, %v, want %q", c.formatName, c.codec, got, err, c.want)
+			continue
+		}
+		// a source already in the target format is skipped by Migrate
+		target := formats.AudioArgs{AudioFileFormat: c.want, SampleRate: 48000}
+		if !matchesTarget(info, got, target) {
+			t.Errorf("%s/%s does not match target %s", c.formatName, c.codec, c.want)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestMigrateAuditError(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.wav", "b.wav"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("not audio"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := MigrateOptions{Target: formats.AudioArgs{AudioFileFormat: formats.FLAC}, Audit: failingWriter{}}
+	if _, err := Migrate(context.Background(), root, opts); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("Migrate = %v, want the audit write error", err)
+	}
+}
+
+func TestPCMDuration(t *testing.T) {
+	arg := formats.AudioArgs{AudioFileFormat: formats.S16LE, SampleRate: 16000, Channels: 2}
+	if got := pcmDuration(64000, arg); got != time.Second {
+		t.Errorf("pcmDuration = %v, want 1s", got)
+	}
+	if got := pcmDuration(1000, formats.AudioArgs{AudioFileFormat: formats.MP3, SampleRate: 16000, Channels: 1}); got != 0 {
+		t.Errorf("encoded formats have no byte duration, got %v", got)
+	}
+}
+
+func TestGlobJobs(t *testing.T) {
+	jobs, err := GlobJobs("./example/sample_data/audio-*.mp3", "/tmp/out/{name}.wav")
+	if err != nil {
+		t.Fatalf("GlobJobs failed: %v", err)
+	}
+	if len(jobs) == 0 {
+		t.Fatalf("no jobs for the sample mp3 files")
+	}
+	for _, job := range jobs {
+		name := strings.TrimSuffix(filepath.Base(job.Input), ".mp3")
+		if job.Output != "/tmp/out/"+name+".wav" {
+			t.Errorf("output of %s = %s", job.Input, job.Output)
+		}
+	}
+}
+
+func TestWatchFailure(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.mp3"), []byte("not audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	template := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.MP3}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.WAV}},
+		TraceID:    "batch-3",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var failed WatchEvent
+	err := Watch(ctx, dir, template, WatchOptions{
+		OutputDir: t.TempDir(),
+		FailedDir: filepath.Join(dir, "failed"),
+		Interval:  10 * time.Millisecond,
+		OnSuccess: func(ev WatchEvent) { t.Errorf("broken file converted: %+v", ev) },
+		OnFailure: func(ev WatchEvent) {
+			failed = ev
+			cancel()
+		},
+	})
+	if err != context.Canceled {
+		t.Fatalf("Watch returned %v", err)
+	}
+	if failed.Source != filepath.Join(dir, "failed", "broken.mp3") {
+		t.Errorf("source not moved to FailedDir: %+v", failed)
+	}
+	if failed.TraceID != "batch-3" {
+		t.Errorf("TraceID = %q, want batch-3", failed.TraceID)
+	}
+	if _, err := os.Stat(failed.Output); !os.IsNotExist(err) {
+		t.Errorf("output of a failed conversion exists: %v", err)
+	}
+}
+
+func TestWatchOverlappingDirs(t *testing.T) {
+	dir := t.TempDir()
+	template := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.MP3}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.WAV}},
+	}
+	for _, opts := range []WatchOptions{
+		{OutputDir: dir},
+		{OutputDir: filepath.Join(dir, "out")},
+		{OutputDir: filepath.Join(dir, ".") + "/"},
+		{OutputDir: t.TempDir(), DoneDir: dir},
+	} {
+		if err := Watch(context.Background(), dir, template, opts); err == nil {
+			t.Errorf("Watch accepted %+v", opts)
+		}
+	}
+	// a sibling sharing the name prefix is outside
+	if inside, err := withinDir(dir, dir+"-out"); err != nil || inside {
+		t.Errorf("withinDir(%q) = %v, %v", dir+"-out", inside, err)
+	}
+}
+
+func TestEngineClose(t *testing.T) {
+	var _ io.Closer = (*AudioEngine)(nil)
+
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	}
+	if err := NewAudioEngine(Stream, cfg).Close(); err != nil {
+		t.Errorf("Close of an engine never started: %v", err)
+	}
+
+	ae := NewAudioEngine(Stream, cfg)
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := ae.Close(); err != nil {
+			t.Errorf("Close #%d: %v", i+1, err)
+		}
+	}
+	if err := ae.WritePrimary(make([]byte, 320)); err == nil {
+		t.Error("write after Close succeeded")
+	}
+
+	ae = NewAudioEngine(AudioEngineType(7), cfg)
+	if err := ae.Start(context.Background()); err == nil {
+		t.Error("unknown engine type started")
+	}
+	if err := ae.WritePrimary(make([]byte, 320)); err == nil {
+		t.Error("write to an unknown engine type succeeded")
+	}
+	if _, err := ae.ReadLeft(make([]byte, 160)); err == nil {
+		t.Error("read from an unknown engine type succeeded")
+	}
+	if err := ae.Close(); err != nil {
+		t.Errorf("Close of an unknown engine type: %v", err)
+	}
+}
+
+// run with -race: Close from one goroutine while another is in Wait
+func TestCloseDuringWait(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	}
+	var records atomic.Int32
+	ae := NewAudioEngine(Stream, cfg).WithUsage(UsageEmitterFunc(func(Usage) { records.Add(1) }))
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waited := make(chan struct{})
+	go func() {
+		defer close(waited)
+		ae.Wait()
+	}()
+	ae.Close()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait still blocked after Close")
+	}
+	if n := records.Load(); n != 1 {
+		t.Errorf("%d usage records, want 1", n)
+	}
+}
+
+func TestOutputChan(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	}
+	ae := NewAudioEngine(Stream, cfg)
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer ae.Close()
+	go func() {
+		ae.WritePrimary(make([]byte, 640))
+		ae.CloseInput()
+	}()
+	chunks, readErr := ae.OutputChan(context.Background(), 0, 100)
+	total := 0
+	for c := range chunks {
+		total += len(c)
+	}
+	if total != 320 || readErr() != nil {
+		t.Errorf("read %d bytes, %v", total, readErr())
+	}
+
+	// a receiver that stops early cancels, the goroutine does not block on it
+	ae = NewAudioEngine(Stream, cfg)
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer ae.Close()
+	go ae.WritePrimary(make([]byte, 640))
+	ctx, cancel := context.WithCancel(context.Background())
+	chunks, _ = ae.OutputChan(ctx, 0, 10)
+	<-chunks
+	cancel()
+	// nobody receives while it gives up, the next receive sees the close
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := <-chunks; ok {
+		t.Error("OutputChan still sending after cancel")
+	}
+}
+
+func TestOnOutput(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	}
+	ae := NewAudioEngine(Stream, cfg)
+	if err := ae.OnOutput(0, func([]byte, error) {}); err == nil {
+		t.Error("OnOutput before Start succeeded")
+	}
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer ae.Close()
+	total := 0
+	end := make(chan error, 1)
+	err := ae.OnOutput(0, func(data []byte, err error) {
+		total += len(data)
+		if err != nil {
+			end <- err
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ae.WritePrimary(make([]byte, 640))
+	ae.CloseInput()
+	if err := <-end; err != io.EOF || total != 320 {
+		t.Errorf("read %d bytes, last call %v", total, err)
+	}
+}
+
+func TestContextUnsupported(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	}
+	// File mode can not abandon a blocked call, a ctx that ends is refused
+	ae := NewAudioEngine(File, cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := ae.WritePrimaryContext(ctx, make([]byte, 320)); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("WritePrimaryContext = %v, want ErrUnsupported", err)
+	}
+	if _, err := ae.ReadLeftContext(ctx, make([]byte, 160)); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("ReadLeftContext = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestMaxRuntime(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	}
+	ae := NewAudioEngine(Stream, cfg).WithMaxRuntime(20 * time.Millisecond)
+	defer ae.Close()
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// input never closed, only the cap ends the run
+	if err := ae.Wait(); !errors.Is(err, ErrMaxRuntime) {
+		t.Errorf("Wait = %v, want ErrMaxRuntime", err)
+	}
+}
+
+// fakeWS scripted WSConn, in is read until closed, sent collects writes
+type fakeWS struct {
+	in   chan []byte
+	sent [][]byte
+	kind []int
+}
+
+func (c *fakeWS) ReadMessage() (int, []byte, error) {
+	data, ok := <-c.in
+	if !ok {
+		return 0, nil, io.EOF
+	}
+	return 2, data, nil
+}
+
+func (c *fakeWS) WriteMessage(kind int, data []byte) error {
+	c.kind = append(c.kind, kind)
+	c.sent = append(c.sent, slices.Clone(data))
+	return nil
+}
+
+func TestBridgeWebSocket(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	}
+	ae := NewAudioEngine(Stream, cfg)
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer ae.Close()
+	conn := &fakeWS{in: make(chan []byte, 4)}
+	conn.in <- make([]byte, 500)
+	conn.in <- make([]byte, 100)
+	conn.in <- nil
+	if err := ae.BridgeWebSocket(conn, WSOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	close(conn.in)
+
+	// 300 mulaw bytes in 160 byte frames, then a normal close
+	if len(conn.sent) != 3 || len(conn.sent[0]) != 160 || len(conn.sent[1]) != 140 {
+		t.Fatalf("sent %d messages: %v", len(conn.sent), conn.kind)
+	}
+	if conn.kind[2] != 8 || !bytes.Equal(conn.sent[2], []byte{0x03, 0xe8}) {
+		t.Errorf("close frame = %d %x", conn.kind[2], conn.sent[2])
+	}
+}
+
+// writingFFmpeg stub ffmpeg writing data to its last argument, the output file
+func writingFFmpeg(t *testing.T, data string) formats.FFmpegOptions {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "ffmpeg")
+	script := "#!/bin/sh\nfor a; do last=$a; done\nprintf '" + data + "' > \"$last\"\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return formats.FFmpegOptions{Path: bin}
+}
+
+func TestRunFile(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.wav")
+	if err := os.WriteFile(in, []byte("RIFF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := formats.AudioConfig{
+		InputArgs:   []formats.AudioArgs{{AudioFileFormat: formats.WAV}},
+		OutputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.MP3}},
+		InputFiles:  []string{in},
+		OutputFiles: []string{filepath.Join(dir, "out.mp3")},
+		TraceID:     "job-1",
+		FFmpeg:      writingFFmpeg(t, "ID3 frames"),
+	}
+	res, err := RunFile(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OpType != formats.FORMATCONVERT || res.TraceID != "job-1" || res.Elapsed <= 0 {
+		t.Errorf("result = %+v", res)
+	}
+	if !slices.Equal(res.OutputFiles, cfg.OutputFiles) || !slices.Equal(res.OutputSizes, []int64{10}) {
+		t.Errorf("outputs %v sizes %v, want %v of 10 bytes", res.OutputFiles, res.OutputSizes, cfg.OutputFiles)
+	}
+
+	cfg.FFmpeg = formats.FFmpegOptions{Path: "false"}
+	if res, err := RunFile(context.Background(), cfg); err == nil || res.OutputSizes != nil {
+		t.Errorf("failed run = %+v, %v, want an error and no sizes", res, err)
+	}
+}
+
+func TestRunWithFiles(t *testing.T) {
+	dir := t.TempDir()
+	ae := NewAudioEngine(File, formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.WAV}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MP3}},
+		FFmpeg:     writingFFmpeg(t, "ID3"),
+	})
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			in := filepath.Join(dir, fmt.Sprintf("in%d.wav", i))
+			out := filepath.Join(dir, fmt.Sprintf("out%d.mp3", i))
+			if err := os.WriteFile(in, []byte("RIFF"), 0644); err != nil {
+				t.Error(err)
+				return
+			}
+			res, err := ae.RunWithFiles(context.Background(), []string{in}, []string{out})
+			if err != nil || !slices.Equal(res.OutputFiles, []string{out}) {
+				t.Errorf("run %d = %+v, %v", i, res, err)
+			}
+		}()
+	}
+	wg.Wait()
+	// the template keeps no files of the runs
+	if cfg := ae.Config(); cfg.InputFiles != nil || cfg.OutputFiles != nil {
+		t.Errorf("template changed: %v %v", cfg.InputFiles, cfg.OutputFiles)
+	}
+}
+
+func TestEngineConfigCopy(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+		Filters:    []string{"volume=2"},
+	}
+	ae := NewAudioEngine(Stream, cfg)
+	// neither the caller's config nor a returned copy reach the engine
+	cfg.Filters[0] = "volume=9"
+	cfg.OutputArgs[0].AudioFileFormat = formats.ALAW
+	got := ae.Config()
+	got.Filters[0] = "volume=0"
+	if c := ae.Config(); c.Filters[0] != "volume=2" || c.OutputArgs[0].AudioFileFormat != formats.MULAW {
+		t.Errorf("engine config changed: %v %v", c.Filters, c.OutputArgs)
+	}
+}
+
+func TestIOAdapters(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW, Name: "agent"}},
+	}
+	ae := NewAudioEngine(Stream, cfg)
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer ae.Close()
+	r, err := ae.Reader("agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ae.Reader("caller"); err == nil {
+		t.Error("Reader of an unknown name succeeded")
+	}
+	copied := make(chan error, 1)
+	go func() {
+		w := ae.InputWriter(0)
+		_, err := io.Copy(w, bytes.NewReader(make([]byte, 640)))
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		copied <- err
+	}()
+	// Close of the writer ends the input, so the reader sees EOF
+	out, err := io.ReadAll(r)
+	if err != nil || len(out) != 320 {
+		t.Errorf("read %d bytes, %v, want 320 mulaw bytes", len(out), err)
+	}
+	if err := <-copied; err != nil {
+		t.Errorf("copy into InputWriter = %v", err)
+	}
+	if err := ae.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	}
+	var session bytes.Buffer
+	ae := NewAudioEngine(Stream, cfg)
+	if err := ae.Record(&session); err != nil {
+		t.Fatal(err)
+	}
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	pcm := make([]byte, 640)
+	for i := range pcm {
+		pcm[i] = byte(i * 7)
+	}
+	go func() {
+		ae.WritePrimary(pcm)
+		ae.CloseInput()
+	}()
+	if _, err := io.ReadAll(ae.OutputReader(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ae.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ae.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the session ends with the run, a restarted run is not appended
+	recorded := session.Len()
+	if err := ae.Restart(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		ae.WritePrimary(pcm)
+		ae.CloseInput()
+	}()
+	io.ReadAll(ae.OutputReader(0))
+	if err := ae.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	ae.Close()
+	if session.Len() != recorded {
+		t.Errorf("Restart kept recording: session grew from %d to %d bytes", recorded, session.Len())
+	}
+
+	res, err := Replay(context.Background(), bytes.NewReader(session.Bytes()), ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Recorded) != 1 || len(res.Recorded[0]) != 320 {
+		t.Fatalf("recorded outputs %d", len(res.Recorded))
+	}
+	if out, off, bad := res.Mismatch(); bad {
+		t.Errorf("replay differs at output %d byte %d", out, off)
+	}
+
+	alaw := cfg.Clone()
+	alaw.OutputArgs[0].AudioFileFormat = formats.ALAW
+	res, err = Replay(context.Background(), bytes.NewReader(session.Bytes()), ReplayOptions{Config: &alaw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, bad := res.Mismatch(); !bad {
+		t.Error("replay through alaw matched the mulaw recording")
+	}
+}
+
+// needFaults skips tests that inject faults unless built with audiogo_faults
+func needFaults(t *testing.T) {
+	t.Helper()
+	if !faultsEnabled {
+		t.Skip("fault injection needs -tags audiogo_faults")
+	}
+}
+
+func TestFaults(t *testing.T) {
+	needFaults(t)
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	}
+	ae := NewAudioEngine(Stream, cfg).WithFaults(Faults{TruncateReadAt: 100, KillAt: 200})
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer ae.Close()
+	written := make(chan error, 1)
+	go func() { written <- ae.WritePrimary(make([]byte, 200)) }()
+	out, err := io.ReadAll(ae.OutputReader(0))
+	if len(out) != 100 || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("read %d bytes, %v, want 100 and ErrUnexpectedEOF", len(out), err)
+	}
+	if err := <-written; !errors.Is(err, ErrBrokenPipe) {
+		t.Errorf("write reaching KillAt = %v, want ErrBrokenPipe", err)
+	}
+	if err := ae.WritePrimary(make([]byte, 2)); !errors.Is(err, ErrBrokenPipe) {
+		t.Errorf("write after kill = %v", err)
+	}
+
+	// Restart keeps the faults with fresh counters
+	if err := ae.Restart(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ae.faults == nil || ae.faults.Faults != (Faults{TruncateReadAt: 100, KillAt: 200}) {
+		t.Fatalf("faults after Restart = %+v", ae.faults)
+	}
+	writes := make(chan error, 2)
+	go func() {
+		writes <- ae.WritePrimary(make([]byte, 150))
+		writes <- ae.WritePrimary(make([]byte, 50))
+	}()
+	out, err = io.ReadAll(ae.OutputReader(0))
+	if len(out) != 100 || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("after Restart read %d bytes, %v, want 100 and ErrUnexpectedEOF", len(out), err)
+	}
+	if err := <-writes; err != nil {
+		t.Errorf("write below KillAt after Restart = %v", err)
+	}
+	if err := <-writes; !errors.Is(err, ErrBrokenPipe) {
+		t.Errorf("write reaching KillAt after Restart = %v, want ErrBrokenPipe", err)
+	}
+}
+
+func TestPipelineAutoAdapt(t *testing.T) {
+	encode := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	}
+	decode := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.ALAW}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+	}
+	var diffs formats.CompatError
+	if err := NewPipeline(encode, decode).Start(context.Background()); !errors.As(err, &diffs) {
+		t.Fatalf("mulaw into alaw started: %v", err)
+	}
+
+	p := NewPipeline(encode, decode)
+	p.AutoAdapt = true
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if n := len(p.Stages()); n != 3 {
+		t.Fatalf("%d stages, want an adapter between 2", n)
+	}
+	go func() {
+		p.Write(make([]byte, 640))
+		p.CloseInput()
+	}()
+	out, err := io.ReadAll(p)
+	if err != nil || len(out) != 640 {
+		t.Errorf("read %d bytes, %v", len(out), err)
+	}
+	if err := p.Wait(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPipelineCopyFailure(t *testing.T) {
+	needFaults(t)
+	stage := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+	}
+	p := NewPipeline(stage, stage)
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	// the second stage dies mid-stream, the first is left with output nobody reads
+	p.Stages()[1].WithFaults(Faults{KillAt: 320})
+	go func() {
+		for i := 0; i < 64; i++ {
+			if p.Write(make([]byte, 4096)) != nil {
+				return
+			}
+		}
+		p.CloseInput()
+	}()
+	go io.Copy(io.Discard, p)
+
+	done := make(chan error, 1)
+	go func() { done <- p.Wait() }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrBrokenPipe) {
+			t.Errorf("Wait = %v, want the failed copy", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait hangs after a failed copy")
+	}
+}
+
+// a stage config with Gain and Fade must not apply them again in the adapter
+func TestAdapterConfig(t *testing.T) {
+	out := formats.AudioArgs{AudioFileFormat: formats.MULAW, SampleRate: 8000, Channels: 1, Gain: 6, Filter: "volume=2"}
+	in := formats.AudioArgs{AudioFileFormat: formats.ALAW}
+	cfg := adapterConfig(out, in, formats.FFmpegOptions{})
+	want := formats.AudioArgs{AudioFileFormat: formats.MULAW, SampleRate: 8000, Channels: 1}
+	if got := cfg.InputArgs[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("adapter input = %+v, want %+v", got, want)
+	}
+	if got := cfg.OutputArgs[0]; got.AudioFileFormat != formats.ALAW || got.SampleRate != 8000 || got.Gain != 0 {
+		t.Errorf("adapter output = %+v", got)
+	}
+}
+
+func TestEnginePool(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script standing in for ffmpeg")
+	}
+	// a long running stand-in, the pool only needs processes that stay up
+	bin := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+		FFmpeg:     formats.FFmpegOptions{Path: bin, Always: true},
+	}
+	key, err := poolKey(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := NewEnginePool(ctx, 2)
+	defer pool.Close()
+	idle := func() []*AudioEngine {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		return slices.Clone(pool.idle[key])
+	}
+	eventually := func(what string, cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+
+	ae, err := pool.Get(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ae.Close()
+	eventually("the refill", func() bool { return len(idle()) == 2 })
+
+	// an idle engine crashes, its exit is noticed without a Wait
+	crashed := idle()[1]
+	crashed.processor.(*stream.StreamHandle).Kill()
+	eventually("the crash", func() bool { return !crashed.alive() })
+	ae, err = pool.Get(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ae == crashed || !ae.alive() {
+		t.Fatal("Get handed out a crashed engine")
+	}
+	pool.Put(ae)
+	eventually("the pool to refill", func() bool { return len(idle()) == 2 })
+	if slices.Contains(idle(), crashed) {
+		t.Error("the crashed engine is still pooled")
+	}
+
+	// an engine the pool did not hand out is released, not pooled
+	other := NewAudioEngine(Stream, cfg)
+	if err := other.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	pool.Put(other)
+	if other.alive() || slices.Contains(idle(), other) {
+		t.Error("Put pooled a foreign engine")
+	}
+}
+
+func TestStreamStats(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE, SampleRate: 8000, Channels: 1}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW, SampleRate: 8000, Channels: 1}},
+	}
+	ae := NewAudioEngine(Stream, cfg)
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer ae.Close()
+	go func() {
+		ae.WritePrimary(make([]byte, 8000))
+		ae.WritePrimary(make([]byte, 8000))
+		ae.CloseInput()
+	}()
+	if _, err := io.ReadAll(ae.OutputReader(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ae.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	st := ae.Stats()
+	if st.BytesIn != 16000 || st.ChunksIn != 2 || st.BytesOut != 8000 || st.ChunksOut == 0 {
+		t.Errorf("counters in %d/%d out %d/%d, want 16000 bytes in 2 chunks and 8000 bytes out", st.BytesIn, st.ChunksIn, st.BytesOut, st.ChunksOut)
+	}
+	if st.WallTime <= 0 || ae.Stats().WallTime != st.WallTime {
+		t.Errorf("WallTime %v keeps running after Wait", st.WallTime)
+	}
+	if len(st.Inputs) != 1 || st.Inputs[0].Samples != 8000 || st.DurationIn != time.Second {
+		t.Errorf("inputs %+v, duration %v, want 8000 samples and 1s", st.Inputs, st.DurationIn)
+	}
+	if len(st.Outputs) != 1 || st.Outputs[0].Bytes != 8000 || st.DurationOut != time.Second {
+		t.Errorf("outputs %+v, duration %v, want 8000 bytes and 1s", st.Outputs, st.DurationOut)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	cfg := formats.AudioConfig{
+		TraceID:    "call-1",
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE, SampleRate: 8000, Channels: 1}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW, SampleRate: 8000, Channels: 1}},
+	}
+	var records []Usage
+	ae := NewAudioEngine(Stream, cfg).WithUsage(UsageEmitterFunc(func(u Usage) { records = append(records, u) }))
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		ae.WritePrimary(make([]byte, 8000))
+		ae.CloseInput()
+	}()
+	if _, err := io.ReadAll(ae.OutputReader(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ae.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	// one record per run however often it is waited for
+	ae.Wait()
+	ae.Close()
+	if len(records) != 1 {
+		t.Fatalf("%d usage records, want 1", len(records))
+	}
+	u := records[0]
+	if u.TraceID != "call-1" || u.OpType != formats.FORMATCONVERT || u.InputCodec != "s16le" ||
+		u.OutputCodec != "mulaw" || u.InputSeconds != 0.5 || u.OutputSeconds != 0.5 || u.Err != nil {
+		t.Errorf("usage = %+v", u)
+	}
+
+	ae.Reset(cfg)
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ae.Close()
+	if len(records) != 2 || records[1].InputSeconds != 0 {
+		t.Errorf("Close of an unwaited run: %+v", records)
+	}
+
+	// File mode probes its files with the run's ctx, bounded
+	ctx, cancel := context.WithCancel(context.Background())
+	ae = NewAudioEngine(File, cfg)
+	ae.ctx = ctx
+	probeCtx, stop := ae.probeContext()
+	defer stop()
+	if _, ok := probeCtx.Deadline(); !ok {
+		t.Error("probe context has no deadline")
+	}
+	cancel()
+	if probeCtx.Err() == nil {
+		t.Error("probe context outlives the run's ctx")
+	}
+}
+
+func TestNamedOutput(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW, Name: "ulaw"}},
+	}
+	ae := NewAudioEngine(Stream, cfg)
+	if err := ae.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer ae.Close()
+	if _, err := ae.Reader("alaw"); err == nil {
+		t.Error("Reader of an unknown name succeeded")
+	}
+	r, err := ae.Reader("ulaw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		ae.WritePrimary(make([]byte, 320))
+		ae.CloseInput()
+	}()
+	if out, err := io.ReadAll(r); len(out) != 160 || err != nil {
+		t.Errorf("read %d bytes, %v, want 160", len(out), err)
+	}
+}
+
+func TestPipelineEncodedInput(t *testing.T) {
+	record := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE, SampleRate: 16000}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.WAV, SampleRate: 16000}},
+	}
+	transcode := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.WAV}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MP3}},
+	}
+	if _, err := NewPipeline(record, transcode).link(); err != nil {
+		t.Errorf("16 kHz wav into a wav input without a rate: %v", err)
+	}
+	p := NewPipeline(record, transcode)
+	p.AutoAdapt = true
+	stages, err := p.link()
+	if err != nil || len(stages) != 2 {
+		t.Errorf("link = %d stages, %v, want 2 without an adapter", len(stages), err)
+	}
+}
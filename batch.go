@@ -0,0 +1,74 @@
+package audiogo
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// BatchJob one input/output pair of a batch
+type BatchJob struct {
+	Input  string
+	Output string
+}
+
+// BatchResult outcome of one job, Err nil on success
+type BatchResult struct {
+	Job    BatchJob
+	Result Result
+	Err    error
+}
+
+// RunBatch converts every job with template in File mode, one ffmpeg per job
+// and at most workers at a time (1 when workers <= 0). Results keep the job order
+func RunBatch(ctx context.Context, template formats.AudioConfig, jobs []BatchJob, workers int) []BatchResult {
+	results := make([]BatchResult, len(jobs))
+	sem := make(chan struct{}, max(workers, 1))
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		results[i].Job = job
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			cfg := template.Clone()
+			cfg.InputFiles = []string{job.Input}
+			cfg.OutputFiles = []string{job.Output}
+			results[i].Result, results[i].Err = RunFile(ctx, cfg)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// GlobJobs pairs every file matching pattern with an output path from
+// outputTemplate, where {dir} is the input directory and {name} the input
+// file name without extension, e.g. "out/{name}.wav"
+func GlobJobs(pattern, outputTemplate string) ([]BatchJob, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("glob %s: %w", pattern, err)
+	}
+	jobs := make([]BatchJob, 0, len(matches))
+	for _, in := range matches {
+		base := filepath.Base(in)
+		out := strings.NewReplacer(
+			"{dir}", filepath.Dir(in),
+			"{name}", strings.TrimSuffix(base, filepath.Ext(base)),
+		).Replace(outputTemplate)
+		jobs = append(jobs, BatchJob{Input: in, Output: out})
+	}
+	return jobs, nil
+}
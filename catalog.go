@@ -0,0 +1,13 @@
+package audiogo
+
+import "github.com/QuincyGao/audio-go/formats"
+
+// SupportedFormats machine-readable descriptors of every AudioFileFormat
+func SupportedFormats() []formats.FormatInfo {
+	return formats.Formats()
+}
+
+// SupportedOps machine-readable descriptors of every OpType
+func SupportedOps() []formats.OpInfo {
+	return formats.Ops()
+}
@@ -0,0 +1,55 @@
+package audiogo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var engineTypeNames = map[AudioEngineType]string{
+	Stream: "Stream",
+	File:   "File",
+}
+
+func (t AudioEngineType) String() string {
+	if name, ok := engineTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("AudioEngineType(%d)", int(t))
+}
+
+// ParseAudioEngineType accepts the String() form, case-insensitive
+func ParseAudioEngineType(s string) (AudioEngineType, error) {
+	for t, name := range engineTypeNames {
+		if strings.EqualFold(name, s) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid AudioEngineType: %s", s)
+}
+
+func (t AudioEngineType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON accepts the name or the legacy integer value
+func (t *AudioEngineType) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		if _, ok := engineTypeNames[AudioEngineType(n)]; !ok {
+			return fmt.Errorf("invalid AudioEngineType: %d", n)
+		}
+		*t = AudioEngineType(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseAudioEngineType(s)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
@@ -0,0 +1,19 @@
+package audiogo
+
+import "github.com/QuincyGao/audio-go/utils"
+
+// Errors returned by Wait and the write methods, match them with errors.Is
+var (
+	ErrUnknownFormat    = utils.ErrUnknownFormat
+	ErrInvalidData      = utils.ErrInvalidData
+	ErrPermissionDenied = utils.ErrPermissionDenied
+	ErrBrokenPipe       = utils.ErrBrokenPipe
+	ErrInvalidArgument  = utils.ErrInvalidArgument
+	ErrCodecNotFound    = utils.ErrCodecNotFound
+	ErrWriteStalled     = utils.ErrWriteStalled
+	ErrNoData           = utils.ErrNoData
+	ErrDurationMismatch = utils.ErrDurationMismatch
+	ErrOutputExists     = utils.ErrOutputExists
+	ErrDeadlock         = utils.ErrDeadlock
+	ErrMaxRuntime       = utils.ErrMaxRuntime
+)
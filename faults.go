@@ -0,0 +1,103 @@
+package audiogo
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+// Faults mid-stream failures for testing error handling around the engine.
+// They only take effect in builds with the audiogo_faults tag, e.g.
+// go test -tags audiogo_faults, elsewhere WithFaults is a no-op
+type Faults struct {
+	// WriteDelay sleeps before every write
+	WriteDelay time.Duration
+	// TruncateReadAt ends every output with io.ErrUnexpectedEOF after this many bytes, 0 disables
+	TruncateReadAt int64
+	// KillAt kills ffmpeg once this many input bytes, over all inputs, were
+	// written. The write crossing it returns ErrBrokenPipe. 0 disables
+	KillAt int64
+}
+
+// faultState counters of the injected faults
+type faultState struct {
+	Faults
+	mu      sync.Mutex
+	written int64
+	read    map[int]int64
+	killed  bool
+}
+
+// WithFaults injects faults into every later run, must be called before
+// Start. Honoured only with the audiogo_faults build tag
+func (ae *AudioEngine) WithFaults(f Faults) *AudioEngine {
+	if faultsEnabled {
+		ae.faults = &faultState{Faults: f, read: make(map[int]int64)}
+	}
+	return ae
+}
+
+// beforeWrite applies WriteDelay and KillAt, returning the part of data to
+// write and the error to report once it is written
+func (fs *faultState) beforeWrite(data []byte) ([]byte, error) {
+	if fs == nil {
+		return data, nil
+	}
+	if fs.WriteDelay > 0 {
+		time.Sleep(fs.WriteDelay)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.KillAt <= 0 {
+		return data, nil
+	}
+	if fs.killed {
+		return nil, fmt.Errorf("%w: fault injected, ffmpeg killed", utils.ErrBrokenPipe)
+	}
+	if left := fs.KillAt - fs.written; int64(len(data)) >= left {
+		fs.killed = true
+		fs.written = fs.KillAt
+		return data[:left], fmt.Errorf("%w: fault injected, ffmpeg killed at input byte %d", utils.ErrBrokenPipe, fs.KillAt)
+	}
+	fs.written += int64(len(data))
+	return data, nil
+}
+
+// limitRead shortens p to what TruncateReadAt leaves of output index, err
+// set once nothing is left
+func (fs *faultState) limitRead(index int, p []byte) ([]byte, error) {
+	if fs == nil || fs.TruncateReadAt <= 0 {
+		return p, nil
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	left := fs.TruncateReadAt - fs.read[index]
+	if left <= 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > left {
+		p = p[:left]
+	}
+	return p, nil
+}
+
+func (fs *faultState) countRead(index, n int) {
+	if fs == nil || fs.TruncateReadAt <= 0 {
+		return
+	}
+	fs.mu.Lock()
+	fs.read[index] += int64(n)
+	fs.mu.Unlock()
+}
+
+// kill ends ffmpeg like a crash would, processors without a process are cancelled
+func (ae *AudioEngine) kill() {
+	if p, ok := ae.processor.(interface{ Kill() error }); ok {
+		p.Kill()
+		return
+	}
+	ae.processor.Done()
+}
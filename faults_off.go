@@ -0,0 +1,6 @@
+//go:build !audiogo_faults
+
+package audiogo
+
+// faultsEnabled WithFaults is a no-op outside audiogo_faults builds
+const faultsEnabled = false
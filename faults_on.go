@@ -0,0 +1,6 @@
+//go:build audiogo_faults
+
+package audiogo
+
+// faultsEnabled WithFaults takes effect
+const faultsEnabled = true
@@ -0,0 +1,95 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+// output target of output i: its temp file under AtomicOutput, its FIFO fd,
+// a unix socket url or else the configured path
+func (f *FileHandle) output(i int) string {
+	if i < len(f.temps) && f.temps[i] != "" {
+		return f.temps[i]
+	}
+	if target := f.fifoTarget(i); target != "" {
+		return target
+	}
+	path := f.config.OutputFiles[i]
+	if utils.IsSocket(path) {
+		return "unix:" + path
+	}
+	return formats.NetworkTarget(path, f.config.PacketSize)
+}
+
+// isDirectOutput output i is no regular file: a sound device, a network or
+// push url, a named FIFO or a unix socket
+func (f *FileHandle) isDirectOutput(i int) bool {
+	path := f.config.OutputFiles[i]
+	return formats.IsSoundDevice(f.config.GetOutputArg(i).AudioFileFormat) || formats.IsNetworkURL(path) ||
+		formats.IsPushURL(path) || utils.IsFIFO(path) || utils.IsSocket(path)
+}
+
+// createTemps reserves a hidden temp file next to every output file,
+// direct outputs are written in place
+func (f *FileHandle) createTemps() error {
+	f.temps = make([]string, len(f.config.OutputFiles))
+	for i, path := range f.config.OutputFiles {
+		// segments are named after the playlist, it can not be renamed
+		if f.isDirectOutput(i) || f.config.GetOutputArg(i).AudioFileFormat == formats.HLS {
+			continue
+		}
+		tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+tracePart(f.config.TraceID)+".*.part")
+		if err != nil {
+			f.removeTemps()
+			return fmt.Errorf("create temp output: %w", err)
+		}
+		tmp.Close()
+		f.temps[i] = tmp.Name()
+	}
+	return nil
+}
+
+// commitTemps renames the finished temp files to their final paths
+func (f *FileHandle) commitTemps() error {
+	for i, tmp := range f.temps {
+		if tmp == "" {
+			continue
+		}
+		if err := os.Rename(tmp, f.config.OutputFiles[i]); err != nil {
+			f.removeTemps()
+			return fmt.Errorf("rename output: %w", err)
+		}
+		f.temps[i] = ""
+	}
+	return nil
+}
+
+func (f *FileHandle) removeTemps() {
+	for i, tmp := range f.temps {
+		if tmp != "" {
+			os.Remove(tmp)
+			f.temps[i] = ""
+		}
+	}
+}
+
+// tracePart ".<id>" for temp names, characters unsafe in file names become _
+func tracePart(traceID string) string {
+	if traceID == "" {
+		return ""
+	}
+	safe := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return '_'
+	}, traceID)
+	return "." + safe
+}
@@ -0,0 +1,57 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+func TestAtomicOutput(t *testing.T) {
+	dir := t.TempDir()
+	final := filepath.Join(dir, "out.wav")
+	f := NewFileHandle(formats.AudioConfig{OutputFiles: []string{final, "udp://127.0.0.1:4000"}})
+	if err := f.createTemps(); err != nil {
+		t.Fatal(err)
+	}
+	tmp := f.output(0)
+	if tmp == final || filepath.Dir(tmp) != dir {
+		t.Fatalf("temp output %s is not a sibling of %s", tmp, final)
+	}
+	if got := f.output(1); got != "udp://127.0.0.1:4000" {
+		t.Errorf("network output rewritten to %s", got)
+	}
+	if err := os.WriteFile(tmp, []byte("RIFF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(final); !os.IsNotExist(err) {
+		t.Fatalf("final path exists before commit: %v", err)
+	}
+	if err := f.commitTemps(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(final); err != nil || string(data) != "RIFF" {
+		t.Fatalf("final output = %q, %v", data, err)
+	}
+
+	f.createTemps()
+	tmp = f.output(0)
+	f.removeTemps()
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("temp output left behind: %v", err)
+	}
+}
+
+func TestAtomicOutputTraceID(t *testing.T) {
+	dir := t.TempDir()
+	f := NewFileHandle(formats.AudioConfig{OutputFiles: []string{filepath.Join(dir, "out.wav")}, TraceID: "call/42:a"})
+	if err := f.createTemps(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.removeTemps()
+	if base := filepath.Base(f.output(0)); !strings.HasPrefix(base, ".out.wav.call_42_a.") {
+		t.Errorf("temp name %s does not carry the trace id", base)
+	}
+}
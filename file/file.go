@@ -3,10 +3,12 @@ package file
 import (
 	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"syscall"
+	"strings"
 
 	"github.com/QuincyGao/audio-go/formats"
 	"github.com/QuincyGao/audio-go/utils"
@@ -18,6 +20,19 @@ type FileHandle struct {
 	cancel context.CancelFunc
 	cmd    *exec.Cmd
 	stderr *utils.TailBuffer
+	logger *slog.Logger
+	errOut io.Writer
+	// stages codec round trip processes chained before cmd
+	stages []*exec.Cmd
+	links  []*os.File
+	// onProgress receives -progress reports, nil disables them
+	onProgress func(ProgressInfo)
+	// retried set once RetryProbe has rerun the command
+	retried bool
+	// temps AtomicOutput temp file of each output, "" once renamed or when written directly
+	temps []string
+	// fifos named FIFO outputs opened by the engine, by output index
+	fifos []*os.File
 }
 
 func NewFileHandle(cfg formats.AudioConfig) *FileHandle {
@@ -32,23 +47,37 @@ func (f *FileHandle) Init(ctx context.Context) error {
 		return fmt.Errorf("configuration error: %w", err)
 	}
 
-	path, err := exec.LookPath("ffmpeg")
+	path, err := f.config.FFmpeg.LookPath("ffmpeg")
 	if err != nil {
-		return fmt.Errorf("ffmpeg not found")
+		return err
+	}
+	for i := range f.config.InputArgs {
+		if in := f.config.GetInputArg(i); formats.IsSoundDevice(in.AudioFileFormat) {
+			return fmt.Errorf("%s capture never ends on its own, use Stream mode", in.AudioFileFormat)
+		}
 	}
 	if err := f.validateInputFiles(); err != nil {
 		return fmt.Errorf("input file validation failed: %v", err)
 	}
 
 	if err := f.validateOutputFiles(); err != nil {
-		return fmt.Errorf("output file validation failed: %v", err)
+		return fmt.Errorf("output file validation failed: %w", err)
+	}
+	if f.config.AtomicOutput {
+		if err := f.createTemps(); err != nil {
+			return err
+		}
+	}
+	if err := f.openFIFOs(ctx); err != nil {
+		f.removeTemps()
+		return err
 	}
 
 	var args []string
 	switch f.config.OpType {
-	case formats.FORMATCONVERT:
+	case formats.FORMATCONVERT, formats.DEGRADE:
 		args, err = f.buildConvertArgs()
-	case formats.CHANNELSPLIT:
+	case formats.CHANNELSPLIT, formats.FANOUT:
 		args, err = f.buildSplitArgs()
 	case formats.AUDIOMERGE:
 		args, err = f.buildMergeArgs()
@@ -56,38 +85,110 @@ func (f *FileHandle) Init(ctx context.Context) error {
 		return fmt.Errorf("unsupported file opType: %s", f.config.OpType)
 	}
 	if err != nil {
+		f.removeTemps()
+		utils.CloseFiles(f.fifos)
 		return err
 	}
+	if f.onProgress != nil {
+		args = append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+	}
 	f.stderr = &utils.TailBuffer{Limit: 2048}
 
 	f.ctx, f.cancel = context.WithCancel(ctx)
+	f.logger = utils.TraceLogger(f.logger, f.config.TraceID)
+	f.logger.Debug("ffmpeg command", "path", path, "args", args)
+	f.errOut = io.MultiWriter(f.stderr, &utils.LogWriter{Logger: f.logger, Msg: "ffmpeg stderr"})
 	f.cmd = exec.CommandContext(f.ctx, path, args...)
-	f.cmd.Stderr = f.stderr
+	f.cmd.Stderr = f.errOut
+	f.cmd.ExtraFiles = f.extraFiles()
+	if f.onProgress != nil {
+		f.cmd.Stdout = &progressWriter{fn: f.onProgress, info: ProgressInfo{TraceID: f.config.TraceID}}
+	}
 
+	if err := f.setupStages(path); err != nil {
+		f.removeTemps()
+		utils.CloseFiles(f.fifos)
+		return err
+	}
 	return nil
 }
 
-func (f *FileHandle) Run() error {
+// OnProgress registers a callback for conversion progress, call it before Init
+func (f *FileHandle) OnProgress(fn func(ProgressInfo)) {
+	f.onProgress = fn
+}
+
+// setupStages chains codec stages: input file -> stages -> cmd
+func (f *FileHandle) setupStages(path string) (err error) {
+	for _, args := range formats.BuildStagesArgs(&f.config, f.config.InputFiles[0]) {
+		stage := exec.CommandContext(f.ctx, path, args...)
+		f.logger.Debug("ffmpeg stage command", "args", args)
+		stage.Stderr = f.errOut
+		f.stages = append(f.stages, stage)
+	}
+	if len(f.stages) == 0 {
+		return nil
+	}
+	f.links, err = utils.LinkStages(append(f.stages, f.cmd))
+	return err
+}
 
-	return f.cmd.Start()
+func (f *FileHandle) Run() error {
+	defer utils.CloseFiles(f.links)
+	defer utils.CloseFiles(f.fifos)
+	if err := utils.StartStages(append(f.stages, f.cmd)); err != nil {
+		f.removeTemps()
+		return err
+	}
+	f.renice(append(f.stages, f.cmd))
+	f.logger.Debug("ffmpeg started", "pid", f.cmd.Process.Pid)
+	return nil
 }
 
 func (f *FileHandle) Wait() error {
 	err := f.cmd.Wait()
+	if stageErr := utils.WaitStages(f.stages); err == nil {
+		err = stageErr
+	}
+	f.logger.Debug("ffmpeg exited", "err", err)
 	if err != nil {
 		if f.ctx.Err() != nil {
+			f.removeTemps()
 			return f.ctx.Err()
 		}
-		errMsg := f.stderr.String()
-		if errMsg != "" {
-			return fmt.Errorf("ffmpeg exit error: %w, stderr: %s", err, errMsg)
+		err = utils.ExitError(err, f.stderr.String())
+		if f.config.RetryProbe && !f.retried && len(f.stages) == 0 && len(f.cmd.ExtraFiles) == 0 && retryable(err) {
+			f.retried = true
+			if retryErr := f.retry(); retryErr != nil {
+				return err
+			}
+			return f.Wait()
 		}
-		return fmt.Errorf("ffmpeg exit error: %w", err)
+		f.removeTemps()
+		return err
 	}
-	return nil
+	return f.commitTemps()
+}
+
+// ProcessStates exit states of ffmpeg and its stages, valid after Wait
+func (f *FileHandle) ProcessStates() []*os.ProcessState {
+	var states []*os.ProcessState
+	for _, cmd := range append(f.stages, f.cmd) {
+		if cmd != nil {
+			states = append(states, cmd.ProcessState)
+		}
+	}
+	return states
+}
+
+// SetLogger receives the command line, lifecycle events and ffmpeg stderr
+// lines at debug level, call it before Init
+func (f *FileHandle) SetLogger(l *slog.Logger) {
+	f.logger = l
 }
 
 func (f *FileHandle) Done() {
+	utils.Logger(f.logger).Debug("engine done")
 	if f.cancel != nil {
 		f.cancel()
 	}
@@ -99,6 +200,13 @@ func (f *FileHandle) validateInputFiles() error {
 			return fmt.Errorf("input file at index %d is empty", i)
 		}
 
+		if formats.IsNetworkURL(inputFile) {
+			continue
+		}
+		if formats.URLScheme(inputFile) != "" {
+			// remote, Validate checked the scheme against RemoteSchemes
+			continue
+		}
 		if err := f.checkFileReadable(inputFile); err != nil {
 			return fmt.Errorf("input file invalid: %s, error: %v", inputFile, err)
 		}
@@ -113,6 +221,9 @@ func (f *FileHandle) validateOutputFiles() error {
 		if outputFile == "" {
 			return fmt.Errorf("output file at index %d is empty", i)
 		}
+		if f.isDirectOutput(i) {
+			continue
+		}
 		outputDir := filepath.Dir(outputFile)
 
 		if !checkedDirs[outputDir] {
@@ -123,6 +234,13 @@ func (f *FileHandle) validateOutputFiles() error {
 		}
 
 		if f.checkFileExists(outputFile) {
+			switch f.config.OverwritePolicy {
+			case formats.OverwriteFail:
+				return fmt.Errorf("%s: %w", outputFile, utils.ErrOutputExists)
+			case formats.OverwriteAutoRename:
+				f.config.OutputFiles[i] = freeName(outputFile)
+				continue
+			}
 			if err := f.checkFileWritable(outputFile); err != nil {
 				return fmt.Errorf("output file already exists and is not writable: %s, error: %v", outputFile, err)
 			}
@@ -131,6 +249,32 @@ func (f *FileHandle) validateOutputFiles() error {
 	return nil
 }
 
+// overwriteFlag -n keeps ffmpeg from clobbering a file created after
+// validateOutputFiles, temp outputs exist already and need -y
+func (f *FileHandle) overwriteFlag() string {
+	if f.config.OverwritePolicy == formats.OverwriteAlways || f.config.AtomicOutput {
+		return "-y"
+	}
+	return "-n"
+}
+
+// freeName first name-N.ext next to path that does not exist
+func freeName(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, n, ext)
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// OutputFiles the output paths written, AutoRename may have changed them in Init
+func (f *FileHandle) OutputFiles() []string {
+	return f.config.OutputFiles
+}
+
 func (f *FileHandle) checkFileReadable(filePath string) error {
 	info, err := os.Stat(filePath)
 	if err != nil {
@@ -147,9 +291,8 @@ func (f *FileHandle) checkFileReadable(filePath string) error {
 	if info.Size() == 0 {
 		return fmt.Errorf("file is empty")
 	}
-	// linux
-	if sysInfo, ok := info.Sys().(*syscall.Stat_t); ok {
-		if uint32(sysInfo.Mode)&0400 == 0 && uint32(sysInfo.Mode)&0044 == 0 {
+	if mode, ok := modeBits(info); ok {
+		if mode&0400 == 0 && mode&0044 == 0 {
 			return fmt.Errorf("no read permission")
 		}
 	} else {
@@ -184,8 +327,8 @@ func (f *FileHandle) checkDirectoryWritable(dirPath string) error {
 		return fmt.Errorf("is not a directory")
 	}
 
-	if sysInfo, ok := info.Sys().(*syscall.Stat_t); ok {
-		if uint32(sysInfo.Mode)&0200 == 0 && uint32(sysInfo.Mode)&0002 == 0 {
+	if mode, ok := modeBits(info); ok {
+		if mode&0200 == 0 && mode&0002 == 0 {
 			return fmt.Errorf("no write permission")
 		}
 	}
@@ -209,8 +352,8 @@ func (f *FileHandle) checkFileWritable(filePath string) error {
 		return fmt.Errorf("is a directory, not a file")
 	}
 
-	if sysInfo, ok := info.Sys().(*syscall.Stat_t); ok {
-		if uint32(sysInfo.Mode)&0200 == 0 && uint32(sysInfo.Mode)&0002 == 0 {
+	if mode, ok := modeBits(info); ok {
+		if mode&0200 == 0 && mode&0002 == 0 {
 			return fmt.Errorf("no write permission")
 		}
 		return nil
@@ -226,36 +369,43 @@ func (f *FileHandle) checkFileWritable(filePath string) error {
 }
 
 func (f *FileHandle) buildConvertArgs() ([]string, error) {
-	args := []string{"-y"}
-	args = append(args, formats.BuildInputArgs(f.config.GetInputArg(0), f.config.InputFiles[0])...)
-	if custom := f.config.GetFilterString(); custom != "" {
+	args := []string{f.overwriteFlag()}
+	source := f.config.InputFiles[0]
+	if len(f.config.CodecStages()) > 0 {
+		source = "pipe:0"
+	}
+	args = append(args, formats.BuildInputArgs(f.config.MainInputArg(0), source)...)
+	if custom := formats.BuildConvertFilter(&f.config); custom != "" {
 		args = append(args, "-af", custom)
 	}
-	args = append(args, formats.BuildOutputArgs(f.config.GetOutputArg(0), f.config.OutputFiles[0])...)
+	args = append(args, f.config.BuildOutput(0, f.output(0))...)
 	return args, nil
 }
 
 func (f *FileHandle) buildSplitArgs() ([]string, error) {
-	args := []string{"-y"}
+	args := []string{f.overwriteFlag()}
 	args = append(args, formats.BuildInputArgs(f.config.GetInputArg(0), f.config.InputFiles[0])...)
 	fStr, tags := formats.BuildFilterComplex(&f.config)
+	if len(f.config.OutputFiles) != len(tags) {
+		return nil, fmt.Errorf("%s needs %d output files, got %d", f.config.OpType, len(tags), len(f.config.OutputFiles))
+	}
 	args = append(args, "-filter_complex", fStr)
 
-	args = append(args, "-map", tags[0])
-	args = append(args, formats.BuildOutputArgs(f.config.GetOutputArg(0), f.config.OutputFiles[0])...)
-	args = append(args, "-map", tags[1])
-	args = append(args, formats.BuildOutputArgs(f.config.GetOutputArg(1), f.config.OutputFiles[1])...)
+	for i, tag := range tags {
+		args = append(args, "-map", tag)
+		args = append(args, f.config.BuildOutput(i, f.output(i))...)
+	}
 	return args, nil
 }
 
 func (f *FileHandle) buildMergeArgs() ([]string, error) {
-	args := []string{"-y"}
+	args := []string{f.overwriteFlag()}
 	for i, path := range f.config.InputFiles {
 		args = append(args, formats.BuildInputArgs(f.config.GetInputArg(i), path)...)
 	}
 	fStr, tags := formats.BuildFilterComplex(&f.config)
 	args = append(args, "-filter_complex", fStr, "-map", tags[0])
-	args = append(args, formats.BuildOutputArgs(f.config.GetOutputArg(0), f.config.OutputFiles[0])...)
+	args = append(args, f.config.BuildOutput(0, f.output(0))...)
 	return args, nil
 }
 
@@ -268,3 +418,16 @@ func (f *FileHandle) ReadFrom(index int, p []byte) (int, error) {
 }
 
 func (f *FileHandle) CloseInput() {}
+
+func (f *FileHandle) CloseInputAt(index int) error {
+	return fmt.Errorf("CloseInputAt is not supported in File mode")
+}
+
+// renice applies the configured niceness to started cmds, failing to is not fatal
+func (f *FileHandle) renice(cmds []*exec.Cmd) {
+	if nice, ok := f.config.Nice(); ok {
+		if err := utils.Renice(cmds, nice); err != nil {
+			f.logger.Debug("renice ffmpeg", "nice", nice, "err", err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+// openFIFOs opens every named FIFO output once its reader is there, so
+// ffmpeg never blocks in open and a missing reader fails Init when ctx ends
+func (f *FileHandle) openFIFOs(ctx context.Context) error {
+	f.fifos = make([]*os.File, len(f.config.OutputFiles))
+	for i, path := range f.config.OutputFiles {
+		if !utils.IsFIFO(path) {
+			continue
+		}
+		file, err := utils.OpenFIFO(ctx, path)
+		if err != nil {
+			utils.CloseFiles(f.fifos)
+			return err
+		}
+		f.fifos[i] = file
+	}
+	return nil
+}
+
+// fifoTarget pipe:N of output i's FIFO, ExtraFiles keep the output order from fd 3.
+// "" when output i is no FIFO
+func (f *FileHandle) fifoTarget(i int) string {
+	if i >= len(f.fifos) || f.fifos[i] == nil {
+		return ""
+	}
+	fd := 3
+	for _, file := range f.fifos[:i] {
+		if file != nil {
+			fd++
+		}
+	}
+	return fmt.Sprintf("pipe:%d", fd)
+}
+
+// extraFiles opened FIFOs in fd order
+func (f *FileHandle) extraFiles() []*os.File {
+	var files []*os.File
+	for _, file := range f.fifos {
+		if file != nil {
+			files = append(files, file)
+		}
+	}
+	return files
+}
@@ -0,0 +1,87 @@
+//go:build !windows
+
+package file
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+func TestFIFORoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	fifos := []string{filepath.Join(dir, "a.fifo"), filepath.Join(dir, "b.fifo")}
+	for _, path := range fifos {
+		if err := syscall.Mkfifo(path, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if !utils.IsFIFO(path) {
+			t.Fatalf("IsFIFO(%s) = false", path)
+		}
+	}
+	// the reading daemon, each FIFO read to EOF
+	got := make([]chan string, len(fifos))
+	for i, path := range fifos {
+		got[i] = make(chan string, 1)
+		go func() {
+			r, err := os.Open(path)
+			if err != nil {
+				got[i] <- err.Error()
+				return
+			}
+			defer r.Close()
+			data, _ := io.ReadAll(r)
+			got[i] <- string(data)
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	f := NewFileHandle(formats.AudioConfig{OutputFiles: []string{filepath.Join(dir, "out.wav"), fifos[0], fifos[1]}})
+	if err := f.openFIFOs(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if f.fifoTarget(0) != "" || f.fifoTarget(1) != "pipe:3" || f.fifoTarget(2) != "pipe:4" {
+		t.Fatalf("targets = %q %q %q, want \"\" pipe:3 pipe:4", f.fifoTarget(0), f.fifoTarget(1), f.fifoTarget(2))
+	}
+	// a child writing pipe:N as ffmpeg would
+	cmd := exec.Command("sh", "-c", "printf first >&3; printf second >&4")
+	cmd.ExtraFiles = f.extraFiles()
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	utils.CloseFiles(f.fifos)
+	for i, want := range []string{"first", "second"} {
+		select {
+		case data := <-got[i]:
+			if data != want {
+				t.Errorf("FIFO %d read %q, want %q", i, data, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("FIFO %d not read", i)
+		}
+	}
+}
+
+func TestFIFONoReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.fifo")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+	f := NewFileHandle(formats.AudioConfig{OutputFiles: []string{path}})
+	err := f.openFIFOs(ctx)
+	if err == nil || !strings.Contains(err.Error(), "has no reader") {
+		t.Fatalf("openFIFOs = %v, want a missing reader error", err)
+	}
+}
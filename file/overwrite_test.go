@@ -0,0 +1,37 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+func TestOverwritePolicy(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "call.wav")
+	for _, p := range []string{existing, filepath.Join(dir, "call-1.wav")} {
+		if err := os.WriteFile(p, []byte("RIFF"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := NewFileHandle(formats.AudioConfig{OutputFiles: []string{existing}, OverwritePolicy: formats.OverwriteFail})
+	if err := f.validateOutputFiles(); !errors.Is(err, utils.ErrOutputExists) {
+		t.Errorf("OverwriteFail: got %v, want ErrOutputExists", err)
+	}
+	if f.overwriteFlag() != "-n" {
+		t.Errorf("OverwriteFail passes %s", f.overwriteFlag())
+	}
+
+	f = NewFileHandle(formats.AudioConfig{OutputFiles: []string{existing}, OverwritePolicy: formats.OverwriteAutoRename})
+	if err := f.validateOutputFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.OutputFiles()[0]; got != filepath.Join(dir, "call-2.wav") {
+		t.Errorf("OverwriteAutoRename picked %s", got)
+	}
+}
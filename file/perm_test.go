@@ -0,0 +1,52 @@
+//go:build !windows
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+func TestModeBits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "in.wav")
+	if err := os.WriteFile(path, []byte("RIFF"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode, ok := modeBits(info); !ok || mode&0777 != 0640 {
+		t.Errorf("modeBits = %o, %v, want 640", mode&0777, ok)
+	}
+
+	// the checks go by the permission bits, also when running as root
+	f := NewFileHandle(formats.AudioConfig{})
+	if err := f.checkFileReadable(path); err != nil {
+		t.Errorf("readable file rejected: %v", err)
+	}
+	os.Chmod(path, 0200)
+	if err := f.checkFileReadable(path); err == nil || !strings.Contains(err.Error(), "no read permission") {
+		t.Errorf("write-only file = %v, want no read permission", err)
+	}
+	os.Chmod(path, 0444)
+	if err := f.checkFileWritable(path); err == nil || !strings.Contains(err.Error(), "no write permission") {
+		t.Errorf("read-only file = %v, want no write permission", err)
+	}
+	ro := filepath.Join(dir, "ro")
+	if err := os.Mkdir(ro, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(ro, 0755)
+	if err := f.checkDirectoryWritable(ro); err == nil || !strings.Contains(err.Error(), "no write permission") {
+		t.Errorf("read-only dir = %v, want no write permission", err)
+	}
+}
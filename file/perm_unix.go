@@ -0,0 +1,16 @@
+//go:build !windows
+
+package file
+
+import (
+	"os"
+	"syscall"
+)
+
+// modeBits permission bits from the raw stat, ok is false when unavailable
+func modeBits(info os.FileInfo) (uint32, bool) {
+	if sysInfo, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint32(sysInfo.Mode), true
+	}
+	return 0, false
+}
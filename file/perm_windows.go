@@ -0,0 +1,10 @@
+//go:build windows
+
+package file
+
+import "os"
+
+// modeBits windows has no unix permission bits, callers fall back to opening the file
+func modeBits(os.FileInfo) (uint32, bool) {
+	return 0, false
+}
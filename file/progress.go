@@ -0,0 +1,67 @@
+package file
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProgressInfo a snapshot of ffmpeg -progress output
+type ProgressInfo struct {
+	// OutTime position of the output written so far
+	OutTime time.Duration
+	// TotalSize bytes written to the output so far
+	TotalSize int64
+	// Speed relative to realtime, e.g. 12.5 for "12.5x", 0 when unknown
+	Speed float64
+	// Done set on the final report
+	Done bool
+	// TraceID of the config
+	TraceID string
+}
+
+// progressWriter parses "key=value" lines of -progress pipe:1,
+// every block ends with a progress=continue|end line
+type progressWriter struct {
+	fn      func(ProgressInfo)
+	partial []byte
+	info    ProgressInfo
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.parseLine(string(bytes.TrimSpace(w.partial[:i])))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *progressWriter) parseLine(line string) {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return
+	}
+	switch key {
+	case "out_time_us":
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+			w.info.OutTime = time.Duration(us) * time.Microsecond
+		}
+	case "total_size":
+		if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+			w.info.TotalSize = size
+		}
+	case "speed":
+		if speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "x"), 64); err == nil {
+			w.info.Speed = speed
+		}
+	case "progress":
+		w.info.Done = value == "end"
+		w.fn(w.info)
+	}
+}
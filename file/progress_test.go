@@ -0,0 +1,28 @@
+package file
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressWriter(t *testing.T) {
+	var got []ProgressInfo
+	w := &progressWriter{fn: func(p ProgressInfo) { got = append(got, p) }}
+
+	w.Write([]byte("total_size=1024\nout_time_us=1500000\nspe"))
+	w.Write([]byte("ed=12.5x\nprogress=continue\n"))
+	w.Write([]byte("total_size=4096\nout_time_us=3000000\nspeed=N/A\nprogress=end\n"))
+
+	want := []ProgressInfo{
+		{OutTime: 1500 * time.Millisecond, TotalSize: 1024, Speed: 12.5},
+		{OutTime: 3 * time.Second, TotalSize: 4096, Speed: 12.5, Done: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d reports, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("report %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
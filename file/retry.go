@@ -0,0 +1,49 @@
+package file
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+// retryable failures a deeper probe or format detection can fix
+func retryable(err error) bool {
+	return errors.Is(err, utils.ErrInvalidData) || errors.Is(err, utils.ErrUnknownFormat)
+}
+
+// relaxInputArgs adds a large probe to every input and drops the -f of
+// encoded inputs, raw PCM keeps it since it can not be detected. It works on
+// the built args since every -f followed by -i belongs to an input
+func relaxInputArgs(args []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-f" && i+3 < len(args) && args[i+2] == "-i" {
+			out = append(out, "-probesize", "50000000", "-analyzeduration", "100000000")
+			if formats.SampleBytes(formats.AudioFileFormat(args[i+1])) > 0 {
+				out = append(out, args[i], args[i+1])
+			}
+			i++
+			continue
+		}
+		out = append(out, args[i])
+	}
+	return out
+}
+
+// retry reruns the main command with relaxed input args
+func (f *FileHandle) retry() error {
+	args := relaxInputArgs(f.cmd.Args[1:])
+	f.logger.Debug("ffmpeg retry", "args", args)
+	f.stderr.Reset()
+	stdout := f.cmd.Stdout
+	f.cmd = exec.CommandContext(f.ctx, f.cmd.Path, args...)
+	f.cmd.Stderr = f.errOut
+	f.cmd.Stdout = stdout
+	if err := f.cmd.Start(); err != nil {
+		return err
+	}
+	f.renice([]*exec.Cmd{f.cmd})
+	return nil
+}
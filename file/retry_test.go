@@ -0,0 +1,16 @@
+package file
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRelaxInputArgs(t *testing.T) {
+	args := strings.Fields("-y -f mp3 -i a.mp3 -ar 8000 -ac 1 -f s16le -i b.pcm -filter_complex x -map [out] -ar 8000 -ac 1 -f wav out.wav")
+	got := strings.Join(relaxInputArgs(args), " ")
+	want := "-y -probesize 50000000 -analyzeduration 100000000 -i a.mp3 -ar 8000 -ac 1 " +
+		"-probesize 50000000 -analyzeduration 100000000 -f s16le -i b.pcm -filter_complex x -map [out] -ar 8000 -ac 1 -f wav out.wav"
+	if got != want {
+		t.Errorf("relaxInputArgs =\n%q\nwant\n%q", got, want)
+	}
+}
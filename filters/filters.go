@@ -0,0 +1,219 @@
+// Package filters typed ffmpeg audio filter nodes. A Chain validates every
+// node and renders numbers itself, so the result is safe for -af,
+// -filter_complex or AudioConfig.Filters without hand written filter syntax
+package filters
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// Node one audio filter
+type Node interface {
+	// Name ffmpeg filter name
+	Name() string
+	// Validate checks the parameters against the filter's ranges
+	Validate() error
+	// args rendered option list without the name
+	args() string
+}
+
+// Volume gain in dB, negative attenuates
+type Volume struct {
+	DB float64
+}
+
+func (Volume) Name() string { return "volume" }
+
+func (v Volume) Validate() error {
+	return between("volume DB", v.DB, -100, 60)
+}
+
+func (v Volume) args() string {
+	return "volume=" + num(v.DB) + "dB"
+}
+
+// Atempo changes speed without changing pitch, ffmpeg accepts 0.5 to 100
+type Atempo struct {
+	Factor float64
+}
+
+func (Atempo) Name() string { return "atempo" }
+
+func (a Atempo) Validate() error {
+	return between("atempo Factor", a.Factor, 0.5, 100)
+}
+
+func (a Atempo) args() string {
+	return "tempo=" + num(a.Factor)
+}
+
+// Loudnorm EBU R128 loudness normalization
+type Loudnorm struct {
+	// I integrated target, -70 to -5 LUFS
+	I float64
+	// TP maximum true peak, -9 to 0 dBTP
+	TP float64
+	// LRA loudness range target, 1 to 50 LU
+	LRA float64
+}
+
+func (Loudnorm) Name() string { return "loudnorm" }
+
+func (l Loudnorm) Validate() error {
+	if err := between("loudnorm I", l.I, -70, -5); err != nil {
+		return err
+	}
+	if err := between("loudnorm TP", l.TP, -9, 0); err != nil {
+		return err
+	}
+	return between("loudnorm LRA", l.LRA, 1, 50)
+}
+
+func (l Loudnorm) args() string {
+	return "I=" + num(l.I) + ":TP=" + num(l.TP) + ":LRA=" + num(l.LRA)
+}
+
+// Afftdn FFT denoiser
+type Afftdn struct {
+	// NR noise reduction, 0.01 to 97 dB
+	NR float64
+	// NF noise floor, -80 to -20 dB
+	NF float64
+}
+
+func (Afftdn) Name() string { return "afftdn" }
+
+func (a Afftdn) Validate() error {
+	if err := between("afftdn NR", a.NR, 0.01, 97); err != nil {
+		return err
+	}
+	return between("afftdn NF", a.NF, -80, -20)
+}
+
+func (a Afftdn) args() string {
+	return "nr=" + num(a.NR) + ":nf=" + num(a.NF)
+}
+
+// Highpass cuts below Frequency Hz
+type Highpass struct {
+	Frequency float64
+}
+
+func (Highpass) Name() string { return "highpass" }
+
+func (h Highpass) Validate() error {
+	return between("highpass Frequency", h.Frequency, 1, 999999)
+}
+
+func (h Highpass) args() string {
+	return "f=" + num(h.Frequency)
+}
+
+// Lowpass cuts above Frequency Hz
+type Lowpass struct {
+	Frequency float64
+}
+
+func (Lowpass) Name() string { return "lowpass" }
+
+func (l Lowpass) Validate() error {
+	return between("lowpass Frequency", l.Frequency, 1, 999999)
+}
+
+func (l Lowpass) args() string {
+	return "f=" + num(l.Frequency)
+}
+
+// Aresample resamples to SampleRate Hz
+type Aresample struct {
+	SampleRate int
+}
+
+func (Aresample) Name() string { return "aresample" }
+
+func (a Aresample) Validate() error {
+	if a.SampleRate <= 0 {
+		return fmt.Errorf("invalid aresample SampleRate: %d", a.SampleRate)
+	}
+	return nil
+}
+
+func (a Aresample) args() string {
+	return strconv.Itoa(a.SampleRate)
+}
+
+// Chain nodes applied in order
+type Chain []Node
+
+// Validate every node, the error names the failing position
+func (c Chain) Validate() error {
+	if len(c) == 0 {
+		return fmt.Errorf("empty filter chain")
+	}
+	for i, n := range c {
+		if n == nil {
+			return fmt.Errorf("filter chain[%d]: nil node", i)
+		}
+		if err := n.Validate(); err != nil {
+			return fmt.Errorf("filter chain[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Render validated chain for -af or AudioConfig.Filters
+func (c Chain) Render() (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+	parts := make([]string, len(c))
+	for i, n := range c {
+		parts[i] = n.Name() + "=" + n.args()
+	}
+	return strings.Join(parts, ","), nil
+}
+
+var labelPattern = regexp.MustCompile(`^[A-Za-z0-9_:]+$`)
+
+// RenderComplex validated chain as one -filter_complex graph from pad in to
+// pad out, e.g. "[0:a]volume=volume=-3dB[out]"
+func (c Chain) RenderComplex(in, out string) (string, error) {
+	for _, label := range []string{in, out} {
+		if !labelPattern.MatchString(label) {
+			return "", fmt.Errorf("invalid filter pad label: %q", label)
+		}
+	}
+	chain, err := c.Render()
+	if err != nil {
+		return "", err
+	}
+	return "[" + in + "]" + chain + "[" + out + "]", nil
+}
+
+// Apply appends the rendered chain to config.Filters
+func (c Chain) Apply(config *formats.AudioConfig) error {
+	chain, err := c.Render()
+	if err != nil {
+		return err
+	}
+	config.Filters = append(config.Filters, chain)
+	return nil
+}
+
+// between rejects NaN, infinities and values outside [lo, hi]
+func between(field string, v, lo, hi float64) error {
+	if math.IsNaN(v) || v < lo || v > hi {
+		return fmt.Errorf("invalid %s: %s, must be %s to %s", field, num(v), num(lo), num(hi))
+	}
+	return nil
+}
+
+func num(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,59 @@
+package filters
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+func TestChain(t *testing.T) {
+	chain := Chain{
+		Highpass{Frequency: 80},
+		Afftdn{NR: 12, NF: -40},
+		Volume{DB: -3.5},
+		Atempo{Factor: 1.25},
+		Loudnorm{I: -16, TP: -1.5, LRA: 11},
+		Aresample{SampleRate: 16000},
+	}
+	got, err := chain.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "highpass=f=80,afftdn=nr=12:nf=-40,volume=volume=-3.5dB,atempo=tempo=1.25," +
+		"loudnorm=I=-16:TP=-1.5:LRA=11,aresample=16000"
+	if got != want {
+		t.Fatalf("Render = %q, want %q", got, want)
+	}
+
+	complex, err := Chain{Lowpass{Frequency: 3400}}.RenderComplex("0:a", "out")
+	if err != nil || complex != "[0:a]lowpass=f=3400[out]" {
+		t.Fatalf("RenderComplex = %q, %v", complex, err)
+	}
+	if _, err := (Chain{Lowpass{Frequency: 3400}}).RenderComplex("0:a];[x", "out"); err == nil {
+		t.Fatal("expected label injection to be rejected")
+	}
+
+	for _, bad := range []Chain{
+		nil,
+		{nil},
+		{Atempo{Factor: 0.25}},
+		{Volume{DB: math.NaN()}},
+		{Loudnorm{I: -16, TP: 1, LRA: 11}},
+		{Afftdn{NR: 0, NF: -40}},
+		{Aresample{}},
+	} {
+		if _, err := bad.Render(); err == nil {
+			t.Errorf("%v: expected error", bad)
+		}
+	}
+
+	var cfg formats.AudioConfig
+	if err := (Chain{Atempo{Factor: 2}}).Apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Filters) != 1 || !strings.HasPrefix(cfg.Filters[0], "atempo=") {
+		t.Fatalf("Filters = %v", cfg.Filters)
+	}
+}
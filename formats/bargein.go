@@ -0,0 +1,37 @@
+package formats
+
+import (
+	"fmt"
+	"time"
+)
+
+// BargeIn detects callers talking over a prompt in Stream mode input 0, which must be S16LE, S24LE, F32LE or F64LE
+type BargeIn struct {
+	// ThresholdDB chunk RMS in dBFS that counts as talking, nil takes -30.
+	// A pointer so 0 dBFS, full scale, can be set
+	ThresholdDB *float64
+	// MinDuration talking must last this long before the event fires, default 40ms
+	MinDuration time.Duration
+	// StopPrompt drops the rest of an injected clip when barge-in fires
+	StopPrompt bool
+}
+
+func (b *BargeIn) setDefaults() {
+	if b.ThresholdDB == nil {
+		threshold := -30.0
+		b.ThresholdDB = &threshold
+	}
+	if b.MinDuration <= 0 {
+		b.MinDuration = 40 * time.Millisecond
+	}
+}
+
+func (b *BargeIn) validate(input AudioArgs) error {
+	if !meterable(input.AudioFileFormat) {
+		return fmt.Errorf("BargeIn: InputArgs[0] must be s16le, s24le, f32le or f64le, got %s", input.AudioFileFormat)
+	}
+	if b.ThresholdDB != nil && *b.ThresholdDB > 0 {
+		return fmt.Errorf("BargeIn: ThresholdDB must be <= 0, got %v", *b.ThresholdDB)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package formats
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// FFmpegOptions binary discovery, the zero value looks the binary up in PATH
+type FFmpegOptions struct {
+	// Path explicit ffmpeg binary, skips discovery. ffprobe is looked up next
+	// to it first
+	Path string
+	// SearchPaths extra directories tried before PATH
+	SearchPaths []string
+	// Always runs ffmpeg even for Stream conversions the pure-Go path can do,
+	// e.g. to Inject into a plain s16le stream
+	Always bool
+	// Nice niceness of ffmpeg and its stages, -20 to 19. nil takes the
+	// SetDefaultNice value of the OpType, if any
+	Nice *int
+}
+
+// LookPath resolves name ("ffmpeg", "ffprobe") in order: Path (for
+// ffprobe its directory), the AUDIOGO_<NAME> environment variable,
+// SearchPaths, PATH
+func (o FFmpegOptions) LookPath(name string) (string, error) {
+	if o.Path != "" {
+		if name == "ffmpeg" {
+			return exec.LookPath(o.Path)
+		}
+		if dir := filepath.Dir(o.Path); dir != "." {
+			if path, err := exec.LookPath(filepath.Join(dir, name)); err == nil {
+				return path, nil
+			}
+		}
+	}
+	if env := os.Getenv("AUDIOGO_" + strings.ToUpper(name)); env != "" {
+		return exec.LookPath(env)
+	}
+	for _, dir := range o.SearchPaths {
+		if path, err := exec.LookPath(filepath.Join(dir, name)); err == nil {
+			return path, nil
+		}
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%s not found", name)
+	}
+	return path, nil
+}
@@ -0,0 +1,50 @@
+package formats
+
+import "fmt"
+
+// OverflowPolicy what an output buffer does when the reader falls behind
+type OverflowPolicy string
+
+const (
+	// OverflowBlock stops reading ffmpeg until there is room, the default
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDrop discards whole frames that do not fit, raw PCM outputs only
+	OverflowDrop OverflowPolicy = "drop"
+	// OverflowGrow doubles the ring instead, memory is bounded only by how far
+	// the reader falls behind. The CHANNELSPLIT and FANOUT default, so outputs
+	// can be read one after another
+	OverflowGrow OverflowPolicy = "grow"
+)
+
+// OutputBuffer decouples Stream mode outputs from their readers: a pump per
+// output drains ffmpeg into a ring buffer, so a slow reader does not stall ffmpeg
+type OutputBuffer struct {
+	// Size initial ring capacity in bytes per output, rounded up to a power of two, default 64 KiB
+	Size int
+	// Overflow policy when the ring is full, default OverflowBlock
+	Overflow OverflowPolicy
+}
+
+func (b *OutputBuffer) setDefaults() {
+	if b.Size <= 0 {
+		b.Size = 64 << 10
+	}
+	if b.Overflow == "" {
+		b.Overflow = OverflowBlock
+	}
+}
+
+func (b *OutputBuffer) validate(c *AudioConfig) error {
+	switch b.Overflow {
+	case OverflowBlock, OverflowGrow:
+	case OverflowDrop:
+		for i := range c.OutputArgs {
+			if f := c.GetOutputArg(i).AudioFileFormat; SampleBytes(f) == 0 {
+				return fmt.Errorf("OutputBuffer: OverflowDrop needs raw PCM outputs, OutputArgs[%d] is %s", i, f)
+			}
+		}
+	default:
+		return fmt.Errorf("OutputBuffer: unknown Overflow %q", b.Overflow)
+	}
+	return nil
+}
@@ -2,65 +2,187 @@ package formats
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
-// BuildInputArgs: -ar, -ac, -f, -i
+// BuildInputArgs: -ar, -ac, -channel_layout, input hook, -f, -i
 func BuildInputArgs(arg AudioArgs, source string) []string {
+	switch {
+	case IsRTP(source):
+		// the payload type of every packet names the codec
+		return []string{"-protocol_whitelist", protocolWhitelist(source), "-f", "rtp", "-i", source}
+	case IsSDP(source):
+		return []string{"-protocol_whitelist", "file,udp,rtp", "-f", "sdp", "-i", source}
+	}
 	var args []string
-	if IsRawPCM(arg.AudioFileFormat) {
+	if IsRawPCM(arg.AudioFileFormat) || IsSoundDevice(arg.AudioFileFormat) {
 		args = append(args, "-ar", fmt.Sprintf("%d", arg.SampleRate), "-ac", fmt.Sprintf("%d", arg.Channels))
+		if arg.ChannelLayout != "" {
+			args = append(args, "-channel_layout", string(arg.ChannelLayout))
+		}
 	}
 	// pipe
 	if strings.HasPrefix(source, "pipe:") {
 		args = append(args, "-thread_queue_size", "1024")
 	}
-	args = append(args, "-f", string(arg.AudioFileFormat), "-i", source)
+	if wl := protocolWhitelist(source); wl != "" {
+		args = append(args, "-protocol_whitelist", wl)
+	}
+	args = append(args, runHook(inputHooks, arg)...)
+	args = append(args, "-f", arg.muxer(), "-i", source)
 	return args
 }
 
-// BuildOutputArgs: -ar, -ac, -f, target
+// BuildOutputArgs: -ar, -ac, -channel_layout, codec options, output hook, -f, target
 func BuildOutputArgs(arg AudioArgs, target string) []string {
-	return []string{
+	args := []string{
 		"-ar", fmt.Sprintf("%d", arg.SampleRate),
 		"-ac", fmt.Sprintf("%d", arg.Channels),
-		"-f", string(arg.AudioFileFormat),
-		target,
 	}
+	if arg.ChannelLayout != "" {
+		args = append(args, "-channel_layout", string(arg.ChannelLayout))
+	}
+	enc, muxer := arg.encoder(), arg.muxer()
+	switch {
+	case IsRTP(target):
+		var pt int
+		enc, pt = rtpPayload(arg)
+		muxer = "rtp"
+		args = append(args, "-payload_type", fmt.Sprintf("%d", pt))
+	case isRTMP(target):
+		muxer = "flv"
+	}
+	if enc != "" {
+		args = append(args, "-c:a", enc)
+	}
+	if arg.VBR {
+		args = append(args, "-q:a", fmt.Sprintf("%d", arg.Quality))
+	} else if arg.Bitrate > 0 {
+		args = append(args, "-b:a", fmt.Sprintf("%d", arg.Bitrate))
+	}
+	if arg.SeekableOutput() {
+		// moov atom up front so the file can be played while downloading
+		args = append(args, "-movflags", "+faststart")
+	}
+	if arg.AudioFileFormat == FLAC && arg.CompressionLevel > 0 {
+		args = append(args, "-compression_level", fmt.Sprintf("%d", arg.CompressionLevel))
+	}
+	args = append(args, runHook(outputHooks, arg)...)
+	return append(args, "-f", muxer, target)
+}
+
+// BuildOutput output args of output i to target, BuildOutputArgs plus the
+// options of the config that depend on the output, e.g. HLS, SDPFile or Reconnect
+func (c *AudioConfig) BuildOutput(i int, target string) []string {
+	arg := c.GetOutputArg(i)
+	args := BuildOutputArgs(arg, target)
+	if IsRTP(target) && c.SDPFile != "" {
+		// a global option, receivers of dynamic payload types need the SDP
+		args = append([]string{"-sdp_file", c.SDPFile}, args...)
+	}
+	if IsPushURL(target) {
+		return pushArgs(args, arg, target, c.Reconnect)
+	}
+	if arg.AudioFileFormat != HLS {
+		return args
+	}
+	hls := HLSOptions{}
+	if c.HLS != nil {
+		hls = *c.HLS
+	}
+	hls.setDefaults()
+	// muxer options go before "-f hls target"
+	n := len(args) - 3
+	return slices.Concat(args[:n], hls.args(), args[n:])
+}
+
+// BuildConvertFilter -af chain of single input ops:
+// InputArgs[0] Gain and Filter, config filters, OutputArgs[0] Gain and Filter
+func BuildConvertFilter(cfg *AudioConfig) string {
+	return joinFilters(cfg.GetInputArg(0).streamFilter(), cfg.GetFilterString(), cfg.GetOutputArg(0).streamFilter())
+}
+
+func joinFilters(parts ...string) string {
+	var filters []string
+	for _, p := range parts {
+		if p != "" {
+			filters = append(filters, p)
+		}
+	}
+	return strings.Join(filters, ",")
 }
 
-// BuildFilterComplex handle Split 和 Merge filter
+// BuildFilterComplex handle Split, FanOut 和 Merge filter.
+// Input Filters run before the split/merge, config filters and output Filters after it
 func BuildFilterComplex(cfg *AudioConfig) (filterStr string, mapTags []string) {
 	custom := cfg.GetFilterString()
 	targetOut := cfg.GetOutputArg(0)
 
 	switch cfg.OpType {
 	case CHANNELSPLIT:
-		// [0:a] -> [l][r]; -> [left][right]
-		leftF := "anull"
-		if custom != "" {
-			leftF = custom
+		// [0:a] -> [c0][c1]...; -> [out0][out1]...
+		inArg := cfg.GetInputArg(0)
+		channels := inArg.Channels
+		var split, chains strings.Builder
+		for i := range channels {
+			chF := joinFilters(custom, cfg.GetOutputArg(i).streamFilter())
+			if chF == "" {
+				chF = "anull"
+			}
+			fmt.Fprintf(&split, "[c%d]", i)
+			fmt.Fprintf(&chains, "; [c%d]%s[out%d]", i, chF, i)
+			mapTags = append(mapTags, fmt.Sprintf("[out%d]", i))
 		}
-		rightF := "anull"
-		if custom != "" {
-			rightF = custom
+		head := "[0:a]"
+		if inF := inArg.streamFilter(); inF != "" {
+			head += inF + ","
 		}
-		filterStr = fmt.Sprintf("[0:a]channelsplit=channel_layout=stereo[l][r]; [l]%s[left]; [r]%s[right]", leftF, rightF)
-		mapTags = []string{"[left]", "[right]"}
+		filterStr = fmt.Sprintf("%schannelsplit=channel_layout=%s%s%s", head, inArg.Layout(), split.String(), chains.String())
+
+	case FANOUT:
+		// [0:a] -> shared filters -> asplit -> [s0][s1]...; -> [out0][out1]...
+		count := len(cfg.OutputArgs)
+		var split, chains strings.Builder
+		for i := range count {
+			outF := cfg.GetOutputArg(i).streamFilter()
+			if outF == "" {
+				outF = "anull"
+			}
+			fmt.Fprintf(&split, "[s%d]", i)
+			fmt.Fprintf(&chains, "; [s%d]%s[out%d]", i, outF, i)
+			mapTags = append(mapTags, fmt.Sprintf("[out%d]", i))
+		}
+		head := joinFilters(cfg.GetInputArg(0).streamFilter(), custom)
+		if head != "" {
+			head += ","
+		}
+		filterStr = fmt.Sprintf("[0:a]%sasplit=%d%s%s", head, count, split.String(), chains.String())
 
 	case AUDIOMERGE:
+		count := cfg.MergeInputCount()
+		var pre, inputs strings.Builder
+		for i := range count {
+			if inF := cfg.GetInputArg(i).streamFilter(); inF != "" {
+				fmt.Fprintf(&pre, "[%d:a]%s[in%d]; ", i, inF, i)
+				fmt.Fprintf(&inputs, "[in%d]", i)
+				continue
+			}
+			fmt.Fprintf(&inputs, "[%d:a]", i)
+		}
 		var mergePart string
 		if cfg.MergeMode == SideBySide {
-			mergePart = "[0:a][1:a]join=inputs=2:channel_layout=stereo"
+			mergePart = fmt.Sprintf("%sjoin=inputs=%d:channel_layout=%s", inputs.String(), count, channelLayouts[count])
 		} else {
-			mergePart = "[0:a][1:a]amix=inputs=2:duration=longest"
+			mergePart = fmt.Sprintf("%samix=inputs=%d:duration=longest", inputs.String(), count)
 			if targetOut.Channels == 2 {
 				mergePart += ",pan=stereo|c0=c0|c1=c0"
 			}
 		}
+		mergePart = pre.String() + mergePart
 		// custom filter
-		if custom != "" {
-			filterStr = fmt.Sprintf("%s[tmp]; [tmp]%s[finalout]", mergePart, custom)
+		if post := joinFilters(custom, targetOut.streamFilter()); post != "" {
+			filterStr = fmt.Sprintf("%s[tmp]; [tmp]%s[finalout]", mergePart, post)
 			mapTags = []string{"[finalout]"}
 		} else {
 			filterStr = mergePart + "[out]"
@@ -0,0 +1,64 @@
+package formats
+
+// FormatInfo describes an AudioFileFormat for clients building their own validation
+type FormatInfo struct {
+	Name AudioFileFormat `json:"name"`
+	// Raw headerless PCM, SampleRate and Channels must be given for inputs
+	Raw bool `json:"raw"`
+	// SampleRate the only rate the format accepts, 0 means any
+	SampleRate int `json:"sample_rate,omitempty"`
+	// Channels the only channel count the format accepts, 0 means any
+	Channels int `json:"channels,omitempty"`
+	// FileOnly output needs a seekable file, not usable in Stream mode
+	FileOnly bool `json:"file_only,omitempty"`
+	// Device sound card capture (input, Stream mode) or playback (output)
+	Device bool `json:"device,omitempty"`
+}
+
+// OpInfo describes an OpType
+type OpInfo struct {
+	Name        OpType `json:"name"`
+	Description string `json:"description"`
+	Stream      bool   `json:"stream"`
+	File        bool   `json:"file"`
+	MinInputs   int    `json:"min_inputs"`
+	// MaxInputs 0 means no limit
+	MaxInputs  int `json:"max_inputs"`
+	MinOutputs int `json:"min_outputs"`
+	MaxOutputs int `json:"max_outputs"`
+}
+
+var allFormats = []AudioFileFormat{
+	ALAW, F32BE, F32LE, F64BE, F64LE, MULAW,
+	S16BE, S16LE, S24BE, S24LE, S32BE, S32LE, S8,
+	U16BE, U16LE, U24BE, U24LE, U32BE, U32LE, U8,
+	WAV, MP3, G722, G729, OPUS, AAC, GSM, FLAC, AMRNB, AMRWB, M4A, ADPCMIMA, ADPCMMS, OGG,
+	ALSA, PULSE, HLS,
+}
+
+var allOps = []OpInfo{
+	{Name: FORMATCONVERT, Description: "convert format, sample rate and channels", Stream: true, File: true, MinInputs: 1, MaxInputs: 1, MinOutputs: 1, MaxOutputs: 1},
+	{Name: CHANNELSPLIT, Description: "split every channel into a mono output", Stream: true, File: true, MinInputs: 1, MaxInputs: 1, MinOutputs: 2, MaxOutputs: len(channelLayouts)},
+	{Name: AUDIOMERGE, Description: "mix or join inputs into one output", Stream: true, File: true, MinInputs: 2, MaxInputs: 0, MinOutputs: 1, MaxOutputs: 1},
+	{Name: VADSEGMENT, Description: "emit speech segments of a live stream", Stream: true, File: false, MinInputs: 1, MaxInputs: 1, MinOutputs: 1, MaxOutputs: 1},
+	{Name: DEGRADE, Description: "round trip through a lossy codec N times", Stream: true, File: true, MinInputs: 1, MaxInputs: 1, MinOutputs: 1, MaxOutputs: 1},
+	{Name: FANOUT, Description: "convert one input into several outputs, e.g. stereo plus a mono downmix", Stream: true, File: true, MinInputs: 1, MaxInputs: 1, MinOutputs: 2, MaxOutputs: 0},
+}
+
+// Formats lists every supported AudioFileFormat
+func Formats() []FormatInfo {
+	infos := make([]FormatInfo, 0, len(allFormats))
+	for _, f := range allFormats {
+		c := formatConstraints[f]
+		info := FormatInfo{Name: f, Raw: IsRawPCM(f), SampleRate: c.sampleRate, Channels: c.channels, FileOnly: f.SeekableOutput(), Device: IsSoundDevice(f)}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Ops lists every supported OpType
+func Ops() []OpInfo {
+	ops := make([]OpInfo, len(allOps))
+	copy(ops, allOps)
+	return ops
+}
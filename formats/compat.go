@@ -0,0 +1,58 @@
+package formats
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mismatch one setting where an output differs from the input it feeds
+type Mismatch struct {
+	Field  string
+	Output string
+	Input  string
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s: output produces %s, input expects %s, set the output %s to %s",
+		m.Field, m.Output, m.Input, m.Field, m.Input)
+}
+
+// CompatError every Mismatch Compatible found
+type CompatError []Mismatch
+
+func (e CompatError) Error() string {
+	parts := make([]string, len(e))
+	for i, m := range e {
+		parts[i] = m.String()
+	}
+	return "incompatible pipeline: " + strings.Join(parts, "; ")
+}
+
+// Compatible checks that out, one engine's output args, can feed in, the
+// next engine's input args, as a CompatError listing every difference. Raw
+// PCM carries no header, so its rate and channels must match exactly, an
+// encoded input is only checked for values it sets. Pass out after
+// SetDefaults, and in as configured, defaulted only when it is raw PCM
+func Compatible(out, in AudioArgs) error {
+	var diffs CompatError
+	add := func(field string, o, i any) {
+		diffs = append(diffs, Mismatch{Field: field, Output: fmt.Sprint(o), Input: fmt.Sprint(i)})
+	}
+	if out.AudioFileFormat != in.AudioFileFormat {
+		add("AudioFileFormat", out.AudioFileFormat, in.AudioFileFormat)
+	}
+	raw := IsRawPCM(in.AudioFileFormat)
+	if (raw || in.SampleRate != 0) && out.SampleRate != in.SampleRate {
+		add("SampleRate", out.SampleRate, in.SampleRate)
+	}
+	if (raw || in.Channels != 0) && out.Channels != in.Channels {
+		add("Channels", out.Channels, in.Channels)
+	}
+	if in.ChannelLayout != "" && out.ChannelLayout != in.ChannelLayout {
+		add("ChannelLayout", out.ChannelLayout, in.ChannelLayout)
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+	return diffs
+}
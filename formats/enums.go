@@ -0,0 +1,114 @@
+package formats
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var mergeModeNames = map[MergeMode]string{
+	Mix:        "Mix",
+	SideBySide: "SideBySide",
+}
+
+func (m MergeMode) String() string {
+	if name, ok := mergeModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("MergeMode(%d)", int(m))
+}
+
+// ParseMergeMode accepts the String() form, case-insensitive
+func ParseMergeMode(s string) (MergeMode, error) {
+	for m, name := range mergeModeNames {
+		if strings.EqualFold(name, s) {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid MergeMode: %s", s)
+}
+
+func (m MergeMode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts the name or the legacy integer value
+func (m *MergeMode) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		if _, ok := mergeModeNames[MergeMode(n)]; !ok {
+			return fmt.Errorf("invalid MergeMode: %d", n)
+		}
+		*m = MergeMode(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseMergeMode(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// ParseAudioFileFormat accepts any supported format name, case-insensitive.
+// AudioFileFormat is a string already and is embedded in AudioArgs, so it has no
+// String/JSON methods of its own: they would be promoted and take over AudioArgs
+func ParseAudioFileFormat(s string) (AudioFileFormat, error) {
+	for _, f := range allFormats {
+		if strings.EqualFold(string(f), s) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("invalid AudioFileFormat: %s", s)
+}
+
+// UnmarshalJSON rejects unknown format names on decode and normalizes their
+// case, the methods live on AudioArgs since AudioFileFormat can not have them
+func (a *AudioArgs) UnmarshalJSON(data []byte) error {
+	type plain AudioArgs
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	if p.AudioFileFormat != "" {
+		f, err := ParseAudioFileFormat(string(p.AudioFileFormat))
+		if err != nil {
+			return err
+		}
+		p.AudioFileFormat = f
+	}
+	*a = AudioArgs(p)
+	return nil
+}
+
+// UnmarshalJSON rejects unknown op names, "" keeps the FORMATCONVERT default
+func (o *OpType) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		*o = ""
+		return nil
+	}
+	op, err := ParseOpType(s)
+	if err != nil {
+		return err
+	}
+	*o = op
+	return nil
+}
+
+// ParseOpType accepts any supported op name, case-insensitive
+func ParseOpType(s string) (OpType, error) {
+	for _, op := range allOps {
+		if strings.EqualFold(string(op.Name), s) {
+			return op.Name, nil
+		}
+	}
+	return "", fmt.Errorf("invalid OpType: %s", s)
+}
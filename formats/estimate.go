@@ -0,0 +1,128 @@
+package formats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultBitrates bits per second ffmpeg encodes at when neither Bitrate nor
+// VBR is set, opus and vorbis add defaultStereoBitrates from two channels on
+var defaultBitrates = map[AudioFileFormat]int{
+	MP3:   128000,
+	AAC:   128000,
+	M4A:   128000,
+	HLS:   128000,
+	OPUS:  64000,
+	OGG:   80000,
+	G722:  64000,
+	G729:  8000,
+	GSM:   13200,
+	AMRNB: 12200,
+	AMRWB: 23850,
+}
+
+var defaultStereoBitrates = map[AudioFileFormat]int{
+	OPUS: 32000,
+	OGG:  32000,
+}
+
+// vbrBitrates typical bits per second by Quality of VBR encoders
+var vbrBitrates = map[AudioFileFormat][]int{
+	// libmp3lame -q:a 0 (best) - 9
+	MP3: {245000, 225000, 190000, 175000, 165000, 130000, 115000, 100000, 85000, 65000},
+	// libvorbis -q:a 0 - 10
+	OGG: {64000, 80000, 96000, 112000, 128000, 160000, 192000, 224000, 256000, 320000, 500000},
+}
+
+// containerOverhead bytes the muxer adds on top of the encoded audio: fixed
+// headers and metadata plus a share of the payload for framing
+type containerOverhead struct {
+	fixed int64
+	ratio float64
+}
+
+var containerOverheads = map[AudioFileFormat]containerOverhead{
+	WAV:      {fixed: 44},
+	ADPCMIMA: {fixed: 60},
+	ADPCMMS:  {fixed: 90},
+	MP3:      {fixed: 1024},
+	FLAC:     {fixed: 8192 + 42},
+	OGG:      {fixed: 4096, ratio: 0.01},
+	OPUS:     {fixed: 1024, ratio: 0.02},
+	M4A:      {fixed: 2048, ratio: 0.01},
+	AAC:      {ratio: 0.02},
+	AMRNB:    {fixed: 6},
+	AMRWB:    {fixed: 9},
+	HLS:      {ratio: 0.1},
+}
+
+// flacRatio share of the s16 PCM size FLAC typically keeps for speech and music
+const flacRatio = 0.6
+
+// EstimateOutputSize bytes every output of cfg is expected to take when the
+// input lasts inputDuration, one entry per output, e.g. to reserve storage or
+// compare bitrates before a run. Raw PCM and PCM in WAV are exact, encoded
+// formats use typical bitrates and container overheads. Speed is accounted
+// for, SilenceRemove is not, so the estimate is an upper bound there
+func EstimateOutputSize(cfg AudioConfig, inputDuration time.Duration) ([]int64, error) {
+	if inputDuration < 0 {
+		return nil, fmt.Errorf("inputDuration must be >= 0, got %v", inputDuration)
+	}
+	cfg = cfg.Clone()
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	seconds := inputDuration.Seconds()
+	if cfg.Speed > 0 {
+		seconds /= cfg.Speed
+	}
+	sizes := make([]int64, cfg.OutputCount())
+	for i := range sizes {
+		arg := cfg.GetOutputArg(i)
+		if IsSoundDevice(arg.AudioFileFormat) {
+			continue
+		}
+		payload := float64(outputBitrate(arg)) * seconds / 8
+		over := containerOverheads[arg.AudioFileFormat]
+		sizes[i] = int64(payload*(1+over.ratio)) + over.fixed
+	}
+	return sizes, nil
+}
+
+// outputBitrate bits per second of the encoded audio of arg
+func outputBitrate(arg AudioArgs) int {
+	pcm := func(sampleBytes int) int {
+		return sampleBytes * 8 * arg.SampleRate * arg.Channels
+	}
+	if n := SampleBytes(arg.AudioFileFormat); n > 0 {
+		return pcm(n)
+	}
+	switch arg.AudioFileFormat {
+	case WAV:
+		// pcm_<format> codecs in WAV, pcm_s16le by default
+		if n := SampleBytes(AudioFileFormat(strings.TrimPrefix(arg.Codec, "pcm_"))); n > 0 {
+			return pcm(n)
+		}
+		if arg.Codec == "" {
+			return pcm(2)
+		}
+	case FLAC:
+		return int(float64(pcm(2)) * flacRatio)
+	case ADPCMIMA, ADPCMMS:
+		// 4 bits per sample
+		return arg.SampleRate * arg.Channels * 4
+	}
+	if arg.Bitrate > 0 {
+		return arg.Bitrate
+	}
+	if table := vbrBitrates[arg.AudioFileFormat]; arg.VBR && arg.Quality >= 0 && arg.Quality < len(table) {
+		return table[arg.Quality]
+	}
+	bitrate := defaultBitrates[arg.AudioFileFormat]
+	if arg.Channels >= 2 {
+		bitrate += defaultStereoBitrates[arg.AudioFileFormat]
+	}
+	return bitrate
+}
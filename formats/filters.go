@@ -0,0 +1,427 @@
+package formats
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetFilter replaces the custom filters, e.g. SetFilter("highpass=f=200", "volume=2")
+func (c *AudioConfig) SetFilter(filters ...string) {
+	c.Filters = slices.Clone(filters)
+}
+
+// AddFilter appends one custom filter to the chain
+func (c *AudioConfig) AddFilter(filter string) {
+	c.Filters = append(c.Filters, filter)
+}
+
+// EscapeFilterArg escapes an option value for use inside a filter chain,
+// e.g. "drawtext=text=" + EscapeFilterArg("a:b"). Filter names and the
+// ":"/"=" separators of options must not be escaped. ffmpeg unescapes twice:
+// once for the option value (\ ' :), then for the graph (\ ' [ ] , ;)
+func EscapeFilterArg(v string) string {
+	v = escapeChars(v, `\':`)
+	return escapeChars(v, `\'[],;`)
+}
+
+// CheckFilterArg rejects a user supplied filter parameter carrying graph
+// syntax: "," and ";" would end the filter or chain, "[" "]" open pads.
+// Parameters meant to hold such text go through EscapeFilterArg instead
+func CheckFilterArg(v string) error {
+	if i := strings.IndexAny(v, ",;[]\n\r"); i >= 0 {
+		return fmt.Errorf("filter parameter %q: %q is not allowed", v, v[i])
+	}
+	return nil
+}
+
+func escapeChars(v, special string) string {
+	var b strings.Builder
+	for _, r := range v {
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// SilenceRemove strips pauses longer than Duration whose level stays below Threshold
+type SilenceRemove struct {
+	// Threshold in dBFS, e.g. -50
+	ThresholdDB float64
+	// Duration in seconds a pause must last before it is removed
+	Duration float64
+	// KeepSilence in seconds left in place of every removed pause
+	KeepSilence float64
+}
+
+func (s *SilenceRemove) setDefaults() {
+	if s.ThresholdDB == 0 {
+		s.ThresholdDB = -50
+	}
+	if s.Duration <= 0 {
+		s.Duration = 1
+	}
+}
+
+func (s *SilenceRemove) validate() error {
+	if s.ThresholdDB > 0 {
+		return fmt.Errorf("SilenceRemove: ThresholdDB must be <= 0, got %v", s.ThresholdDB)
+	}
+	if s.Duration <= 0 {
+		return fmt.Errorf("SilenceRemove: Duration must be > 0, got %v", s.Duration)
+	}
+	if s.KeepSilence < 0 || s.KeepSilence > s.Duration {
+		return fmt.Errorf("SilenceRemove: KeepSilence must be within [0, Duration], got %v", s.KeepSilence)
+	}
+	return nil
+}
+
+// filter: silenceremove, stop_periods=-1 removes every pause in the stream
+func (s *SilenceRemove) filter() string {
+	return fmt.Sprintf("silenceremove=stop_periods=-1:stop_duration=%s:stop_threshold=%sdB:stop_silence=%s",
+		formatFloat(s.Duration), formatFloat(s.ThresholdDB), formatFloat(s.KeepSilence))
+}
+
+// streamFilter Gain as a volume filter ahead of the stream's own Filter,
+// fades last so they shape the final level
+func (a AudioArgs) streamFilter() string {
+	var gain, fadeIn, fadeOut string
+	if a.Gain != 0 {
+		gain = "volume=" + formatFloat(a.Gain) + "dB"
+	}
+	if a.FadeIn > 0 {
+		fadeIn = "afade=t=in:d=" + formatFloat(a.FadeIn.Seconds())
+	}
+	// afade needs the start of a fade-out, reversing turns the end into a fade-in
+	if a.FadeOut > 0 {
+		fadeOut = "areverse,afade=t=in:d=" + formatFloat(a.FadeOut.Seconds()) + ",areverse"
+	}
+	return joinFilters(gain, a.Filter, fadeIn, fadeOut)
+}
+
+// tempoFilter atempo chain for speed, one atempo stays within [0.5, 2] where
+// it keeps its quality, so factors beyond are split into several
+func tempoFilter(speed float64) string {
+	var stages []string
+	for speed > 2 {
+		stages = append(stages, "atempo=2")
+		speed /= 2
+	}
+	for speed < 0.5 {
+		stages = append(stages, "atempo=0.5")
+		speed /= 0.5
+	}
+	if speed != 1 {
+		stages = append(stages, "atempo="+formatFloat(speed))
+	}
+	return strings.Join(stages, ",")
+}
+
+// formatFloat filter and option numbers, strconv ignores the locale so the
+// decimal separator is always "." and never the "," that splits filters
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Compressor acompressor settings, zero fields take the defaults
+type Compressor struct {
+	// ThresholdDB level where compression starts, within [-60, 0], default -18
+	ThresholdDB float64
+	// Ratio of the reduction above the threshold, within [1, 20], default 4
+	Ratio float64
+	// Attack within [0.01ms, 2s], default 20ms
+	Attack time.Duration
+	// Release within [0.01ms, 9s], default 250ms
+	Release time.Duration
+	// MakeupDB gain after compression, within [0, 36]
+	MakeupDB float64
+}
+
+func (c *Compressor) setDefaults() {
+	if c.ThresholdDB == 0 {
+		c.ThresholdDB = -18
+	}
+	if c.Ratio == 0 {
+		c.Ratio = 4
+	}
+	if c.Attack == 0 {
+		c.Attack = 20 * time.Millisecond
+	}
+	if c.Release == 0 {
+		c.Release = 250 * time.Millisecond
+	}
+}
+
+func (c *Compressor) validate() error {
+	if !(c.ThresholdDB >= -60 && c.ThresholdDB <= 0) {
+		return fmt.Errorf("Compressor: ThresholdDB must be within [-60, 0], got %v", c.ThresholdDB)
+	}
+	if !(c.Ratio >= 1 && c.Ratio <= 20) {
+		return fmt.Errorf("Compressor: Ratio must be within [1, 20], got %v", c.Ratio)
+	}
+	if c.Attack < 10*time.Microsecond || c.Attack > 2*time.Second {
+		return fmt.Errorf("Compressor: Attack must be within [0.01ms, 2s], got %v", c.Attack)
+	}
+	if c.Release < 10*time.Microsecond || c.Release > 9*time.Second {
+		return fmt.Errorf("Compressor: Release must be within [0.01ms, 9s], got %v", c.Release)
+	}
+	if !(c.MakeupDB >= 0 && c.MakeupDB <= 36) {
+		return fmt.Errorf("Compressor: MakeupDB must be within [0, 36], got %v", c.MakeupDB)
+	}
+	return nil
+}
+
+// filter: acompressor takes dB levels with a "dB" suffix, times in ms
+func (c *Compressor) filter() string {
+	return fmt.Sprintf("acompressor=threshold=%sdB:ratio=%s:attack=%s:release=%s:makeup=%sdB",
+		formatFloat(c.ThresholdDB), formatFloat(c.Ratio), formatFloat(milliseconds(c.Attack)),
+		formatFloat(milliseconds(c.Release)), formatFloat(c.MakeupDB))
+}
+
+// Limiter alimiter settings, zero fields take the defaults
+type Limiter struct {
+	// LimitDB ceiling in dBFS, within [-24, 0], default -1
+	LimitDB float64
+	// Attack within [0.1ms, 80ms], default 5ms
+	Attack time.Duration
+	// Release within [1ms, 8s], default 50ms
+	Release time.Duration
+}
+
+func (l *Limiter) setDefaults() {
+	if l.LimitDB == 0 {
+		l.LimitDB = -1
+	}
+	if l.Attack == 0 {
+		l.Attack = 5 * time.Millisecond
+	}
+	if l.Release == 0 {
+		l.Release = 50 * time.Millisecond
+	}
+}
+
+func (l *Limiter) validate() error {
+	if !(l.LimitDB >= -24 && l.LimitDB <= 0) {
+		return fmt.Errorf("Limiter: LimitDB must be within [-24, 0], got %v", l.LimitDB)
+	}
+	if l.Attack < 100*time.Microsecond || l.Attack > 80*time.Millisecond {
+		return fmt.Errorf("Limiter: Attack must be within [0.1ms, 80ms], got %v", l.Attack)
+	}
+	if l.Release < time.Millisecond || l.Release > 8*time.Second {
+		return fmt.Errorf("Limiter: Release must be within [1ms, 8s], got %v", l.Release)
+	}
+	return nil
+}
+
+// filter: level=disabled keeps alimiter from raising the level to the limit
+func (l *Limiter) filter() string {
+	return fmt.Sprintf("alimiter=limit=%sdB:attack=%s:release=%s:level=disabled",
+		formatFloat(l.LimitDB), formatFloat(milliseconds(l.Attack)), formatFloat(milliseconds(l.Release)))
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// LoudnessPreset targets the loudness spec of a distribution platform
+type LoudnessPreset string
+
+const (
+	// Spotify: -14 LUFS, -1 dBTP
+	LoudnessSpotify LoudnessPreset = "spotify"
+	// AppleMusic: -16 LUFS, -1 dBTP
+	LoudnessAppleMusic LoudnessPreset = "apple_music"
+	// YouTube: -14 LUFS, -1 dBTP
+	LoudnessYouTube LoudnessPreset = "youtube"
+)
+
+type loudnessSpec struct {
+	integrated float64 // LUFS
+	truePeak   float64 // dBTP
+	lra        float64 // LU
+}
+
+var loudnessSpecs = map[LoudnessPreset]loudnessSpec{
+	LoudnessSpotify:    {integrated: -14, truePeak: -1, lra: 11},
+	LoudnessAppleMusic: {integrated: -16, truePeak: -1, lra: 11},
+	LoudnessYouTube:    {integrated: -14, truePeak: -1, lra: 11},
+}
+
+func (p LoudnessPreset) validate() error {
+	if _, ok := loudnessSpecs[p]; !ok {
+		return fmt.Errorf("invalid LoudnessPreset: %s", p)
+	}
+	return nil
+}
+
+// filter: loudnorm to the integrated target, then alimiter as a true-peak safety net
+func (p LoudnessPreset) filter() string {
+	spec := loudnessSpecs[p]
+	limit := math.Pow(10, spec.truePeak/20)
+	return fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%s,alimiter=limit=%s:level=disabled",
+		formatFloat(spec.integrated), formatFloat(spec.truePeak), formatFloat(spec.lra),
+		strconv.FormatFloat(limit, 'f', 4, 64))
+}
+
+// voiceIsolationFilters meeting speech cleanup:
+// high-pass rumble cut, FFT denoise, low-mid cut against room boom,
+// presence boost for intelligibility, then dynaudnorm as AGC
+var voiceIsolationFilters = []string{
+	"highpass=f=100",
+	"afftdn=nr=12:nf=-40",
+	"equalizer=f=300:t=q:w=1:g=-4",
+	"equalizer=f=3000:t=q:w=1.5:g=3",
+	"dynaudnorm=f=150:g=15:p=0.9",
+}
+
+// PhoneSimulation degrades audio to telephony quality:
+// 300-3400 Hz band, 8 kHz sample rate and an optional G.711 round trip
+type PhoneSimulation struct {
+	// G711 ALAW or MULAW runs the audio through a real G.711 encode/decode, empty skips it
+	G711 AudioFileFormat
+}
+
+func (p *PhoneSimulation) validate() error {
+	if p.G711 != "" && p.G711 != ALAW && p.G711 != MULAW {
+		return fmt.Errorf("PhoneSimulation: G711 must be ALAW or MULAW, got %s", p.G711)
+	}
+	return nil
+}
+
+func (p *PhoneSimulation) filter() string {
+	return "highpass=f=300,lowpass=f=3400,aresample=8000"
+}
+
+// EQBand one peaking equalizer band
+type EQBand struct {
+	FrequencyHz float64
+	// Q band width as quality factor, 0 defaults to 1
+	Q float64
+	// GainDB boost or cut within [-30, 30]
+	GainDB float64
+}
+
+func (b *EQBand) setDefaults() {
+	if b.Q == 0 {
+		b.Q = 1
+	}
+}
+
+func (b *EQBand) validate(label string) error {
+	if !(b.FrequencyHz > 0) {
+		return fmt.Errorf("%s: FrequencyHz must be > 0, got %v", label, b.FrequencyHz)
+	}
+	if !(b.Q > 0 && b.Q <= 100) {
+		return fmt.Errorf("%s: Q must be within (0, 100], got %v", label, b.Q)
+	}
+	if !(b.GainDB >= -30 && b.GainDB <= 30) {
+		return fmt.Errorf("%s: GainDB must be within [-30, 30], got %v", label, b.GainDB)
+	}
+	return nil
+}
+
+func (b EQBand) filter() string {
+	return "equalizer=f=" + formatFloat(b.FrequencyHz) + ":t=q:w=" + formatFloat(b.Q) + ":g=" + formatFloat(b.GainDB)
+}
+
+// validateBands pass filter cutoffs and EQ bands
+func (c *AudioConfig) validateBands() error {
+	if math.IsNaN(c.HighPassHz) || c.HighPassHz < 0 || math.IsNaN(c.LowPassHz) || c.LowPassHz < 0 {
+		return fmt.Errorf("HighPassHz and LowPassHz must be >= 0, got %v and %v", c.HighPassHz, c.LowPassHz)
+	}
+	if c.HighPassHz > 0 && c.LowPassHz > 0 && c.LowPassHz <= c.HighPassHz {
+		return fmt.Errorf("LowPassHz %v must be above HighPassHz %v", c.LowPassHz, c.HighPassHz)
+	}
+	for i := range c.EQ {
+		if err := c.EQ[i].validate(fmt.Sprintf("EQ[%d]", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PitchShift changes the pitch by Semitones at unchanged speed, e.g. to
+// disguise voices in call review
+type PitchShift struct {
+	// Semitones within [-12, 12], negative lowers the voice
+	Semitones float64
+	// Rubberband uses the rubberband filter, better quality but it needs an
+	// ffmpeg built with librubberband. Otherwise asetrate raises the rate and
+	// atempo restores the speed
+	Rubberband bool
+}
+
+func (p *PitchShift) validate(sampleRate int) error {
+	if math.IsNaN(p.Semitones) || p.Semitones < -12 || p.Semitones > 12 {
+		return fmt.Errorf("PitchShift: Semitones must be within [-12, 12], got %v", p.Semitones)
+	}
+	if !p.Rubberband && sampleRate <= 0 {
+		return errors.New("PitchShift: needs the output SampleRate")
+	}
+	return nil
+}
+
+// filter at sampleRate, the output rate the stream is brought to first so
+// asetrate knows the rate it scales
+func (p *PitchShift) filter(sampleRate int) string {
+	ratio := math.Pow(2, p.Semitones/12)
+	if p.Rubberband {
+		return "rubberband=pitch=" + formatFloat(ratio)
+	}
+	shifted := int(math.Round(float64(sampleRate) * ratio))
+	rate := strconv.Itoa(sampleRate)
+	return "aresample=" + rate + ",asetrate=" + strconv.Itoa(shifted) + ",aresample=" + rate + "," +
+		tempoFilter(float64(sampleRate)/float64(shifted))
+}
+
+// Degrade encodes and decodes the audio through Codec Times times,
+// simulating a transcoding chain
+type Degrade struct {
+	// Codec intermediate format and Bitrate, SampleRate/Channels default to the input
+	Codec AudioArgs
+	// Times number of round trips, defaults to 1
+	Times int
+}
+
+func (d *Degrade) setDefaults(input AudioArgs) {
+	if d.Times <= 0 {
+		d.Times = 1
+	}
+	if d.Codec.SampleRate <= 0 {
+		d.Codec.SampleRate = input.SampleRate
+	}
+	if d.Codec.Channels <= 0 {
+		d.Codec.Channels = input.Channels
+	}
+}
+
+// Impairment randomly drops or delays Stream mode input chunks before they reach ffmpeg,
+// the same Seed reproduces the same decisions for the same chunk sequence
+type Impairment struct {
+	// DropRate fraction of chunks discarded, 0..1
+	DropRate float64
+	// DelayRate fraction of chunks held back before writing, 0..1
+	DelayRate float64
+	// MaxDelay upper bound of a random delay
+	MaxDelay time.Duration
+	Seed     uint64
+}
+
+func (i *Impairment) validate() error {
+	if i.DropRate < 0 || i.DropRate > 1 {
+		return fmt.Errorf("Impairment: DropRate must be within [0, 1], got %v", i.DropRate)
+	}
+	if i.DelayRate < 0 || i.DelayRate > 1 {
+		return fmt.Errorf("Impairment: DelayRate must be within [0, 1], got %v", i.DelayRate)
+	}
+	if i.DelayRate > 0 && i.MaxDelay <= 0 {
+		return fmt.Errorf("Impairment: MaxDelay is required when DelayRate is set")
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package formats
+
+import (
+	"fmt"
+	"time"
+)
+
+// ConfigBuilder fluent AudioConfig construction, pick the op first so only
+// its options are offered:
+//
+//	cfg, err := formats.NewConfig().Convert().From(S16LE, 8000, 1).To(WAV, 16000, 1).Build()
+type ConfigBuilder struct{}
+
+func NewConfig() ConfigBuilder {
+	return ConfigBuilder{}
+}
+
+// Convert FORMATCONVERT, one input and one output
+func (ConfigBuilder) Convert() *ConvertBuilder {
+	return &ConvertBuilder{opBuilder{cfg: AudioConfig{OpType: FORMATCONVERT}}}
+}
+
+// Split CHANNELSPLIT, one multichannel input into one mono output per channel
+func (ConfigBuilder) Split() *SplitBuilder {
+	return &SplitBuilder{opBuilder{cfg: AudioConfig{OpType: CHANNELSPLIT}}}
+}
+
+// Merge AUDIOMERGE of the inputs added with Input
+func (ConfigBuilder) Merge(mode MergeMode) *MergeBuilder {
+	return &MergeBuilder{opBuilder{cfg: AudioConfig{OpType: AUDIOMERGE, MergeMode: mode}}}
+}
+
+// opBuilder state shared by the op builders
+type opBuilder struct {
+	cfg AudioConfig
+	err error
+}
+
+func (b *opBuilder) build() (AudioConfig, error) {
+	if b.err != nil {
+		return AudioConfig{}, b.err
+	}
+	if len(b.cfg.InputArgs) == 0 || len(b.cfg.OutputArgs) == 0 {
+		return AudioConfig{}, fmt.Errorf("%s: input and output formats are required", b.cfg.OpType)
+	}
+	check := b.cfg.Clone()
+	check.SetDefaults()
+	if err := check.Validate(); err != nil {
+		return AudioConfig{}, err
+	}
+	return b.cfg.Clone(), nil
+}
+
+// ConvertBuilder options of a FORMATCONVERT
+type ConvertBuilder struct{ opBuilder }
+
+// From input format, rate and channels, 0 leaves rate or channels to the
+// container or the profile default
+func (b *ConvertBuilder) From(f AudioFileFormat, sampleRate, channels int) *ConvertBuilder {
+	b.cfg.InputArgs = []AudioArgs{{AudioFileFormat: f, SampleRate: sampleRate, Channels: channels}}
+	return b
+}
+
+// To output format, rate and channels
+func (b *ConvertBuilder) To(f AudioFileFormat, sampleRate, channels int) *ConvertBuilder {
+	b.cfg.OutputArgs = []AudioArgs{{AudioFileFormat: f, SampleRate: sampleRate, Channels: channels}}
+	return b
+}
+
+// Name labels the output for Reader(name)
+func (b *ConvertBuilder) Name(name string) *ConvertBuilder {
+	if len(b.cfg.OutputArgs) == 0 {
+		b.err = fmt.Errorf("Name needs To first")
+		return b
+	}
+	b.cfg.OutputArgs[0].Name = name
+	return b
+}
+
+// Codec output encoder, e.g. "pcm_mulaw" inside WAV
+func (b *ConvertBuilder) Codec(codec string) *ConvertBuilder {
+	if len(b.cfg.OutputArgs) == 0 {
+		b.err = fmt.Errorf("Codec needs To first")
+		return b
+	}
+	b.cfg.OutputArgs[0].Codec = codec
+	return b
+}
+
+// Bitrate CBR output bitrate in bits per second
+func (b *ConvertBuilder) Bitrate(bps int) *ConvertBuilder {
+	if len(b.cfg.OutputArgs) == 0 {
+		b.err = fmt.Errorf("Bitrate needs To first")
+		return b
+	}
+	b.cfg.OutputArgs[0].Bitrate = bps
+	return b
+}
+
+// Fade output fade-in and fade-out durations, 0 skips either
+func (b *ConvertBuilder) Fade(in, out time.Duration) *ConvertBuilder {
+	if len(b.cfg.OutputArgs) == 0 {
+		b.err = fmt.Errorf("Fade needs To first")
+		return b
+	}
+	b.cfg.OutputArgs[0].FadeIn = in
+	b.cfg.OutputArgs[0].FadeOut = out
+	return b
+}
+
+// Filter appends an ffmpeg filter run between input and output
+func (b *ConvertBuilder) Filter(filter string) *ConvertBuilder {
+	b.cfg.Filters = append(b.cfg.Filters, filter)
+	return b
+}
+
+// Files File mode paths
+func (b *ConvertBuilder) Files(input, output string) *ConvertBuilder {
+	b.cfg.InputFiles = []string{input}
+	b.cfg.OutputFiles = []string{output}
+	return b
+}
+
+// Build validates the config, defaults are applied by the engine
+func (b *ConvertBuilder) Build() (AudioConfig, error) {
+	return b.build()
+}
+
+// SplitBuilder options of a CHANNELSPLIT
+type SplitBuilder struct{ opBuilder }
+
+// From multichannel input format, rate and channels
+func (b *SplitBuilder) From(f AudioFileFormat, sampleRate, channels int) *SplitBuilder {
+	b.cfg.InputArgs = []AudioArgs{{AudioFileFormat: f, SampleRate: sampleRate, Channels: channels}}
+	return b
+}
+
+// To format and rate of every mono output, one per input channel
+func (b *SplitBuilder) To(f AudioFileFormat, sampleRate int) *SplitBuilder {
+	b.cfg.OutputArgs = []AudioArgs{{AudioFileFormat: f, SampleRate: sampleRate, Channels: 1}}
+	return b
+}
+
+// Named one output per name in channel order, each with the format of To,
+// e.g. Named("left", "right") for Reader("right") instead of output 1
+func (b *SplitBuilder) Named(names ...string) *SplitBuilder {
+	if len(b.cfg.OutputArgs) == 0 {
+		b.err = fmt.Errorf("Named needs To first")
+		return b
+	}
+	out := b.cfg.OutputArgs[0]
+	b.cfg.OutputArgs = make([]AudioArgs, len(names))
+	for i, name := range names {
+		b.cfg.OutputArgs[i] = out
+		b.cfg.OutputArgs[i].Name = name
+	}
+	return b
+}
+
+// Files File mode paths, one output per channel
+func (b *SplitBuilder) Files(input string, outputs ...string) *SplitBuilder {
+	b.cfg.InputFiles = []string{input}
+	b.cfg.OutputFiles = outputs
+	return b
+}
+
+// Build validates the config, defaults are applied by the engine
+func (b *SplitBuilder) Build() (AudioConfig, error) {
+	return b.build()
+}
+
+// MergeBuilder options of an AUDIOMERGE
+type MergeBuilder struct{ opBuilder }
+
+// Input adds the next input, at least two
+func (b *MergeBuilder) Input(f AudioFileFormat, sampleRate, channels int) *MergeBuilder {
+	b.cfg.InputArgs = append(b.cfg.InputArgs, AudioArgs{AudioFileFormat: f, SampleRate: sampleRate, Channels: channels})
+	return b
+}
+
+// To merged output format, rate and channels
+func (b *MergeBuilder) To(f AudioFileFormat, sampleRate, channels int) *MergeBuilder {
+	b.cfg.OutputArgs = []AudioArgs{{AudioFileFormat: f, SampleRate: sampleRate, Channels: channels}}
+	return b
+}
+
+// Files File mode paths, one input per Input call
+func (b *MergeBuilder) Files(output string, inputs ...string) *MergeBuilder {
+	b.cfg.InputFiles = inputs
+	b.cfg.OutputFiles = []string{output}
+	return b
+}
+
+// Build validates the config, defaults are applied by the engine
+func (b *MergeBuilder) Build() (AudioConfig, error) {
+	if len(b.cfg.InputArgs) < 2 {
+		return AudioConfig{}, fmt.Errorf("%s: at least two inputs are required", AUDIOMERGE)
+	}
+	return b.build()
+}
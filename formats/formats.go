@@ -3,7 +3,12 @@ package formats
 import (
 	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/QuincyGao/audio-go/vad"
 )
 
 // -f args
@@ -37,17 +42,90 @@ const (
 	OPUS  AudioFileFormat = "opus"
 	AAC   AudioFileFormat = "aac"
 	GSM   AudioFileFormat = "gsm"
+	FLAC  AudioFileFormat = "flac"
+	AMRNB AudioFileFormat = "amrnb" // -f amr, 8kHz mono
+	AMRWB AudioFileFormat = "amrwb" // -f amr, 16kHz mono
+	M4A   AudioFileFormat = "m4a"   // -f ipod, AAC in MP4, file output only
+	OGG   AudioFileFormat = "ogg"   // container, pick the payload with Codec
+	// ADPCM in a WAV container, legacy IVR prompts
+	ADPCMIMA AudioFileFormat = "adpcm_ima_wav"
+	ADPCMMS  AudioFileFormat = "adpcm_ms"
+	// sound devices (Linux): capture as input, playback as output. InputFiles or
+	// OutputFiles name the device, e.g. "default" or "hw:1,0"
+	ALSA  AudioFileFormat = "alsa"
+	PULSE AudioFileFormat = "pulse"
+	// HLS live playlist plus segments for browsers, AAC by default. OutputFiles
+	// names the .m3u8 playlist, segments are written next to it. Output only
+	HLS AudioFileFormat = "hls"
 )
 
+// muxer -f value, formats sharing a container differ by codec
+func (f AudioFileFormat) muxer() string {
+	switch f {
+	case AMRNB, AMRWB:
+		return "amr"
+	case M4A:
+		return "ipod"
+	case ADPCMIMA, ADPCMMS:
+		return "wav"
+	}
+	return string(f)
+}
+
+// encoder -c:a value for output, Codec wins over the format default
+func (a AudioArgs) encoder() string {
+	if a.Codec != "" {
+		return a.Codec
+	}
+	return a.AudioFileFormat.encoder()
+}
+
+// encoder default -c:a of the format, empty lets ffmpeg pick
+func (f AudioFileFormat) encoder() string {
+	switch f {
+	case AMRNB:
+		return "libopencore_amrnb"
+	case AMRWB:
+		return "libvo_amrwbenc"
+	case M4A:
+		return "aac"
+	case ADPCMIMA, ADPCMMS:
+		return string(f)
+	case HLS:
+		return "aac"
+	}
+	return ""
+}
+
+// SeekableOutput the muxer rewrites its header after encoding,
+// so the output can not be a pipe
+func (f AudioFileFormat) SeekableOutput() bool {
+	return f == M4A
+}
+
+// OpType operation run by the engine, string based so configs stay readable
+type OpType string
+
 const (
 	// FORMATCONVERT
-	FORMATCONVERT string = "FormatConvert"
+	FORMATCONVERT OpType = "FormatConvert"
 	// CHANNELSPLIT
-	CHANNELSPLIT string = "ChannelSplit"
+	CHANNELSPLIT OpType = "ChannelSplit"
 	// AUDIOMERGE
-	AUDIOMERGE string = "AudioMerge"
+	AUDIOMERGE OpType = "AudioMerge"
+	// VADSEGMENT
+	VADSEGMENT OpType = "VADSegment"
+	// DEGRADE
+	DEGRADE OpType = "Degrade"
+	// FANOUT one input converted into every OutputArgs by one process, e.g. a
+	// stereo archive plus a mono downmix for ASR
+	FANOUT OpType = "FanOut"
 )
 
+func (o OpType) String() string {
+	return string(o)
+}
+
 type MergeMode int
 
 const (
@@ -61,28 +139,293 @@ type AudioArgs struct {
 	AudioFileFormat
 	SampleRate int
 	Channels   int
+	// Name labels an output, e.g. "agent", so callers read it by name and
+	// adding an output does not shift their indexes. Unique per config
+	Name string
+	// Filter ffmpeg filter chain for this stream only: an input's Filter runs
+	// before the op, an output's Filter after it. Escape values with EscapeFilterArg
+	Filter string
+	// Gain in dB applied by a volume filter ahead of Filter, e.g. 6 lifts one
+	// quiet merge input. 0 leaves the level untouched
+	Gain float64
+	// FadeIn/FadeOut afade ramps at the start and end of an output, e.g. for
+	// prompts and ringback clips. FadeOut holds the whole output back to find
+	// its end, so it suits clips rather than live streams. Output only
+	FadeIn  time.Duration
+	FadeOut time.Duration
+	// Codec ffmpeg encoder (-c:a) inside the container, e.g. "pcm_mulaw" in WAV
+	// or "libopus" in OGG, empty picks the format default. Output only
+	Codec string
+	// ChannelLayout e.g. Layout51 or a custom "FL+FR+LFE", empty derives it from Channels
+	ChannelLayout ChannelLayout
+	// CompressionLevel FLAC output level 1-12, 0 keeps the ffmpeg default
+	CompressionLevel int
+	// Bitrate CBR output bitrate in bits per second (-b:a), 0 keeps the ffmpeg default
+	Bitrate int
+	// VBR encodes with Quality (-q:a) instead of a fixed Bitrate
+	VBR bool
+	// Quality codec specific VBR scale, e.g. 0 (best) - 9 for MP3
+	Quality int
+	// PayloadType of an rtp:// output, 0 takes the static type of G.711, G.722
+	// and GSM or 96 for dynamic codecs (OPUS, S16BE as L16)
+	PayloadType int
 }
 
 type AudioConfig struct {
-	InputArgs   []AudioArgs
-	OutputArgs  []AudioArgs
-	MergeMode   MergeMode
-	OpType      string
-	Filters     []string
-	InputFiles  []string
+	InputArgs  []AudioArgs
+	OutputArgs []AudioArgs
+	MergeMode  MergeMode
+	OpType     OpType
+	Filters    []string
+	InputFiles []string
+	// OutputFiles may also name an existing named FIFO or unix socket owned by
+	// another process: the engine waits for the FIFO reader before ffmpeg starts
 	OutputFiles []string
+	// MergeInputs number of AUDIOMERGE inputs in Stream mode, defaults to 2.
+	// File mode uses len(InputFiles)
+	MergeInputs int
+	// MergeFileInputs makes a Stream mode AUDIOMERGE read a non-empty
+	// InputFiles[i] (e.g. background music) instead of live pipe i, the input
+	// count becomes the larger of len(InputFiles) and MergeInputs
+	MergeFileInputs bool
+	// FFmpeg binary discovery, zero value looks up ffmpeg in PATH
+	FFmpeg FFmpegOptions
+	// Profile picks the SampleRate/Channels defaults, empty means ProfileTelephony
+	Profile DefaultProfile
+	// PhoneSimulation degrades audio to telephony quality, nil disables it
+	PhoneSimulation *PhoneSimulation
+	// VoiceIsolation cleans up meeting speech: high-pass, denoise, EQ and AGC
+	VoiceIsolation bool
+	// HighPassHz/LowPassHz cut below and above the frequency, e.g. 300 and
+	// 3400 to clean telephone-band audio before ASR. 0 disables either
+	HighPassHz float64
+	LowPassHz  float64
+	// EQ peaking equalizer bands applied after the pass filters
+	EQ []EQBand
+	// SilenceRemove strips long pauses, nil disables it
+	SilenceRemove *SilenceRemove
+	// Loudness normalizes to a platform spec, empty disables it
+	Loudness LoudnessPreset
+	// Compressor evens out levels, e.g. of merged voice tracks, nil disables it
+	Compressor *Compressor
+	// Limiter caps peaks last in the chain so the output can not clip, nil disables it
+	Limiter *Limiter
+	// Speed playback speed factor without pitch change, e.g. 1.5, within
+	// [0.1, 10]. 0 and 1 keep the speed
+	Speed float64
+	// PitchShift moves the pitch by semitones keeping the speed, nil disables it
+	PitchShift *PitchShift
+	// VAD detector settings for VADSEGMENT, SampleRate follows OutputArgs[0]
+	VAD *vad.Config
+	// Degrade codec round trip settings for DEGRADE
+	Degrade *Degrade
+	// Impairment simulates packet loss and jitter on Stream mode inputs, nil disables it
+	Impairment *Impairment
+	// Keepalive fills stalls of Stream mode input 0, nil disables it
+	Keepalive *Keepalive
+	// BargeIn reports input energy over a playing prompt, nil disables it
+	BargeIn *BargeIn
+	// OutputBuffer pumps Stream mode outputs into ring buffers, nil reads ffmpeg
+	// directly. CHANNELSPLIT and FANOUT default to a growing one so a reader
+	// lagging on one output, or reading them one after another, can not stall
+	// ffmpeg writing the others
+	OutputBuffer *OutputBuffer
+	// UnbufferedOutputs keeps CHANNELSPLIT and FANOUT outputs unbuffered, e.g. for
+	// OutputFile. Every output must then be drained concurrently
+	UnbufferedOutputs bool
+	// WriteTimeout bounds every Stream mode write, a stalled write returns ErrWriteStalled. 0 waits forever
+	WriteTimeout time.Duration
+	// DeadlockTimeout Stream mode diagnostics: a write blocked this long while
+	// ffmpeg output sits unread and nobody reads it fails with ErrDeadlock and a
+	// per-pipe report instead of hanging. 0 disables the check
+	DeadlockTimeout time.Duration
+	// VerifyDuration tolerance of a post-conversion check that output and input
+	// last equally long, failing Wait with ErrDurationMismatch. 0 disables it.
+	// Stream mode needs raw PCM on both sides and no Keepalive or Impairment
+	VerifyDuration time.Duration
+	// RetryProbe File mode: when ffmpeg rejects an input as invalid data or an
+	// unknown format, run once more with a larger probe and the -f override of
+	// encoded inputs dropped, so ffmpeg detects the real container
+	RetryProbe bool
+	// SimulateLive Stream mode reads InputFiles instead of pipes at real-time
+	// speed (-re), replaying a recording to live output readers, e.g. for load tests
+	SimulateLive bool
+	// PacketSize bytes per datagram of udp:// outputs, 0 keeps ffmpeg's default
+	PacketSize int
+	// AtomicOutput File mode: write each output file to a hidden temp file in
+	// its directory and rename it into place once Wait succeeds, so a crashed
+	// or failed conversion never leaves a truncated file at the final path
+	AtomicOutput bool
+	// OverwritePolicy File mode: what to do with an existing output file, default OverwriteAlways
+	OverwritePolicy OverwritePolicy
+	// HLS segmenting of HLS outputs, nil uses the HLSOptions defaults
+	HLS *HLSOptions
+	// SDPFile path ffmpeg writes the session description of rtp:// outputs to,
+	// for receivers of dynamic payload types. Empty writes none
+	SDPFile string
+	// Reconnect retries rtmp:// and icecast:// outputs after a dropped
+	// connection, nil ends the run with an error instead
+	Reconnect *Reconnect
+	// TraceID caller correlation id, added to logs, events, temp file names
+	// and Stats of the engine so one call can be followed across services
+	TraceID string
+	// RemoteSchemes url schemes InputFiles may fetch from or listen on, e.g.
+	// S3 presigned https urls. nil allows http, https, ftp and the udp, tcp,
+	// rtp and zmq sockets, an empty slice none. SDP inputs count as rtp
+	RemoteSchemes []string
+}
+
+// Clone returns a deep copy, slices and optional settings are not shared with c
+func (c *AudioConfig) Clone() AudioConfig {
+	cp := *c
+	cp.InputArgs = slices.Clone(c.InputArgs)
+	cp.OutputArgs = slices.Clone(c.OutputArgs)
+	cp.Filters = slices.Clone(c.Filters)
+	cp.EQ = slices.Clone(c.EQ)
+	cp.InputFiles = slices.Clone(c.InputFiles)
+	cp.OutputFiles = slices.Clone(c.OutputFiles)
+	cp.RemoteSchemes = slices.Clone(c.RemoteSchemes)
+	cp.FFmpeg.SearchPaths = slices.Clone(c.FFmpeg.SearchPaths)
+	cp.FFmpeg.Nice = clonePtr(c.FFmpeg.Nice)
+	cp.PhoneSimulation = clonePtr(c.PhoneSimulation)
+	cp.PitchShift = clonePtr(c.PitchShift)
+	cp.Compressor = clonePtr(c.Compressor)
+	cp.Limiter = clonePtr(c.Limiter)
+	cp.SilenceRemove = clonePtr(c.SilenceRemove)
+	cp.VAD = clonePtr(c.VAD)
+	cp.Degrade = clonePtr(c.Degrade)
+	cp.Impairment = clonePtr(c.Impairment)
+	cp.Keepalive = clonePtr(c.Keepalive)
+	cp.BargeIn = clonePtr(c.BargeIn)
+	if cp.BargeIn != nil {
+		cp.BargeIn.ThresholdDB = clonePtr(c.BargeIn.ThresholdDB)
+	}
+	cp.OutputBuffer = clonePtr(c.OutputBuffer)
+	cp.HLS = clonePtr(c.HLS)
+	cp.Reconnect = clonePtr(c.Reconnect)
+	return cp
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
 }
 
 func IsRawPCM(fmt AudioFileFormat) bool {
-	return fmt != WAV && fmt != MP3 && fmt != G722 && fmt != G729 && fmt != OPUS && fmt != AAC
+	return fmt != WAV && fmt != MP3 && fmt != G722 && fmt != G729 && fmt != OPUS && fmt != AAC && fmt != FLAC &&
+		fmt != AMRNB && fmt != AMRWB && fmt != M4A &&
+		fmt != ADPCMIMA && fmt != ADPCMMS && fmt != OGG && fmt != HLS && !IsSoundDevice(fmt)
+}
+
+// IsNetworkURL target is a udp://, tcp://, rtp:// or zmq: socket, usable in
+// InputFiles and OutputFiles. zmq: needs an ffmpeg built with libzmq
+func IsNetworkURL(target string) bool {
+	return strings.HasPrefix(target, "udp://") || strings.HasPrefix(target, "tcp://") ||
+		IsRTP(target) || strings.HasPrefix(target, "zmq:")
 }
 
+// NetworkTarget adds pkt_size to a udp:// or rtp:// url when packetSize is set
+func NetworkTarget(url string, packetSize int) string {
+	if packetSize <= 0 || !(strings.HasPrefix(url, "udp://") || IsRTP(url)) {
+		return url
+	}
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%spkt_size=%d", url, sep, packetSize)
+}
+
+// IsSoundDevice format captures from or plays to a sound card or sound server instead of data
+func IsSoundDevice(f AudioFileFormat) bool {
+	return f == ALSA || f == PULSE
+}
+
+// meterable raw formats the in-process level meters read through pcm.Sample
+func meterable(f AudioFileFormat) bool {
+	return f == S16LE || f == S24LE || f == F32LE || f == F64LE
+}
+
+// SampleBytes bytes per sample of a raw PCM format, 0 for encoded formats
+func SampleBytes(f AudioFileFormat) int {
+	switch f {
+	case S8, U8, MULAW, ALAW:
+		return 1
+	case S16LE, S16BE, U16LE, U16BE:
+		return 2
+	case S24LE, S24BE, U24LE, U24BE:
+		return 3
+	case S32LE, S32BE, U32LE, U32BE, F32LE, F32BE:
+		return 4
+	case F64LE, F64BE:
+		return 8
+	}
+	return 0
+}
+
+// GetFilterString the filter chain shared by every stream: presets and Filters.
+// It runs after the op: after the merge, on each channel of a split
 func (c *AudioConfig) GetFilterString() string {
-	if len(c.Filters) == 0 {
+	var filters []string
+	// with G.711 the band limit runs in the codec stage instead
+	if c.PhoneSimulation != nil && c.PhoneSimulation.G711 == "" {
+		filters = append(filters, c.PhoneSimulation.filter())
+	}
+	if c.VoiceIsolation {
+		filters = append(filters, voiceIsolationFilters...)
+	}
+	if c.HighPassHz > 0 {
+		filters = append(filters, "highpass=f="+formatFloat(c.HighPassHz))
+	}
+	if c.LowPassHz > 0 {
+		filters = append(filters, "lowpass=f="+formatFloat(c.LowPassHz))
+	}
+	for _, band := range c.EQ {
+		filters = append(filters, band.filter())
+	}
+	if c.SilenceRemove != nil {
+		filters = append(filters, c.SilenceRemove.filter())
+	}
+	filters = append(filters, c.Filters...)
+	if c.Speed != 0 && c.Speed != 1 {
+		filters = append(filters, tempoFilter(c.Speed))
+	}
+	if c.PitchShift != nil && c.PitchShift.Semitones != 0 {
+		filters = append(filters, c.PitchShift.filter(c.GetOutputArg(0).SampleRate))
+	}
+	if c.Compressor != nil {
+		filters = append(filters, c.Compressor.filter())
+	}
+	if c.Loudness != "" {
+		filters = append(filters, c.Loudness.filter())
+	}
+	if c.Limiter != nil {
+		filters = append(filters, c.Limiter.filter())
+	}
+	if len(filters) == 0 {
 		return ""
 	}
 
-	return strings.Join(c.Filters, ",")
+	return strings.Join(filters, ",")
+}
+
+// MergeInputCount number of inputs joined or mixed by AUDIOMERGE
+func (c *AudioConfig) MergeInputCount() int {
+	if c.MergeFileInputs {
+		if n := max(len(c.InputFiles), c.MergeInputs); n > 0 {
+			return n
+		}
+	}
+	if len(c.InputFiles) > 0 {
+		return len(c.InputFiles)
+	}
+	if c.MergeInputs > 0 {
+		return c.MergeInputs
+	}
+	return 2
 }
 
 // If only one AudioArgs is provided in the slice, it is used for all indices.
@@ -129,20 +472,46 @@ func (c *AudioConfig) SetDefaults() {
 	}
 
 	for i := range c.InputArgs {
-		if c.InputArgs[i].SampleRate <= 0 {
-			c.InputArgs[i].SampleRate = 8000
-		}
-		if c.InputArgs[i].Channels <= 0 {
-			c.InputArgs[i].Channels = 1
-		}
+		c.InputArgs[i].setDefaults(c.Profile)
 	}
 	for i := range c.OutputArgs {
-		if c.OutputArgs[i].SampleRate <= 0 {
-			c.OutputArgs[i].SampleRate = 8000
-		}
-		if c.OutputArgs[i].Channels <= 0 {
-			c.OutputArgs[i].Channels = 1
-		}
+		c.OutputArgs[i].setDefaults(c.Profile)
+	}
+	for i := range c.EQ {
+		c.EQ[i].setDefaults()
+	}
+	if c.SilenceRemove != nil {
+		c.SilenceRemove.setDefaults()
+	}
+	if c.Compressor != nil {
+		c.Compressor.setDefaults()
+	}
+	if c.Limiter != nil {
+		c.Limiter.setDefaults()
+	}
+	if c.Degrade != nil {
+		c.Degrade.setDefaults(c.GetInputArg(0))
+	}
+	if c.Keepalive != nil {
+		c.Keepalive.setDefaults()
+	}
+	if c.BargeIn != nil {
+		c.BargeIn.setDefaults()
+	}
+	if (c.OpType == CHANNELSPLIT || c.OpType == FANOUT) && c.OutputBuffer == nil && !c.UnbufferedOutputs {
+		c.OutputBuffer = &OutputBuffer{Overflow: OverflowGrow}
+	}
+	if c.OutputBuffer != nil {
+		c.OutputBuffer.setDefaults()
+	}
+	if c.OverwritePolicy == "" {
+		c.OverwritePolicy = OverwriteAlways
+	}
+	if c.HLS != nil {
+		c.HLS.setDefaults()
+	}
+	if c.Reconnect != nil {
+		c.Reconnect.setDefaults()
 	}
 }
 
@@ -152,6 +521,14 @@ func (c *AudioConfig) Validate() error {
 		return err
 	}
 
+	if err := c.Profile.validate(); err != nil {
+		return err
+	}
+
+	if err := validateNice(c.FFmpeg.Nice); err != nil {
+		return err
+	}
+
 	if err := c.validateInputArgs(); err != nil {
 		return err
 	}
@@ -160,41 +537,94 @@ func (c *AudioConfig) Validate() error {
 		return err
 	}
 
+	if err := c.validateFilters(); err != nil {
+		return err
+	}
+
 	return c.validateOpSpecificRules()
 }
 
 // validateOpType validates the operation type
 func (c *AudioConfig) validateOpType() error {
-	validOps := map[string]bool{
-		FORMATCONVERT: true,
-		CHANNELSPLIT:  true,
-		AUDIOMERGE:    true,
-	}
-
-	if !validOps[c.OpType] {
-		return fmt.Errorf("invalid OpType: %s", c.OpType)
+	for _, op := range Ops() {
+		if op.Name == c.OpType {
+			return nil
+		}
 	}
-	return nil
+	return fmt.Errorf("invalid OpType: %s", c.OpType)
 }
 
 // validateInputArgs validates all input arguments
 func (c *AudioConfig) validateInputArgs() error {
 	for i := range c.InputArgs {
 		arg := c.GetInputArg(i)
-		isInputRaw := IsRawPCM(arg.AudioFileFormat)
+		// raw PCM and capture devices do not carry their own rate and channels
+		required := IsRawPCM(arg.AudioFileFormat) || IsSoundDevice(arg.AudioFileFormat)
 		label := fmt.Sprintf("InputArgs[%d]", i)
-		if err := arg.check(label, isInputRaw); err != nil {
+		if err := arg.check(label, required); err != nil {
 			return err
 		}
+		if IsSoundDevice(arg.AudioFileFormat) && (i >= len(c.InputFiles) || c.InputFiles[i] == "") {
+			return fmt.Errorf("%s: %s capture needs the device name in InputFiles[%d]", label, arg.AudioFileFormat, i)
+		}
+		if arg.FadeIn != 0 || arg.FadeOut != 0 {
+			return fmt.Errorf("%s: FadeIn and FadeOut apply to outputs only", label)
+		}
+	}
+	for i, f := range c.InputFiles {
+		scheme := URLScheme(f)
+		if IsSDP(f) && scheme == "" {
+			// the session description points ffmpeg at rtp/udp sockets
+			scheme = "rtp"
+		}
+		if scheme != "" && !c.RemoteAllowed(scheme) {
+			return fmt.Errorf("InputFiles[%d]: scheme %s is not in RemoteSchemes", i, scheme)
+		}
 	}
 	return nil
 }
 
+// OutputIndex index of the output declared with name in OutputArgs
+func (c *AudioConfig) OutputIndex(name string) (int, error) {
+	for i, arg := range c.OutputArgs {
+		if name != "" && arg.Name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no output named %q", name)
+}
+
 // validateOutputArgs validates all output arguments
 func (c *AudioConfig) validateOutputArgs() error {
+	names := make(map[string]bool)
+	for i, arg := range c.OutputArgs {
+		if arg.Name == "" {
+			continue
+		}
+		if names[arg.Name] {
+			return fmt.Errorf("OutputArgs[%d]: duplicate Name %q", i, arg.Name)
+		}
+		names[arg.Name] = true
+	}
 	for i := range c.OutputArgs {
 		arg := c.GetOutputArg(i)
 		label := fmt.Sprintf("OutputArgs[%d]", i)
+		if IsSoundDevice(arg.AudioFileFormat) && (i >= len(c.OutputFiles) || c.OutputFiles[i] == "") {
+			return fmt.Errorf("%s: %s playback needs the device name in OutputFiles[%d]", label, arg.AudioFileFormat, i)
+		}
+		if arg.AudioFileFormat == HLS && (i >= len(c.OutputFiles) || c.OutputFiles[i] == "") {
+			return fmt.Errorf("%s: hls needs the playlist path in OutputFiles[%d]", label, i)
+		}
+		if i < len(c.OutputFiles) && IsRTP(c.OutputFiles[i]) {
+			if err := validateRTP(label, arg); err != nil {
+				return err
+			}
+		}
+		if i < len(c.OutputFiles) && IsPushURL(c.OutputFiles[i]) {
+			if err := validatePush(label, arg, c.OutputFiles[i]); err != nil {
+				return err
+			}
+		}
 		if err := arg.check(label, true); err != nil {
 			return err
 		}
@@ -202,6 +632,109 @@ func (c *AudioConfig) validateOutputArgs() error {
 	return nil
 }
 
+// validateFilters validates the optional filter settings
+func (c *AudioConfig) validateFilters() error {
+	if c.PhoneSimulation != nil {
+		if err := c.PhoneSimulation.validate(); err != nil {
+			return err
+		}
+	}
+	if len(c.CodecStages()) > 0 && c.OpType != FORMATCONVERT && c.OpType != DEGRADE {
+		return fmt.Errorf("codec round trip is only supported by %s and %s", FORMATCONVERT, DEGRADE)
+	}
+	if c.SilenceRemove != nil {
+		if err := c.SilenceRemove.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Loudness != "" {
+		if err := c.Loudness.validate(); err != nil {
+			return err
+		}
+	}
+	if err := c.validateBands(); err != nil {
+		return err
+	}
+	if c.Compressor != nil {
+		if err := c.Compressor.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Limiter != nil {
+		if err := c.Limiter.validate(); err != nil {
+			return err
+		}
+	}
+	if c.PitchShift != nil {
+		if err := c.PitchShift.validate(c.GetOutputArg(0).SampleRate); err != nil {
+			return err
+		}
+	}
+	if c.Speed != 0 && !(c.Speed >= 0.1 && c.Speed <= 10) {
+		return fmt.Errorf("Speed must be within [0.1, 10], got %v", c.Speed)
+	}
+	if c.Impairment != nil {
+		if err := c.Impairment.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Keepalive != nil {
+		if err := c.Keepalive.validate(c.GetInputArg(0)); err != nil {
+			return err
+		}
+	}
+	if c.BargeIn != nil {
+		if err := c.BargeIn.validate(c.GetInputArg(0)); err != nil {
+			return err
+		}
+	}
+	if c.OutputBuffer != nil {
+		if c.UnbufferedOutputs {
+			return errors.New("UnbufferedOutputs can not be combined with OutputBuffer")
+		}
+		if err := c.OutputBuffer.validate(c); err != nil {
+			return err
+		}
+	}
+	if c.DeadlockTimeout < 0 {
+		return fmt.Errorf("DeadlockTimeout must be >= 0, got %v", c.DeadlockTimeout)
+	}
+	if c.PacketSize < 0 {
+		return fmt.Errorf("PacketSize must be >= 0, got %d", c.PacketSize)
+	}
+	if err := c.OverwritePolicy.validate(); err != nil {
+		return err
+	}
+	if c.HLS != nil {
+		if err := c.HLS.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Reconnect != nil {
+		if err := c.Reconnect.validate(); err != nil {
+			return err
+		}
+	}
+	if c.SimulateLive && (len(c.InputFiles) == 0 || c.InputFiles[0] == "") {
+		return errors.New("SimulateLive requires InputFiles[0]")
+	}
+	if c.VerifyDuration > 0 {
+		if c.OpType != FORMATCONVERT && c.OpType != DEGRADE {
+			return fmt.Errorf("VerifyDuration supports %s and %s only, got %s", FORMATCONVERT, DEGRADE, c.OpType)
+		}
+		if c.SilenceRemove != nil {
+			return errors.New("VerifyDuration can not be combined with SilenceRemove, it shortens the output")
+		}
+		if c.Speed != 0 && c.Speed != 1 {
+			return errors.New("VerifyDuration can not be combined with Speed, it changes the output duration")
+		}
+		if c.Keepalive != nil || c.Impairment != nil || c.SimulateLive {
+			return errors.New("VerifyDuration can not be combined with Keepalive, Impairment or SimulateLive, they change the input ffmpeg sees")
+		}
+	}
+	return nil
+}
+
 // validateOpSpecificRules validates operation-specific rules
 func (c *AudioConfig) validateOpSpecificRules() error {
 	switch c.OpType {
@@ -209,32 +742,59 @@ func (c *AudioConfig) validateOpSpecificRules() error {
 		return c.validateChannelSplit()
 	case AUDIOMERGE:
 		return c.validateAudioMerge()
+	case VADSEGMENT:
+		return c.validateVADSegment()
+	case DEGRADE:
+		return c.validateDegrade()
+	case FANOUT:
+		if len(c.OutputArgs) < 2 {
+			return errors.New("FANOUT needs at least 2 OutputArgs, one per output")
+		}
 	}
 	return nil
 }
 
+// OutputCount outputs the op produces: one per input channel for
+// CHANNELSPLIT, one per OutputArgs for FANOUT, otherwise one
+func (c *AudioConfig) OutputCount() int {
+	switch c.OpType {
+	case CHANNELSPLIT:
+		return c.GetInputArg(0).Channels
+	case FANOUT:
+		return len(c.OutputArgs)
+	}
+	return 1
+}
+
 // validateChannelSplit validates CHANNELSPLIT specific rules
 func (c *AudioConfig) validateChannelSplit() error {
 	inArg := c.GetInputArg(0)
-	if inArg.Channels != 2 {
-		return errors.New("CHANNELSPLIT requires input channels to be 2 (Stereo)")
+	if inArg.Layout() == "" || inArg.Channels < 2 {
+		return fmt.Errorf("CHANNELSPLIT requires input channels between 2 and %d, or a ChannelLayout", len(channelLayouts))
 	}
-	if len(c.OutputArgs) > 1 && len(c.OutputArgs) < 2 {
-		return errors.New("CHANNELSPLIT needs at least 2 OutputArgs for Left and Right channels")
+	if len(c.OutputArgs) > 1 && len(c.OutputArgs) < inArg.Channels {
+		return fmt.Errorf("CHANNELSPLIT needs %d OutputArgs, one per channel", inArg.Channels)
 	}
 	return nil
 }
 
 // validateAudioMerge validates AUDIOMERGE specific rules
 func (c *AudioConfig) validateAudioMerge() error {
+	count := c.MergeInputCount()
+	if count < 2 {
+		return errors.New("AUDIOMERGE needs at least 2 inputs")
+	}
 	if c.MergeMode == SideBySide {
 		outArg := c.GetOutputArg(0)
-		if outArg.Channels != 2 {
-			return errors.New("SideBySide MergeMode requires OutputArgs.Channels to be 2")
+		if outArg.Channels != count {
+			return fmt.Errorf("SideBySide MergeMode requires OutputArgs.Channels to be %d", count)
+		}
+		if _, ok := channelLayouts[count]; !ok {
+			return fmt.Errorf("SideBySide MergeMode supports at most %d inputs", len(channelLayouts))
 		}
 	}
 
-	for i := range 2 {
+	for i := range count {
 		if c.GetInputArg(i).Channels > 1 && c.MergeMode == SideBySide {
 			return fmt.Errorf("input %d must be Mono (Channels=1) for SideBySide Merge", i)
 		}
@@ -242,11 +802,49 @@ func (c *AudioConfig) validateAudioMerge() error {
 	return nil
 }
 
+// validateVADSegment validates VADSEGMENT specific rules
+func (c *AudioConfig) validateVADSegment() error {
+	outArg := c.GetOutputArg(0)
+	if outArg.AudioFileFormat != S16LE || outArg.Channels != 1 {
+		return errors.New("VADSEGMENT requires OutputArgs to be S16LE Mono")
+	}
+	return nil
+}
+
+// validateDegrade validates DEGRADE specific rules
+func (c *AudioConfig) validateDegrade() error {
+	if c.Degrade == nil {
+		return errors.New("DEGRADE requires Degrade settings")
+	}
+	return c.Degrade.Codec.check("Degrade.Codec", true)
+}
+
 // check stays as a helper to verify AudioArgs fields
 func (a *AudioArgs) check(label string, required bool) error {
 	if a.AudioFileFormat == "" {
 		return fmt.Errorf("%s: AudioFileFormat is missing", label)
 	}
+	if err := a.checkConstraint(label); err != nil {
+		return err
+	}
+	if err := a.checkLayout(label); err != nil {
+		return err
+	}
+	if a.Bitrate < 0 {
+		return fmt.Errorf("%s: Bitrate must be >= 0, got %d", label, a.Bitrate)
+	}
+	if a.VBR && a.Bitrate > 0 {
+		return fmt.Errorf("%s: Bitrate and VBR are mutually exclusive", label)
+	}
+	if a.CompressionLevel < 0 || a.CompressionLevel > 12 {
+		return fmt.Errorf("%s: CompressionLevel must be within [0, 12], got %d", label, a.CompressionLevel)
+	}
+	if math.IsNaN(a.Gain) || a.Gain < -100 || a.Gain > 60 {
+		return fmt.Errorf("%s: Gain must be within [-100, 60] dB, got %v", label, a.Gain)
+	}
+	if a.FadeIn < 0 || a.FadeOut < 0 {
+		return fmt.Errorf("%s: FadeIn and FadeOut must be >= 0", label)
+	}
 
 	if required {
 		if a.SampleRate <= 0 {
@@ -258,3 +856,36 @@ func (a *AudioArgs) check(label string, required bool) error {
 	}
 	return nil
 }
+
+// formatConstraint fixed parameters a codec requires, zero means any
+type formatConstraint struct {
+	sampleRate int
+	channels   int
+}
+
+// formatConstraints checked by Validate so bad combinations fail with a clear
+// message instead of an obscure ffmpeg runtime error
+var formatConstraints = map[AudioFileFormat]formatConstraint{
+	MULAW: {sampleRate: 8000},
+	ALAW:  {sampleRate: 8000},
+	G722:  {sampleRate: 16000, channels: 1},
+	G729:  {sampleRate: 8000, channels: 1},
+	GSM:   {sampleRate: 8000, channels: 1},
+	AMRNB: {sampleRate: 8000, channels: 1},
+	AMRWB: {sampleRate: 16000, channels: 1},
+}
+
+// checkConstraint validates SampleRate and Channels against formatConstraints
+func (a *AudioArgs) checkConstraint(label string) error {
+	c, ok := formatConstraints[a.AudioFileFormat]
+	if !ok {
+		return nil
+	}
+	if c.sampleRate != 0 && a.SampleRate != c.sampleRate {
+		return fmt.Errorf("%s: %s requires SampleRate %d, got %d", label, a.AudioFileFormat, c.sampleRate, a.SampleRate)
+	}
+	if c.channels != 0 && a.Channels != c.channels {
+		return fmt.Errorf("%s: %s requires Channels %d, got %d", label, a.AudioFileFormat, c.channels, a.Channels)
+	}
+	return nil
+}
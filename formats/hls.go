@@ -0,0 +1,51 @@
+package formats
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// HLSOptions segmenting of HLS outputs
+type HLSOptions struct {
+	// SegmentDuration target length of each segment, default 2s
+	SegmentDuration time.Duration
+	// PlaylistSize segments listed in the live playlist, default 6
+	PlaylistSize int
+	// Fragmented writes fMP4 .m4s segments instead of MPEG-TS .ts
+	Fragmented bool
+	// KeepSegments keeps segments that left the playlist on disk, by default
+	// they are deleted so a long call does not fill the disk
+	KeepSegments bool
+}
+
+func (h *HLSOptions) setDefaults() {
+	if h.SegmentDuration <= 0 {
+		h.SegmentDuration = 2 * time.Second
+	}
+	if h.PlaylistSize <= 0 {
+		h.PlaylistSize = 6
+	}
+}
+
+func (h *HLSOptions) validate() error {
+	if h.SegmentDuration < 100*time.Millisecond {
+		return fmt.Errorf("HLS: SegmentDuration must be >= 100ms, got %v", h.SegmentDuration)
+	}
+	return nil
+}
+
+// args hls muxer options
+func (h HLSOptions) args() []string {
+	args := []string{
+		"-hls_time", formatFloat(h.SegmentDuration.Seconds()),
+		"-hls_list_size", strconv.Itoa(h.PlaylistSize),
+	}
+	if h.Fragmented {
+		args = append(args, "-hls_segment_type", "fmp4")
+	}
+	if !h.KeepSegments {
+		args = append(args, "-hls_flags", "delete_segments")
+	}
+	return args
+}
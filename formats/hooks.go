@@ -0,0 +1,44 @@
+package formats
+
+import "sync"
+
+// ArgHook returns extra ffmpeg options for a stream, e.g. codec flags
+type ArgHook func(arg AudioArgs) []string
+
+var (
+	hooksMu     sync.RWMutex
+	inputHooks  = map[AudioFileFormat]ArgHook{}
+	outputHooks = map[AudioFileFormat]ArgHook{}
+)
+
+// RegisterInputHook adds options before "-f <fmt> -i" of every input in format f,
+// nil removes the hook
+func RegisterInputHook(f AudioFileFormat, hook ArgHook) {
+	registerHook(inputHooks, f, hook)
+}
+
+// RegisterOutputHook adds options before "-f <fmt> target" of every output in format f,
+// nil removes the hook
+func RegisterOutputHook(f AudioFileFormat, hook ArgHook) {
+	registerHook(outputHooks, f, hook)
+}
+
+func registerHook(hooks map[AudioFileFormat]ArgHook, f AudioFileFormat, hook ArgHook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	if hook == nil {
+		delete(hooks, f)
+		return
+	}
+	hooks[f] = hook
+}
+
+func runHook(hooks map[AudioFileFormat]ArgHook, arg AudioArgs) []string {
+	hooksMu.RLock()
+	hook := hooks[arg.AudioFileFormat]
+	hooksMu.RUnlock()
+	if hook == nil {
+		return nil
+	}
+	return hook(arg)
+}
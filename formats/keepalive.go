@@ -0,0 +1,53 @@
+package formats
+
+import (
+	"fmt"
+	"time"
+)
+
+// Keepalive fills Stream mode input 0 with silence or comfort noise while the
+// writer stalls, so outputs feeding RTP or ASR keep flowing. Input 0 must be S16LE, S24LE, F32LE or F64LE
+type Keepalive struct {
+	// After how long input may stall before filling starts, default 200ms
+	After time.Duration
+	// Frame length of each filler chunk, default 20ms
+	Frame time.Duration
+	// Noise fills with comfort noise at NoiseDB instead of digital silence
+	Noise bool
+	// NoiseDB comfort noise RMS level in dBFS, default -60
+	NoiseDB float64
+	// MatchNoiseFloor tracks the noise floor of the written input and uses it
+	// as the comfort noise level, NoiseDB applies until one is measured
+	MatchNoiseFloor bool
+}
+
+func (k *Keepalive) setDefaults() {
+	if k.After <= 0 {
+		k.After = 200 * time.Millisecond
+	}
+	if k.Frame <= 0 {
+		k.Frame = 20 * time.Millisecond
+	}
+	if k.NoiseDB == 0 {
+		k.NoiseDB = -60
+	}
+}
+
+func (k *Keepalive) validate(input AudioArgs) error {
+	if !meterable(input.AudioFileFormat) {
+		return fmt.Errorf("Keepalive: InputArgs[0] must be s16le, s24le, f32le or f64le, got %s", input.AudioFileFormat)
+	}
+	if k.MatchNoiseFloor && !k.Noise {
+		return fmt.Errorf("Keepalive: MatchNoiseFloor requires Noise")
+	}
+	if k.NoiseDB > 0 {
+		return fmt.Errorf("Keepalive: NoiseDB must be <= 0, got %v", k.NoiseDB)
+	}
+	return nil
+}
+
+// FrameBytes size of one filler frame of input, whole samples on every channel
+func (k *Keepalive) FrameBytes(input AudioArgs) int {
+	samples := int(int64(k.Frame) * int64(input.SampleRate) / int64(time.Second))
+	return max(samples, 1) * input.Channels * SampleBytes(input.AudioFileFormat)
+}
@@ -0,0 +1,78 @@
+package formats
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChannelLayout ffmpeg channel layout, a name such as "5.1" or a custom
+// channel list joined by '+', e.g. "FL+FR+LFE"
+type ChannelLayout string
+
+const (
+	LayoutMono   ChannelLayout = "mono"
+	LayoutStereo ChannelLayout = "stereo"
+	Layout51     ChannelLayout = "5.1"
+	Layout71     ChannelLayout = "7.1"
+)
+
+// channelLayouts ffmpeg layout name by channel count
+var channelLayouts = map[int]string{
+	1: "mono",
+	2: "stereo",
+	3: "3.0",
+	4: "quad",
+	5: "5.0",
+	6: "5.1",
+	7: "6.1",
+	8: "7.1",
+}
+
+// namedLayoutChannels channel count of the named layouts accepted in ChannelLayout
+var namedLayoutChannels = map[ChannelLayout]int{
+	"mono": 1, "stereo": 2, "2.1": 3, "3.0": 3, "quad": 4,
+	"4.0": 4, "5.0": 5, "5.1": 6, "6.1": 7, "7.1": 8,
+}
+
+// Channels channel count of the layout, 0 when unknown
+func (l ChannelLayout) Channels() int {
+	if n, ok := namedLayoutChannels[l]; ok {
+		return n
+	}
+	if strings.Contains(string(l), "+") {
+		return len(strings.Split(string(l), "+"))
+	}
+	return 0
+}
+
+// Layout the explicit ChannelLayout, or the default layout for Channels
+func (a AudioArgs) Layout() ChannelLayout {
+	if a.ChannelLayout != "" {
+		return a.ChannelLayout
+	}
+	return ChannelLayout(channelLayouts[a.Channels])
+}
+
+// defaultChannels derives a missing Channels from ChannelLayout
+func (a *AudioArgs) defaultChannels() {
+	if a.Channels <= 0 && a.ChannelLayout != "" {
+		a.Channels = a.ChannelLayout.Channels()
+	}
+}
+
+func (a *AudioArgs) checkLayout(label string) error {
+	if a.ChannelLayout == "" {
+		return nil
+	}
+	if err := CheckFilterArg(string(a.ChannelLayout)); err != nil {
+		return fmt.Errorf("%s: ChannelLayout: %w", label, err)
+	}
+	n := a.ChannelLayout.Channels()
+	if n == 0 {
+		return fmt.Errorf("%s: unknown ChannelLayout %q", label, a.ChannelLayout)
+	}
+	if n != a.Channels {
+		return fmt.Errorf("%s: ChannelLayout %s has %d channels, Channels is %d", label, a.ChannelLayout, n, a.Channels)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package formats
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	niceMu sync.RWMutex
+	opNice = map[OpType]int{}
+)
+
+// SetDefaultNice niceness of every ffmpeg run of op whose config leaves
+// FFmpeg.Nice nil, e.g. 10 for VADSEGMENT analysis and -5 for live
+// FORMATCONVERT. Set it once at startup, negative values need CAP_SYS_NICE
+func SetDefaultNice(op OpType, nice int) {
+	niceMu.Lock()
+	defer niceMu.Unlock()
+	opNice[op] = nice
+}
+
+// ClearDefaultNice drops the SetDefaultNice value of op
+func ClearDefaultNice(op OpType) {
+	niceMu.Lock()
+	defer niceMu.Unlock()
+	delete(opNice, op)
+}
+
+// Nice niceness ffmpeg runs at: FFmpeg.Nice, else the SetDefaultNice value
+// of OpType. ok false keeps the niceness inherited from this process
+func (c *AudioConfig) Nice() (nice int, ok bool) {
+	if c.FFmpeg.Nice != nil {
+		return *c.FFmpeg.Nice, true
+	}
+	op := c.OpType
+	if op == "" {
+		op = FORMATCONVERT
+	}
+	niceMu.RLock()
+	defer niceMu.RUnlock()
+	nice, ok = opNice[op]
+	return nice, ok
+}
+
+func validateNice(nice *int) error {
+	if nice != nil && (*nice < -20 || *nice > 19) {
+		return fmt.Errorf("FFmpeg.Nice must be within -20..19, got %d", *nice)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package formats
+
+import "fmt"
+
+// OverwritePolicy what File mode does with an output file that already exists
+type OverwritePolicy string
+
+const (
+	// OverwriteAlways replaces it, the default
+	OverwriteAlways OverwritePolicy = "overwrite"
+	// OverwriteFail fails Init with ErrOutputExists
+	OverwriteFail OverwritePolicy = "fail"
+	// OverwriteAutoRename writes next to it as name-1.ext, name-2.ext, ...
+	OverwriteAutoRename OverwritePolicy = "autorename"
+)
+
+func (p OverwritePolicy) validate() error {
+	switch p {
+	case "", OverwriteAlways, OverwriteFail, OverwriteAutoRename:
+		return nil
+	}
+	return fmt.Errorf("unknown OverwritePolicy %q", p)
+}
@@ -0,0 +1,64 @@
+package formats
+
+// Presets ready FORMATCONVERT configs for common jobs, in describes the
+// source, e.g. AudioArgs{AudioFileFormat: WAV} for a call recording or
+// {S16LE, 8000, 1} for a raw stream. Add InputFiles/OutputFiles for File mode.
+// Every preset validates with any valid in
+
+// PresetTelephonyULaw G.711 µ-law 8 kHz mono, raw, as carried by RTP and most PBXs
+func PresetTelephonyULaw(in AudioArgs) AudioConfig {
+	return preset(in, AudioArgs{AudioFileFormat: MULAW, SampleRate: 8000, Channels: 1}, ProfileTelephony)
+}
+
+// PresetTelephonyALaw G.711 A-law 8 kHz mono, raw, the European PSTN codec
+func PresetTelephonyALaw(in AudioArgs) AudioConfig {
+	return preset(in, AudioArgs{AudioFileFormat: ALAW, SampleRate: 8000, Channels: 1}, ProfileTelephony)
+}
+
+// PresetCallRecordingWAV µ-law inside WAV 8 kHz mono, playable anywhere at telephony size
+func PresetCallRecordingWAV(in AudioArgs) AudioConfig {
+	return preset(in, AudioArgs{AudioFileFormat: WAV, SampleRate: 8000, Channels: 1, Codec: "pcm_mulaw"}, ProfileTelephony)
+}
+
+// PresetASR16k 16-bit little endian PCM 16 kHz mono, what speech recognizers expect
+func PresetASR16k(in AudioArgs) AudioConfig {
+	return preset(in, AudioArgs{AudioFileFormat: S16LE, SampleRate: 16000, Channels: 1}, ProfileTelephony)
+}
+
+// PresetASR16kWAV PresetASR16k inside WAV, for recognizers taking files
+func PresetASR16kWAV(in AudioArgs) AudioConfig {
+	return preset(in, AudioArgs{AudioFileFormat: WAV, SampleRate: 16000, Channels: 1}, ProfileTelephony)
+}
+
+// PresetPodcastMP3 MP3 44.1 kHz stereo at 128 kbit/s CBR
+func PresetPodcastMP3(in AudioArgs) AudioConfig {
+	return preset(in, AudioArgs{AudioFileFormat: MP3, SampleRate: 44100, Channels: 2, Bitrate: 128000}, ProfileMusic)
+}
+
+// PresetVoiceOpus Opus in Ogg 48 kHz mono at 32 kbit/s, for voice notes and WebRTC
+func PresetVoiceOpus(in AudioArgs) AudioConfig {
+	return preset(in, AudioArgs{AudioFileFormat: OPUS, SampleRate: 48000, Channels: 1, Bitrate: 32000}, ProfileBroadcast)
+}
+
+// PresetArchiveFLAC lossless FLAC 48 kHz stereo
+func PresetArchiveFLAC(in AudioArgs) AudioConfig {
+	return preset(in, AudioArgs{AudioFileFormat: FLAC, SampleRate: 48000, Channels: 2}, ProfileBroadcast)
+}
+
+// PresetStereoAndMono FANOUT of a stereo WAV archive at the input rate,
+// output "stereo", and a PresetASR16k mono downmix, output "mono", from one ffmpeg
+func PresetStereoAndMono(in AudioArgs) AudioConfig {
+	cfg := preset(in, AudioArgs{AudioFileFormat: WAV, SampleRate: in.SampleRate, Channels: 2, Name: "stereo"}, ProfileBroadcast)
+	cfg.OpType = FANOUT
+	cfg.OutputArgs = append(cfg.OutputArgs, AudioArgs{AudioFileFormat: S16LE, SampleRate: 16000, Channels: 1, Name: "mono"})
+	return cfg
+}
+
+func preset(in, out AudioArgs, profile DefaultProfile) AudioConfig {
+	return AudioConfig{
+		OpType:     FORMATCONVERT,
+		Profile:    profile,
+		InputArgs:  []AudioArgs{in},
+		OutputArgs: []AudioArgs{out},
+	}
+}
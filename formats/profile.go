@@ -0,0 +1,54 @@
+package formats
+
+import "fmt"
+
+// DefaultProfile sample rate and channels SetDefaults fills in when they are missing
+type DefaultProfile string
+
+const (
+	// ProfileTelephony 8 kHz mono
+	ProfileTelephony DefaultProfile = "telephony"
+	// ProfileBroadcast 48 kHz stereo
+	ProfileBroadcast DefaultProfile = "broadcast"
+	// ProfileMusic 44.1 kHz stereo
+	ProfileMusic DefaultProfile = "music"
+)
+
+var profileDefaults = map[DefaultProfile]struct {
+	sampleRate int
+	channels   int
+}{
+	ProfileTelephony: {sampleRate: 8000, channels: 1},
+	ProfileBroadcast: {sampleRate: 48000, channels: 2},
+	ProfileMusic:     {sampleRate: 44100, channels: 2},
+}
+
+func (p DefaultProfile) validate() error {
+	if _, ok := profileDefaults[p]; !ok && p != "" {
+		return fmt.Errorf("invalid Profile: %s", p)
+	}
+	return nil
+}
+
+// setDefaults format constraints win over the profile, e.g. AMR-WB is always 16 kHz mono
+func (a *AudioArgs) setDefaults(profile DefaultProfile) {
+	def, ok := profileDefaults[profile]
+	if !ok {
+		def = profileDefaults[ProfileTelephony]
+	}
+	constraint := formatConstraints[a.AudioFileFormat]
+
+	a.defaultChannels()
+	if a.SampleRate <= 0 {
+		a.SampleRate = def.sampleRate
+		if constraint.sampleRate != 0 {
+			a.SampleRate = constraint.sampleRate
+		}
+	}
+	if a.Channels <= 0 {
+		a.Channels = def.channels
+		if constraint.channels != 0 {
+			a.Channels = constraint.channels
+		}
+	}
+}
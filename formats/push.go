@@ -0,0 +1,92 @@
+package formats
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IsPushURL target is an rtmp://, rtmps:// or icecast:// server the output is pushed to
+func IsPushURL(target string) bool {
+	return isRTMP(target) || strings.HasPrefix(target, "icecast://")
+}
+
+func isRTMP(target string) bool {
+	return strings.HasPrefix(target, "rtmp://") || strings.HasPrefix(target, "rtmps://")
+}
+
+// Reconnect keeps pushing to rtmp:// and icecast:// outputs across dropped
+// connections through ffmpeg's fifo muxer, packets are dropped while it is down
+type Reconnect struct {
+	// Delay between attempts, default 1s
+	Delay time.Duration
+	// MaxAttempts per outage, 0 retries forever
+	MaxAttempts int
+}
+
+func (r *Reconnect) setDefaults() {
+	if r.Delay <= 0 {
+		r.Delay = time.Second
+	}
+}
+
+func (r *Reconnect) validate() error {
+	if r.MaxAttempts < 0 {
+		return fmt.Errorf("Reconnect: MaxAttempts must be >= 0, got %d", r.MaxAttempts)
+	}
+	return nil
+}
+
+// icecastTypes content type announced to the icecast server per format
+var icecastTypes = map[AudioFileFormat]string{
+	MP3:  "audio/mpeg",
+	AAC:  "audio/aac",
+	OGG:  "application/ogg",
+	OPUS: "audio/ogg",
+}
+
+func validatePush(label string, arg AudioArgs, target string) error {
+	if isRTMP(target) {
+		if arg.AudioFileFormat != AAC && arg.AudioFileFormat != MP3 {
+			return fmt.Errorf("%s: rtmp carries aac or mp3, got %s", label, arg.AudioFileFormat)
+		}
+		return nil
+	}
+	if _, ok := icecastTypes[arg.AudioFileFormat]; !ok {
+		return fmt.Errorf("%s: icecast streams mp3, aac, ogg or opus, got %s", label, arg.AudioFileFormat)
+	}
+	return nil
+}
+
+// pushArgs rewrites the trailing "-f muxer target" of a push output: icecast
+// announces its content type, Reconnect wraps the muxer in fifo
+func pushArgs(args []string, arg AudioArgs, target string, r *Reconnect) []string {
+	n := len(args) - 3
+	muxer := args[n+1]
+	ct, icecast := icecastTypes[arg.AudioFileFormat]
+	icecast = icecast && !isRTMP(target)
+	if r == nil {
+		if icecast {
+			return slices.Concat(args[:n], []string{"-content_type", ct}, args[n:])
+		}
+		return args
+	}
+	rc := *r
+	rc.setDefaults()
+	fifo := []string{
+		"-f", "fifo", "-fifo_format", muxer,
+		"-attempt_recovery", "1", "-recover_any_error", "1",
+		"-recovery_wait_time", formatFloat(rc.Delay.Seconds()),
+		"-drop_pkts_on_overflow", "1",
+	}
+	if rc.MaxAttempts > 0 {
+		fifo = append(fifo, "-max_recovery_attempts", strconv.Itoa(rc.MaxAttempts))
+	}
+	if icecast {
+		// fifo opens the url itself, protocol options travel in format_opts
+		fifo = append(fifo, "-format_opts", "content_type="+ct)
+	}
+	return slices.Concat(args[:n], fifo, []string{target})
+}
@@ -0,0 +1,51 @@
+package formats
+
+import (
+	"slices"
+	"strings"
+)
+
+var defaultRemoteSchemes = []string{"http", "https", "ftp", "udp", "tcp", "rtp", "zmq"}
+
+// URLScheme lower case scheme of a "scheme://" url or "zmq" of a zmq: socket,
+// "" for local paths
+func URLScheme(source string) string {
+	if strings.HasPrefix(source, "zmq:") {
+		return "zmq"
+	}
+	scheme, _, ok := strings.Cut(source, "://")
+	if !ok || scheme == "" || strings.ContainsAny(scheme, `/\`) {
+		return ""
+	}
+	return strings.ToLower(scheme)
+}
+
+// RemoteAllowed scheme is in RemoteSchemes, or one of the default http, https,
+// ftp, udp, tcp, rtp and zmq when nil
+func (c *AudioConfig) RemoteAllowed(scheme string) bool {
+	schemes := c.RemoteSchemes
+	if schemes == nil {
+		schemes = defaultRemoteSchemes
+	}
+	return slices.ContainsFunc(schemes, func(s string) bool { return strings.EqualFold(s, scheme) })
+}
+
+// protocolWhitelist keeps ffmpeg on the protocols a remote url needs, so a
+// redirect or a playlist entry can not reach file: or other local protocols
+func protocolWhitelist(source string) string {
+	switch scheme := URLScheme(source); scheme {
+	case "":
+		return ""
+	case "http", "https":
+		return "http,https,tls,tcp"
+	case "ftp":
+		return "ftp,tcp"
+	case "udp", "tcp", "zmq":
+		return scheme
+	case "rtp":
+		return "rtp,udp"
+	default:
+		// a custom scheme of RemoteSchemes on the usual transports
+		return scheme + ",tls,tcp,udp"
+	}
+}
@@ -0,0 +1,57 @@
+package formats
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// IsRTP target is an rtp:// url
+func IsRTP(target string) bool {
+	return strings.HasPrefix(target, "rtp://")
+}
+
+// IsSDP source is an SDP file describing an incoming RTP session, needed
+// when its payload types are dynamic
+func IsSDP(source string) bool {
+	return strings.EqualFold(filepath.Ext(source), ".sdp")
+}
+
+// rtpPayloads encoder and static payload type of the formats RTP carries, -1 is dynamic
+var rtpPayloads = map[AudioFileFormat]struct {
+	codec string
+	pt    int
+}{
+	MULAW: {"pcm_mulaw", 0},
+	GSM:   {"gsm", 3},
+	ALAW:  {"pcm_alaw", 8},
+	G722:  {"g722", 9},
+	S16BE: {"pcm_s16be", -1},
+	OPUS:  {"libopus", -1},
+}
+
+// rtpPayload encoder and payload type of arg over RTP, Codec and PayloadType win
+func rtpPayload(arg AudioArgs) (string, int) {
+	p := rtpPayloads[arg.AudioFileFormat]
+	codec, pt := p.codec, p.pt
+	if arg.Codec != "" {
+		codec = arg.Codec
+	}
+	if pt < 0 {
+		pt = 96
+	}
+	if arg.PayloadType > 0 {
+		pt = arg.PayloadType
+	}
+	return codec, pt
+}
+
+func validateRTP(label string, arg AudioArgs) error {
+	if _, ok := rtpPayloads[arg.AudioFileFormat]; !ok {
+		return fmt.Errorf("%s: %s can not be sent over RTP, use mulaw, alaw, g722, gsm, s16be or opus", label, arg.AudioFileFormat)
+	}
+	if arg.PayloadType < 0 || arg.PayloadType > 127 {
+		return fmt.Errorf("%s: PayloadType must be 0-127, got %d", label, arg.PayloadType)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package formats
+
+// CodecStage an extra ffmpeg process chained in front of the main one.
+// It applies Filter and encodes to Codec, so the main process decodes
+// audio that went through a real codec round trip
+type CodecStage struct {
+	Filter string
+	Codec  AudioArgs
+}
+
+// CodecStages returns the stages to chain before the main process, in order
+func (c *AudioConfig) CodecStages() []CodecStage {
+	var stages []CodecStage
+	if p := c.PhoneSimulation; p != nil && p.G711 != "" {
+		stages = append(stages, CodecStage{
+			Filter: p.filter(),
+			Codec:  AudioArgs{AudioFileFormat: p.G711, SampleRate: 8000, Channels: 1},
+		})
+	}
+	if d := c.Degrade; d != nil && c.OpType == DEGRADE {
+		for range d.Times {
+			stages = append(stages, CodecStage{Codec: d.Codec})
+		}
+	}
+	return stages
+}
+
+// MainInputArg input args of the main process, it reads the last stage codec when stages exist
+func (c *AudioConfig) MainInputArg(index int) AudioArgs {
+	if stages := c.CodecStages(); len(stages) > 0 {
+		return stages[len(stages)-1].Codec
+	}
+	return c.GetInputArg(index)
+}
+
+// BuildStageArgs: input -> filter -> codec on pipe:1
+func BuildStageArgs(stage CodecStage, input AudioArgs, source string) []string {
+	args := BuildInputArgs(input, source)
+	if stage.Filter != "" {
+		args = append(args, "-af", stage.Filter)
+	}
+	args = append(args, BuildOutputArgs(stage.Codec, "pipe:1")...)
+	return args
+}
+
+// BuildStagesArgs args of every stage, the first one reads source, the others read pipe:0
+func BuildStagesArgs(cfg *AudioConfig, source string) [][]string {
+	var all [][]string
+	input := cfg.GetInputArg(0)
+	for _, stage := range cfg.CodecStages() {
+		all = append(all, BuildStageArgs(stage, input, source))
+		input, source = stage.Codec, "pipe:0"
+	}
+	return all
+}
@@ -0,0 +1,125 @@
+package audiogo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// InputWriter adapts input index to io.WriteCloser, Close ends only that input
+func (ae *AudioEngine) InputWriter(index int) io.WriteCloser {
+	return &inputWriter{engine: ae, index: index}
+}
+
+// OutputReader adapts output index to io.Reader, e.g. for io.Copy or bufio
+func (ae *AudioEngine) OutputReader(index int) io.Reader {
+	return &outputReader{engine: ae, index: index}
+}
+
+// Reader OutputReader of the output declared with name in OutputArgs
+func (ae *AudioEngine) Reader(name string) (io.Reader, error) {
+	i, err := ae.config.OutputIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	return ae.OutputReader(i), nil
+}
+
+type inputWriter struct {
+	engine *AudioEngine
+	index  int
+}
+
+func (w *inputWriter) Write(p []byte) (int, error) {
+	if err := w.engine.write(w.index, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *inputWriter) Close() error {
+	w.engine.recorder.record(recCloseInput, w.index, nil)
+	return w.engine.processor.CloseInputAt(w.index)
+}
+
+type outputReader struct {
+	engine *AudioEngine
+	index  int
+}
+
+func (r *outputReader) Read(p []byte) (int, error) {
+	return r.engine.read(r.index, p)
+}
+
+// OutputChan drains output index in chunks of up to chunkSize bytes, 4096 when
+// chunkSize <= 0. Every chunk is a fresh slice owned by the receiver. The
+// channel closes on EOF, a read error or once ctx ends, a receiver that stops
+// early cancels ctx. After the close readErr returns the read error, nil on
+// EOF or cancellation
+func (ae *AudioEngine) OutputChan(ctx context.Context, index int, chunkSize int) (chunks <-chan []byte, readErr func() error) {
+	if chunkSize <= 0 {
+		chunkSize = 4096
+	}
+	ch := make(chan []byte)
+	var err error
+	go func() {
+		defer close(ch)
+		for {
+			buf := make([]byte, chunkSize)
+			n, rerr := ae.read(index, buf)
+			if n > 0 {
+				select {
+				case ch <- buf[:n]:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if rerr != nil {
+				if rerr != io.EOF {
+					err = rerr
+				}
+				return
+			}
+		}
+	}()
+	return ch, func() error { return err }
+}
+
+// OnOutput drives fn from an internal goroutine with every chunk of output
+// index, call it after Start. The last call has nil data and the read error,
+// io.EOF on a clean end. data is only valid during the call, copy it to keep it
+func (ae *AudioEngine) OnOutput(index int, fn func(data []byte, err error)) error {
+	ae.mu.Lock()
+	running := ae.running
+	ae.mu.Unlock()
+	if !running {
+		return fmt.Errorf("engine not running")
+	}
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := ae.read(index, buf)
+			if n > 0 {
+				fn(buf[:n], nil)
+			}
+			if err != nil {
+				fn(nil, err)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// OutputFile underlying pipe of output index for passing to another process,
+// Stream mode only. The engine owns it, see StreamHandle.OutputFile
+func (ae *AudioEngine) OutputFile(index int) (*os.File, error) {
+	if !ae.running {
+		return nil, fmt.Errorf("engine not running")
+	}
+	if p, ok := ae.processor.(interface{ OutputFile(int) (*os.File, error) }); ok {
+		return p.OutputFile(index)
+	}
+	return nil, fmt.Errorf("output files are only exposed by ffmpeg Stream engines")
+}
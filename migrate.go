@@ -0,0 +1,255 @@
+package audiogo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// MigrateOptions settings of an archive migration
+type MigrateOptions struct {
+	// Target spec every file ends up in, zero SampleRate/Channels keep the source value
+	Target formats.AudioArgs
+	// Ext output extension without dot, defaults to the target format name
+	Ext string
+	// DestDir root of the mirrored output tree, empty writes next to each source
+	DestDir string
+	// Match filters walked files, nil takes every regular file
+	Match func(path string) bool
+	// DurationTolerance allowed gap between source and output duration, default 50ms
+	DurationTolerance time.Duration
+	// Workers parallel conversions, default 1
+	Workers int
+	// Audit receives one JSON MigrateRecord per line, nil disables it
+	Audit io.Writer
+	// FFmpeg binary discovery for the conversions and ffprobe
+	FFmpeg formats.FFmpegOptions
+}
+
+// MigrateAction outcome of one file
+type MigrateAction string
+
+const (
+	MigrateSkipped   MigrateAction = "skipped"
+	MigrateConverted MigrateAction = "converted"
+	MigrateFailed    MigrateAction = "failed"
+)
+
+// MigrateRecord audit line of one file
+type MigrateRecord struct {
+	Source         string
+	Output         string `json:",omitempty"`
+	Action         MigrateAction
+	SourceDuration time.Duration `json:",omitempty"`
+	OutputDuration time.Duration `json:",omitempty"`
+	// SourceSHA256/OutputSHA256 tie the audit to the exact bytes
+	SourceSHA256 string `json:",omitempty"`
+	OutputSHA256 string `json:",omitempty"`
+	Error        string `json:",omitempty"`
+}
+
+// MigrateSummary counts of a finished migration
+type MigrateSummary struct {
+	Converted int
+	Skipped   int
+	Failed    int
+}
+
+// Migrate walks root, probes every file, skips those already matching
+// opts.Target and converts the rest, verifying the output duration against
+// the source. Per-file failures are recorded and counted, the returned error
+// reports a walk failure, ctx cancellation or a failed Audit write, which
+// stops the walk
+func Migrate(ctx context.Context, root string, opts MigrateOptions) (MigrateSummary, error) {
+	if opts.Target.AudioFileFormat == "" {
+		return MigrateSummary{}, fmt.Errorf("migrate: Target.AudioFileFormat is required")
+	}
+	if opts.Ext == "" {
+		opts.Ext = string(opts.Target.AudioFileFormat)
+	}
+	if opts.DurationTolerance <= 0 {
+		opts.DurationTolerance = 50 * time.Millisecond
+	}
+	opts.Workers = max(opts.Workers, 1)
+
+	var (
+		mu       sync.Mutex
+		summary  MigrateSummary
+		auditErr error
+		wg       sync.WaitGroup
+	)
+	record := func(rec MigrateRecord) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch rec.Action {
+		case MigrateConverted:
+			summary.Converted++
+		case MigrateSkipped:
+			summary.Skipped++
+		default:
+			summary.Failed++
+		}
+		if opts.Audit != nil && auditErr == nil {
+			line, _ := json.Marshal(rec)
+			if _, err := opts.Audit.Write(append(line, '\n')); err != nil {
+				auditErr = fmt.Errorf("migrate: audit: %w", err)
+			}
+		}
+	}
+	failedAudit := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return auditErr
+	}
+
+	paths := make(chan string)
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				record(migrateFile(ctx, root, path, &opts))
+			}
+		}()
+	}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// an unrecorded conversion is worse than none, stop at the first audit failure
+		if err := failedAudit(); err != nil {
+			return err
+		}
+		// a DestDir inside root must not be migrated again
+		if d.IsDir() && opts.DestDir != "" && filepath.Clean(path) == filepath.Clean(opts.DestDir) {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() || (opts.Match != nil && !opts.Match(path)) {
+			return nil
+		}
+		select {
+		case paths <- path:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(paths)
+	wg.Wait()
+	if err == nil {
+		err = failedAudit()
+	}
+	return summary, err
+}
+
+func migrateFile(ctx context.Context, root, path string, opts *MigrateOptions) MigrateRecord {
+	rec := MigrateRecord{Source: path, Action: MigrateFailed}
+	fail := func(err error) MigrateRecord {
+		rec.Error = err.Error()
+		return rec
+	}
+
+	info, err := ProbeWith(ctx, opts.FFmpeg, path)
+	if err != nil {
+		return fail(err)
+	}
+	rec.SourceDuration = info.Duration
+	if rec.SourceSHA256, err = fileSHA256(path); err != nil {
+		return fail(err)
+	}
+	inFormat, err := info.Format()
+	if err != nil {
+		return fail(err)
+	}
+	target := opts.Target
+	if matchesTarget(info, inFormat, target) {
+		rec.Action = MigrateSkipped
+		return rec
+	}
+
+	rec.Output, err = migrateOutputPath(root, path, opts)
+	if err != nil {
+		return fail(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(rec.Output), 0755); err != nil {
+		return fail(err)
+	}
+	in := info.AudioArgs()
+	in.AudioFileFormat = inFormat
+	cfg := formats.AudioConfig{
+		InputArgs:   []formats.AudioArgs{in},
+		OutputArgs:  []formats.AudioArgs{target},
+		InputFiles:  []string{path},
+		OutputFiles: []string{rec.Output},
+		FFmpeg:      opts.FFmpeg,
+	}
+	if _, err := RunFile(ctx, cfg); err != nil {
+		return fail(err)
+	}
+
+	out, err := ProbeWith(ctx, opts.FFmpeg, rec.Output)
+	if err != nil {
+		return fail(fmt.Errorf("verify output: %w", err))
+	}
+	rec.OutputDuration = out.Duration
+	if gap := (out.Duration - info.Duration).Abs(); gap > opts.DurationTolerance {
+		return fail(fmt.Errorf("verify output: duration %v differs from source %v by %v", out.Duration, info.Duration, gap))
+	}
+	if rec.OutputSHA256, err = fileSHA256(rec.Output); err != nil {
+		return fail(err)
+	}
+	rec.Action = MigrateConverted
+	return rec
+}
+
+// matchesTarget source of format f already has the target format, rate and channels
+func matchesTarget(info *MediaInfo, f formats.AudioFileFormat, target formats.AudioArgs) bool {
+	if f != target.AudioFileFormat {
+		return false
+	}
+	if target.SampleRate > 0 && info.SampleRate != target.SampleRate {
+		return false
+	}
+	return target.Channels <= 0 || info.Channels == target.Channels
+}
+
+// migrateOutputPath mirrors path under DestDir with the target extension,
+// it refuses to overwrite the source
+func migrateOutputPath(root, path string, opts *MigrateOptions) (string, error) {
+	out := strings.TrimSuffix(path, filepath.Ext(path)) + "." + opts.Ext
+	if opts.DestDir != "" {
+		rel, err := filepath.Rel(root, out)
+		if err != nil {
+			return "", err
+		}
+		out = filepath.Join(opts.DestDir, rel)
+	}
+	if out == path {
+		return "", fmt.Errorf("output would overwrite the source, set DestDir")
+	}
+	return out, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,54 @@
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Getter streams objects, e.g. an S3 GetObject body or a presigned url
+type Getter interface {
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// Part one uploaded part of a multipart upload, Number starts at 1
+type Part struct {
+	Number int
+	ETag   string
+}
+
+// Uploader multipart uploads in the S3 model, wrap the SDK of your store.
+// UploadPart owns data, Writer never reuses it
+type Uploader interface {
+	CreateMultipart(ctx context.Context, key string) (uploadID string, err error)
+	UploadPart(ctx context.Context, key, uploadID string, number int, data []byte) (etag string, err error)
+	CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error
+	AbortMultipart(ctx context.Context, key, uploadID string) error
+}
+
+// HTTPGetter reads objects through plain or presigned GET urls, the key is the url.
+// nil Client uses http.DefaultClient
+type HTTPGetter struct {
+	Client *http.Client
+}
+
+func (g HTTPGetter) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("get %s: %s", req.URL.Redacted(), resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,120 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// memStore in-memory Getter and Uploader
+type memStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string][][]byte
+	aborted int
+	failAt  int
+}
+
+func newMemStore() *memStore {
+	return &memStore{objects: map[string][]byte{}, uploads: map[string][][]byte{}}
+}
+
+func (m *memStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("no such key %s", key)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memStore) CreateMultipart(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := fmt.Sprintf("%s#%d", key, len(m.uploads))
+	m.uploads[id] = nil
+	return id, nil
+}
+
+func (m *memStore) UploadPart(_ context.Context, _, id string, number int, data []byte) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if number == m.failAt {
+		return "", errors.New("part rejected")
+	}
+	m.uploads[id] = append(m.uploads[id], data)
+	return fmt.Sprint(number), nil
+}
+
+func (m *memStore) CompleteMultipart(_ context.Context, key, id string, parts []Part) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(parts) != len(m.uploads[id]) {
+		return fmt.Errorf("%d parts completed, %d uploaded", len(parts), len(m.uploads[id]))
+	}
+	m.objects[key] = slices.Concat(m.uploads[id]...)
+	delete(m.uploads, id)
+	return nil
+}
+
+func (m *memStore) AbortMultipart(_ context.Context, _, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.uploads, id)
+	m.aborted++
+	return nil
+}
+
+func TestWriterParts(t *testing.T) {
+	store := newMemStore()
+	w := NewWriter(context.Background(), store, "out", 4)
+	for _, chunk := range []string{"ab", "cdefg", "hij"} {
+		if _, err := io.WriteString(w, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(store.objects["out"]); got != "abcdefghij" {
+		t.Errorf("object = %q", got)
+	}
+
+	store.failAt = 2
+	w = NewWriter(context.Background(), store, "broken", 4)
+	if _, err := io.WriteString(w, "0123456789"); err == nil {
+		t.Error("failed part not reported")
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Close after a failed part succeeded")
+	}
+	if _, ok := store.objects["broken"]; ok || store.aborted != 1 || len(store.uploads) != 0 {
+		t.Errorf("failed upload not aborted: aborted %d, open %d", store.aborted, len(store.uploads))
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	store := newMemStore()
+	store.objects["in.pcm"] = make([]byte, 3200)
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	}
+	if err := Transcode(context.Background(), cfg, store, "in.pcm", store, "out.ulaw"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(store.objects["out.ulaw"]); n != 1600 {
+		t.Errorf("uploaded %d bytes, want 1600", n)
+	}
+	if err := Transcode(context.Background(), cfg, store, "missing", store, "x"); err == nil {
+		t.Error("missing source transcoded")
+	}
+}
@@ -0,0 +1,56 @@
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	audiogo "github.com/QuincyGao/audio-go"
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// Transcode streams srcKey into input 0 of a Stream engine built from cfg
+// and uploads output 0 to dstKey, nothing touches local disk. The upload is
+// aborted when any side fails
+func Transcode(ctx context.Context, cfg formats.AudioConfig, src Getter, srcKey string, dst Uploader, dstKey string) error {
+	in, err := src.Get(ctx, srcKey)
+	if err != nil {
+		return fmt.Errorf("get %s: %w", srcKey, err)
+	}
+	defer in.Close()
+
+	// the side failing first cancels the other and names the error
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	ae := audiogo.NewAudioEngine(audiogo.Stream, cfg)
+	if err := ae.Start(runCtx); err != nil {
+		return err
+	}
+	defer ae.Close()
+
+	inDone := make(chan struct{})
+	go func() {
+		defer close(inDone)
+		iw := ae.InputWriter(0)
+		if _, err := io.Copy(iw, in); err != nil {
+			cancel(fmt.Errorf("stream %s: %w", srcKey, err))
+			return
+		}
+		iw.Close()
+	}()
+
+	w := NewWriter(ctx, dst, dstKey, 0)
+	if _, err := io.Copy(w, ae.OutputReader(0)); err != nil {
+		cancel(err)
+	}
+	<-inDone
+	err = ae.Wait()
+	if cause := context.Cause(runCtx); cause != nil {
+		err = cause
+	}
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,129 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DefaultPartSize S3 needs at least 5 MiB for every part but the last
+const DefaultPartSize = 8 << 20
+
+var errWriterClosed = errors.New("objectstore: writer closed")
+
+// Writer uploads everything written to it as one object in parts of
+// partSize bytes. The upload starts with the first full part, Close
+// completes it and Abort drops it. A failed part aborts the upload, later
+// calls return that error
+type Writer struct {
+	ctx      context.Context
+	up       Uploader
+	key      string
+	partSize int
+
+	id    string
+	buf   []byte
+	parts []Part
+	err   error
+	done  bool
+}
+
+// NewWriter uploads to key, DefaultPartSize when partSize <= 0
+func NewWriter(ctx context.Context, up Uploader, key string, partSize int) *Writer {
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	return &Writer{ctx: ctx, up: up, key: key, partSize: partSize}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.done {
+		return 0, errWriterClosed
+	}
+	n := len(p)
+	for len(p) > 0 {
+		if w.buf == nil {
+			w.buf = make([]byte, 0, w.partSize)
+		}
+		k := min(w.partSize-len(w.buf), len(p))
+		w.buf = append(w.buf, p[:k]...)
+		p = p[k:]
+		if len(w.buf) == w.partSize {
+			if err := w.flush(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close uploads the last part and completes the object, an empty write
+// still creates an empty object
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.done {
+		return nil
+	}
+	if len(w.buf) > 0 || len(w.parts) == 0 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	w.done = true
+	if err := w.up.CompleteMultipart(w.ctx, w.key, w.id, w.parts); err != nil {
+		w.fail(fmt.Errorf("complete %s: %w", w.key, err))
+		return w.err
+	}
+	return nil
+}
+
+// Abort drops the upload and its parts, nothing is created under key
+func (w *Writer) Abort() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	return w.abort()
+}
+
+func (w *Writer) abort() error {
+	if w.id == "" {
+		return nil
+	}
+	id := w.id
+	w.id = ""
+	return w.up.AbortMultipart(w.ctx, w.key, id)
+}
+
+// flush uploads buf as the next part
+func (w *Writer) flush() error {
+	if w.id == "" {
+		id, err := w.up.CreateMultipart(w.ctx, w.key)
+		if err != nil {
+			w.fail(fmt.Errorf("create upload %s: %w", w.key, err))
+			return w.err
+		}
+		w.id = id
+	}
+	number := len(w.parts) + 1
+	etag, err := w.up.UploadPart(w.ctx, w.key, w.id, number, w.buf)
+	if err != nil {
+		w.fail(fmt.Errorf("upload %s part %d: %w", w.key, number, err))
+		return w.err
+	}
+	w.parts = append(w.parts, Part{Number: number, ETag: etag})
+	w.buf = nil
+	return nil
+}
+
+// fail records err and aborts the upload so no orphan parts are billed
+func (w *Writer) fail(err error) {
+	w.err = err
+	w.done = true
+	w.abort()
+}
@@ -0,0 +1,91 @@
+package pcm
+
+import (
+	"io"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// FrameSize bytes of one frame of a raw format, one sample on every
+// channel, e.g. 6 for stereo S24LE. 0 for encoded formats
+func FrameSize(f formats.AudioFileFormat, channels int) int {
+	return formats.SampleBytes(f) * max(channels, 1)
+}
+
+// Align n down to whole frames of frameSize bytes
+func Align(n, frameSize int) int {
+	if frameSize <= 0 {
+		return n
+	}
+	return n / frameSize * frameSize
+}
+
+// FrameReader reads whole frames only, a frame split across reads of the
+// underlying reader is held back until it is complete
+type FrameReader struct {
+	r     io.Reader
+	size  int
+	carry []byte
+}
+
+// NewFrameReader reads frames of frameSize bytes from r, see FrameSize
+func NewFrameReader(r io.Reader, frameSize int) *FrameReader {
+	return &FrameReader{r: r, size: max(frameSize, 1)}
+}
+
+// Read fills p with at least one whole frame, p must hold one. A stream
+// ending inside a frame returns io.ErrUnexpectedEOF
+func (fr *FrameReader) Read(p []byte) (int, error) {
+	want := Align(len(p), fr.size)
+	if want == 0 {
+		return 0, io.ErrShortBuffer
+	}
+	n := copy(p, fr.carry)
+	fr.carry = fr.carry[:0]
+	for {
+		m, err := fr.r.Read(p[n:want])
+		n += m
+		whole := Align(n, fr.size)
+		if whole == 0 && err == nil {
+			continue
+		}
+		fr.carry = append(fr.carry, p[whole:n]...)
+		if err == io.EOF && len(fr.carry) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return whole, err
+	}
+}
+
+// S24LEToInt32 decodes packed 3-byte little endian samples of src into dst,
+// sign extended, and returns the samples decoded: the fewer of len(dst) and
+// the whole samples in src
+func S24LEToInt32(dst []int32, src []byte) int {
+	n := min(len(dst), len(src)/3)
+	for i := 0; i < n; i++ {
+		b := src[i*3:]
+		dst[i] = int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+	}
+	return n
+}
+
+// S24BEToInt32 S24LEToInt32 for big endian samples
+func S24BEToInt32(dst []int32, src []byte) int {
+	n := min(len(dst), len(src)/3)
+	for i := 0; i < n; i++ {
+		b := src[i*3:]
+		dst[i] = int32(uint32(b[2])<<8|uint32(b[1])<<16|uint32(b[0])<<24) >> 8
+	}
+	return n
+}
+
+// Int32ToS24LE packs src into 3-byte little endian samples, values outside
+// the 24-bit range are clipped. Returns the samples packed
+func Int32ToS24LE(dst []byte, src []int32) int {
+	n := min(len(dst)/3, len(src))
+	for i := 0; i < n; i++ {
+		v := min(max(src[i], -1<<23), 1<<23-1)
+		dst[i*3], dst[i*3+1], dst[i*3+2] = byte(v), byte(v>>8), byte(v>>16)
+	}
+	return n
+}
@@ -0,0 +1,83 @@
+package pcm
+
+// G.711 tables after the reference Sun g711.c
+
+const (
+	mulawBias = 0x84
+	mulawClip = 32635
+)
+
+// alawSegEnd upper bound of each A-law segment on 13-bit magnitudes
+var alawSegEnd = [8]int{0x1F, 0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF}
+
+// MulawEncode one 16-bit linear sample to mu-law
+func MulawEncode(s int16) byte {
+	v := int(s)
+	sign := 0
+	if v < 0 {
+		v = -v
+		sign = 0x80
+	}
+	v = min(v, mulawClip) + mulawBias
+	exponent := 7
+	for mask := 0x4000; v&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (v >> (exponent + 3)) & 0x0F
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+// MulawDecode one mu-law byte to 16-bit linear
+func MulawDecode(u byte) int16 {
+	u = ^u
+	exponent := (u >> 4) & 0x07
+	v := ((int(u&0x0F) << 3) + mulawBias) << exponent
+	v -= mulawBias
+	if u&0x80 != 0 {
+		v = -v
+	}
+	return int16(v)
+}
+
+// AlawEncode one 16-bit linear sample to A-law
+func AlawEncode(s int16) byte {
+	v := int(s) >> 3
+	mask := 0xD5
+	if v < 0 {
+		mask = 0x55
+		v = -v - 1
+	}
+	seg := 0
+	for seg < len(alawSegEnd) && v > alawSegEnd[seg] {
+		seg++
+	}
+	if seg >= len(alawSegEnd) {
+		return byte(0x7F ^ mask)
+	}
+	aval := seg << 4
+	if seg < 2 {
+		aval |= (v >> 1) & 0x0F
+	} else {
+		aval |= (v >> seg) & 0x0F
+	}
+	return byte(aval ^ mask)
+}
+
+// AlawDecode one A-law byte to 16-bit linear
+func AlawDecode(a byte) int16 {
+	a ^= 0x55
+	t := int(a&0x0F) << 4
+	switch seg := int(a&0x70) >> 4; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
@@ -0,0 +1,222 @@
+package pcm
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+// PCMHandle converts between 16-bit PCM and G.711 in Go, no ffmpeg process.
+// It serves Stream mode configs Supported accepts
+type PCMHandle struct {
+	config formats.AudioConfig
+	ctx    context.Context
+	cancel context.CancelFunc
+	in     formats.AudioFileFormat
+	out    formats.AudioFileFormat
+	// gain linear factor of the input and output Gain, 1 for none
+	gain   float64
+	output *queue
+
+	// mu serializes writes, carry holds a partial input sample
+	mu    sync.Mutex
+	carry []byte
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	killed    atomic.Bool
+}
+
+func NewPCMHandle(cfg formats.AudioConfig) *PCMHandle {
+	return &PCMHandle{
+		config: cfg,
+		closed: make(chan struct{}),
+	}
+}
+
+// sampleSize bytes per sample of the formats the fast path handles, 0 otherwise
+func sampleSize(f formats.AudioFileFormat) int {
+	switch f {
+	case formats.S16LE, formats.S16BE:
+		return 2
+	case formats.MULAW, formats.ALAW:
+		return 1
+	}
+	return 0
+}
+
+// Supported a FORMATCONVERT between s16le, s16be, mulaw and alaw with equal
+// SampleRate and Channels and nothing else to do but a mono Gain: no filters,
+// codecs, stages, stream extras or write deadlines, unless FFmpeg.Always is set
+func Supported(cfg formats.AudioConfig) bool {
+	c := cfg.Clone()
+	c.SetDefaults()
+	if c.FFmpeg.Always || c.OpType != formats.FORMATCONVERT || c.Validate() != nil {
+		return false
+	}
+	in, out := c.GetInputArg(0), c.GetOutputArg(0)
+	if in.Channels == 1 {
+		// applied in Go, the filter check below must not see it
+		c.InputArgs[0].Gain, c.OutputArgs[0].Gain = 0, 0
+	}
+	switch {
+	case sampleSize(in.AudioFileFormat) == 0 || sampleSize(out.AudioFileFormat) == 0:
+		return false
+	case in.SampleRate != out.SampleRate || in.Channels != out.Channels:
+		return false
+	case in.Codec != "" || out.Codec != "":
+		return false
+	case formats.BuildConvertFilter(&c) != "" || len(c.CodecStages()) > 0:
+		return false
+	case c.Keepalive != nil || c.Impairment != nil || c.BargeIn != nil || c.OutputBuffer != nil:
+		return false
+	case c.SimulateLive || c.WriteTimeout > 0 || c.DeadlockTimeout > 0:
+		return false
+	case len(c.InputFiles) > 0 || len(c.OutputFiles) > 0:
+		// files, devices and sockets are opened by ffmpeg
+		return false
+	}
+	return true
+}
+
+func (h *PCMHandle) Init(ctx context.Context) error {
+	h.config.SetDefaults()
+	if err := h.config.Validate(); err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+	if !Supported(h.config) {
+		return fmt.Errorf("config needs ffmpeg, the pure-Go path only converts between s16le, s16be, mulaw and alaw")
+	}
+	in, out := h.config.GetInputArg(0), h.config.GetOutputArg(0)
+	h.in, h.out = in.AudioFileFormat, out.AudioFileFormat
+	h.gain = math.Pow(10, (in.Gain+out.Gain)/20)
+	h.ctx, h.cancel = context.WithCancel(ctx)
+	h.output = newQueue()
+	return nil
+}
+
+// Run nothing to start, conversion happens inside WriteTo
+func (h *PCMHandle) Run() error {
+	return nil
+}
+
+// Wait returns once input is closed, output still queued stays readable until Done
+func (h *PCMHandle) Wait() error {
+	select {
+	case <-h.closed:
+		if h.killed.Load() {
+			return errKilled
+		}
+		return nil
+	case <-h.ctx.Done():
+		return h.ctx.Err()
+	}
+}
+
+func (h *PCMHandle) WriteTo(index int, data []byte) error {
+	return h.WriteToContext(context.Background(), index, data)
+}
+
+// WriteToContext writes input 0, giving up with ErrWriteStalled once ctx ends
+// while the output queue is full. The samples of data are then dropped whole
+func (h *PCMHandle) WriteToContext(ctx context.Context, index int, data []byte) error {
+	if index != 0 {
+		return fmt.Errorf("stdin index %d out of range", index)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	size := sampleSize(h.in)
+	buf := append(h.carry, data...)
+	n := len(buf) / size * size
+	h.carry = append([]byte(nil), buf[n:]...)
+	return utils.PipeError(h.output.write(ctx, h.convert(buf[:n])))
+}
+
+func (h *PCMHandle) ReadFrom(index int, p []byte) (int, error) {
+	return h.ReadFromContext(context.Background(), index, p)
+}
+
+// ReadFromContext reads output 0, returning ErrNoData when ctx ends before any output
+func (h *PCMHandle) ReadFromContext(ctx context.Context, index int, p []byte) (int, error) {
+	if index != 0 {
+		return 0, fmt.Errorf("stdout index %d out of range", index)
+	}
+	return h.output.read(ctx, p)
+}
+
+func (h *PCMHandle) CloseInput() {
+	h.closeOnce.Do(func() {
+		h.output.close(nil)
+		close(h.closed)
+	})
+}
+
+func (h *PCMHandle) CloseInputAt(index int) error {
+	if index != 0 {
+		return fmt.Errorf("stdin index %d out of range", index)
+	}
+	h.CloseInput()
+	return nil
+}
+
+var errKilled = errors.New("pure-Go conversion killed")
+
+// Kill stops converting as a crashed ffmpeg would: later writes fail, output
+// converted so far stays readable and Wait reports the kill
+func (h *PCMHandle) Kill() error {
+	h.killed.Store(true)
+	h.CloseInput()
+	return nil
+}
+
+func (h *PCMHandle) Done() {
+	if h.cancel == nil {
+		return
+	}
+	h.cancel()
+	h.output.close(io.ErrClosedPipe)
+}
+
+// convert whole input samples to the output format, applying gain
+func (h *PCMHandle) convert(src []byte) []byte {
+	if h.in == h.out && h.gain == 1 {
+		return append([]byte(nil), src...)
+	}
+	n := len(src) / sampleSize(h.in)
+	dst := make([]byte, n*sampleSize(h.out))
+	for i := 0; i < n; i++ {
+		var s int16
+		switch h.in {
+		case formats.S16LE:
+			s = int16(binary.LittleEndian.Uint16(src[i*2:]))
+		case formats.S16BE:
+			s = int16(binary.BigEndian.Uint16(src[i*2:]))
+		case formats.MULAW:
+			s = MulawDecode(src[i])
+		case formats.ALAW:
+			s = AlawDecode(src[i])
+		}
+		if h.gain != 1 {
+			s = int16(math.Round(max(math.MinInt16, min(math.MaxInt16, float64(s)*h.gain))))
+		}
+		switch h.out {
+		case formats.S16LE:
+			binary.LittleEndian.PutUint16(dst[i*2:], uint16(s))
+		case formats.S16BE:
+			binary.BigEndian.PutUint16(dst[i*2:], uint16(s))
+		case formats.MULAW:
+			dst[i] = MulawEncode(s)
+		case formats.ALAW:
+			dst[i] = AlawEncode(s)
+		}
+	}
+	return dst
+}
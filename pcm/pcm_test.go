@@ -0,0 +1,219 @@
+package pcm
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+func TestG711RoundTrip(t *testing.T) {
+	if got := MulawEncode(0); got != 0xFF {
+		t.Errorf("MulawEncode(0) = %#x, want 0xff", got)
+	}
+	if got := AlawEncode(0); got != 0xD5 {
+		t.Errorf("AlawEncode(0) = %#x, want 0xd5", got)
+	}
+	for b := 0; b < 256; b++ {
+		if s := MulawDecode(byte(b)); MulawDecode(MulawEncode(s)) != s {
+			t.Errorf("mu-law %#x does not survive a round trip", b)
+		}
+		if s := AlawDecode(byte(b)); AlawDecode(AlawEncode(s)) != s {
+			t.Errorf("A-law %#x does not survive a round trip", b)
+		}
+	}
+}
+
+func TestPCMHandle(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.S16BE}},
+	}
+	if !Supported(cfg) {
+		t.Fatalf("s16le -> s16be should take the fast path")
+	}
+	cfg.FFmpeg.Always = true
+	if Supported(cfg) {
+		t.Fatalf("FFmpeg.Always took the fast path")
+	}
+	cfg.FFmpeg.Always = false
+	h := NewPCMHandle(cfg)
+	if err := h.Init(context.Background()); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	go func() {
+		// odd chunk sizes split samples across writes
+		h.WriteTo(0, []byte{0x01})
+		h.WriteTo(0, []byte{0x02, 0x03})
+		h.WriteTo(0, []byte{0x04})
+		h.CloseInput()
+	}()
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, readerFunc(func(p []byte) (int, error) { return h.ReadFrom(0, p) })); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if want := []byte{0x02, 0x01, 0x04, 0x03}; !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("output = %x, want %x", out.Bytes(), want)
+	}
+
+	cfg.OutputArgs[0].SampleRate = 16000
+	if Supported(cfg) {
+		t.Errorf("resampling needs ffmpeg")
+	}
+	cfg.OutputArgs[0].SampleRate = 0
+	cfg.WriteTimeout = time.Second
+	if Supported(cfg) {
+		t.Errorf("WriteTimeout needs ffmpeg pipes")
+	}
+}
+
+func TestPCMGain(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE, Gain: 6}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+	}
+	if !Supported(cfg) {
+		t.Fatal("mono gain should take the fast path")
+	}
+	h := NewPCMHandle(cfg)
+	if err := h.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Done()
+	in := make([]byte, 4)
+	binary.LittleEndian.PutUint16(in, 1000)
+	binary.LittleEndian.PutUint16(in[2:], 30000)
+	if err := h.WriteTo(0, in); err != nil {
+		t.Fatal(err)
+	}
+	out := make([]byte, 4)
+	if _, err := io.ReadFull(readerFunc(func(p []byte) (int, error) { return h.ReadFrom(0, p) }), out); err != nil {
+		t.Fatal(err)
+	}
+	if got := int16(binary.LittleEndian.Uint16(out)); got != 1995 {
+		t.Errorf("1000 + 6 dB = %d, want 1995", got)
+	}
+	if got := int16(binary.LittleEndian.Uint16(out[2:])); got != math.MaxInt16 {
+		t.Errorf("30000 + 6 dB = %d, want it clipped to %d", got, math.MaxInt16)
+	}
+
+	cfg.InputArgs[0].Channels, cfg.OutputArgs[0].Channels = 2, 2
+	if Supported(cfg) {
+		t.Error("stereo gain took the fast path")
+	}
+}
+
+func TestPCMContext(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	}
+	h := NewPCMHandle(cfg)
+	if err := h.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Done()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := h.ReadFromContext(ctx, 0, make([]byte, 160)); !errors.Is(err, utils.ErrNoData) {
+		t.Errorf("read without output = %v, want ErrNoData", err)
+	}
+	// nobody reads, the queue fills and the write gives up
+	var err error
+	for range 2*queueSize/160 + 1 {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err = h.WriteToContext(ctx, 0, make([]byte, 320))
+		cancel()
+		if err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, utils.ErrWriteStalled) {
+		t.Errorf("write into a full queue = %v, want ErrWriteStalled", err)
+	}
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestFloatSamples(t *testing.T) {
+	for _, f := range []formats.AudioFileFormat{formats.S16LE, formats.F32LE, formats.F64LE} {
+		buf := make([]byte, 4*formats.SampleBytes(f))
+		for i, v := range []float64{0.5, -0.5, 0.5, -0.5} {
+			PutSample(buf, f, i, v)
+		}
+		if got := Sample(buf, f, 1); math.Abs(got+0.5) > 1e-4 {
+			t.Errorf("%s: sample 1 = %v, want -0.5", f, got)
+		}
+		// a ±0.5 square wave is -6 dBFS whatever the width
+		if db := LevelDB(buf, f); math.Abs(db+6.02) > 0.01 {
+			t.Errorf("%s: LevelDB = %v, want -6.02", f, db)
+		}
+	}
+	k := formats.Keepalive{Frame: 20 * time.Millisecond}
+	if n := k.FrameBytes(formats.AudioArgs{AudioFileFormat: formats.F32LE, SampleRate: 16000, Channels: 1}); n != 1280 {
+		t.Errorf("f32le keepalive frame = %d bytes, want 1280", n)
+	}
+}
+
+func TestS24(t *testing.T) {
+	if n := FrameSize(formats.S24LE, 2); n != 6 {
+		t.Errorf("stereo s24le frame = %d", n)
+	}
+	in := []int32{0, 1, -1, 1<<23 - 1, -1 << 23}
+	packed := make([]byte, len(in)*3)
+	Int32ToS24LE(packed, in)
+	out := make([]int32, len(in))
+	if n := S24LEToInt32(out, packed); n != len(in) || !slices.Equal(out, in) {
+		t.Errorf("round trip = %v", out[:n])
+	}
+	if Int32ToS24LE(packed, []int32{1 << 30}); packed[2] != 0x7f {
+		t.Errorf("overflow not clipped: %x", packed[:3])
+	}
+
+	// one stereo frame split over two reads, then a stray byte
+	src := io.MultiReader(bytes.NewReader(make([]byte, 4)), bytes.NewReader(make([]byte, 3)))
+	fr := NewFrameReader(src, 6)
+	buf := make([]byte, 64)
+	if n, err := fr.Read(buf); n != 6 || err != nil {
+		t.Errorf("first read = %d, %v", n, err)
+	}
+	if _, err := fr.Read(buf); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated frame = %v", err)
+	}
+}
+
+func TestPCMKill(t *testing.T) {
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	}
+	h := NewPCMHandle(cfg)
+	if err := h.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Done()
+	if err := h.WriteTo(0, make([]byte, 320)); err != nil {
+		t.Fatal(err)
+	}
+	h.Kill()
+	if err := h.WriteTo(0, make([]byte, 320)); !errors.Is(err, utils.ErrBrokenPipe) {
+		t.Errorf("write after Kill = %v, want ErrBrokenPipe", err)
+	}
+	out, err := io.ReadAll(readerFunc(func(p []byte) (int, error) { return h.ReadFrom(0, p) }))
+	if len(out) != 160 || err != nil {
+		t.Errorf("read %d bytes, %v after Kill, want the 160 converted before", len(out), err)
+	}
+	if err := h.Wait(); err == nil {
+		t.Error("Wait after Kill = nil")
+	}
+}
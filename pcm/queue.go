@@ -0,0 +1,105 @@
+package pcm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+// queueSize bytes of converted output held before writes block, about what
+// an OS pipe buffers
+const queueSize = 64 << 10
+
+// queue carries converted output from WriteTo to ReadFrom. Every change
+// closes changed, waking the reader or writer blocked on it
+type queue struct {
+	mu      sync.Mutex
+	buf     []byte
+	eof     bool
+	err     error
+	changed chan struct{}
+}
+
+func newQueue() *queue {
+	return &queue{changed: make(chan struct{})}
+}
+
+// wait releases mu until the next change or the end of ctx, false for ctx
+func (q *queue) wait(ctx context.Context) bool {
+	changed := q.changed
+	q.mu.Unlock()
+	defer q.mu.Lock()
+	select {
+	case <-changed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// wake under mu
+func (q *queue) wake() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// write appends p whole, blocking while the queue is full. A write ctx ends
+// first leaves the queue untouched and returns ErrWriteStalled
+func (q *queue) write(ctx context.Context, p []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.err == nil && !q.eof && len(q.buf) >= queueSize {
+		if !q.wait(ctx) {
+			return fmt.Errorf("%w: %w", utils.ErrWriteStalled, context.Cause(ctx))
+		}
+	}
+	switch {
+	case q.err != nil:
+		return q.err
+	case q.eof:
+		return io.ErrClosedPipe
+	}
+	q.buf = append(q.buf, p...)
+	q.wake()
+	return nil
+}
+
+// read returns io.EOF once the queue is closed and drained, ErrNoData when
+// ctx ends before any output
+func (q *queue) read(ctx context.Context, p []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.err == nil && !q.eof && len(q.buf) == 0 {
+		if !q.wait(ctx) {
+			return 0, fmt.Errorf("%w: %w", utils.ErrNoData, context.Cause(ctx))
+		}
+	}
+	switch {
+	case q.err != nil:
+		return 0, q.err
+	case len(q.buf) == 0:
+		return 0, io.EOF
+	}
+	n := copy(p, q.buf)
+	q.buf = q.buf[n:]
+	if len(q.buf) == 0 {
+		q.buf = nil
+	}
+	q.wake()
+	return n, nil
+}
+
+// close ends writes, nil keeps queued output readable, an error discards it
+// and fails both sides
+func (q *queue) close(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err != nil {
+		q.err, q.buf = err, nil
+	}
+	q.eof = true
+	q.wake()
+}
@@ -0,0 +1,58 @@
+package pcm
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// Sample i of data in f, one of s16le, s24le, f32le and f64le, scaled to -1..1. Float samples are returned as
+// stored, they may exceed full scale
+func Sample(data []byte, f formats.AudioFileFormat, i int) float64 {
+	switch f {
+	case formats.S16LE:
+		return float64(int16(binary.LittleEndian.Uint16(data[i*2:]))) / math.MaxInt16
+	case formats.S24LE:
+		var v [1]int32
+		S24LEToInt32(v[:], data[i*3:])
+		return float64(v[0]) / (1<<23 - 1)
+	case formats.F32LE:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:])))
+	case formats.F64LE:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data[i*8:]))
+	}
+	return 0
+}
+
+// PutSample stores v, -1..1, as sample i of buf in f. Integer formats clip
+func PutSample(buf []byte, f formats.AudioFileFormat, i int, v float64) {
+	switch f {
+	case formats.S16LE:
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(int16(math.Max(-1, math.Min(1, v))*math.MaxInt16)))
+	case formats.S24LE:
+		Int32ToS24LE(buf[i*3:], []int32{int32(math.Max(-1, math.Min(1, v)) * (1<<23 - 1))})
+	case formats.F32LE:
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(float32(v)))
+	case formats.F64LE:
+		binary.LittleEndian.PutUint64(buf[i*8:], math.Float64bits(v))
+	}
+}
+
+// LevelDB RMS of the whole samples of data in dBFS, -Inf for silence
+func LevelDB(data []byte, f formats.AudioFileFormat) float64 {
+	size := formats.SampleBytes(f)
+	if size == 0 {
+		return math.Inf(-1)
+	}
+	n := len(data) / size
+	var sum float64
+	for i := 0; i < n; i++ {
+		v := Sample(data, f, i)
+		sum += v * v
+	}
+	if n == 0 || sum == 0 {
+		return math.Inf(-1)
+	}
+	return 10 * math.Log10(sum/float64(n))
+}
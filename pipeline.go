@@ -0,0 +1,215 @@
+package audiogo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+// Pipeline chains Stream engines, output 0 of every stage feeds input 0 of
+// the next. Write to the first stage, read from the last
+type Pipeline struct {
+	// AutoAdapt inserts a FORMATCONVERT stage between stages formats.Compatible
+	// rejects instead of failing Start, every adapter is logged at info level
+	AutoAdapt bool
+	// Logger receives adapter notices and is set on every engine, nil disables logging
+	Logger *slog.Logger
+
+	stages  []formats.AudioConfig
+	engines []*AudioEngine
+	copies  sync.WaitGroup
+	// cancel stops every stage, a failed copy would leave the others blocked
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	copyErr error
+}
+
+// NewPipeline chain of stages, at least one
+func NewPipeline(stages ...formats.AudioConfig) *Pipeline {
+	p := &Pipeline{}
+	for _, s := range stages {
+		p.stages = append(p.stages, s.Clone())
+	}
+	return p
+}
+
+// Start checks every link with formats.Compatible, adapting it when
+// AutoAdapt is set, then starts all engines and the copies between them.
+// A failed copy cancels every stage
+func (p *Pipeline) Start(ctx context.Context) error {
+	if len(p.stages) == 0 {
+		return errors.New("pipeline has no stages")
+	}
+	if p.engines != nil {
+		return errors.New("pipeline already started")
+	}
+	stages, err := p.link()
+	if err != nil {
+		return err
+	}
+	ctx, p.cancel = context.WithCancel(ctx)
+	for _, cfg := range stages {
+		ae := NewAudioEngine(Stream, cfg)
+		if p.Logger != nil {
+			ae.SetLogger(p.Logger)
+		}
+		if err := ae.Start(ctx); err != nil {
+			p.Close()
+			return err
+		}
+		p.engines = append(p.engines, ae)
+	}
+	for i := 0; i+1 < len(p.engines); i++ {
+		from, to := p.engines[i], p.engines[i+1]
+		p.copies.Add(1)
+		go func() {
+			defer p.copies.Done()
+			in := to.InputWriter(0)
+			if _, err := io.Copy(in, from.OutputReader(0)); err != nil {
+				p.fail(fmt.Errorf("pipeline stage %d to %d: %w", i, i+1, err))
+			}
+			in.Close()
+		}()
+	}
+	return nil
+}
+
+// link checks adjacent stages, inserting adapters with AutoAdapt
+func (p *Pipeline) link() ([]formats.AudioConfig, error) {
+	stages := []formats.AudioConfig{p.stages[0]}
+	for i := 1; i < len(p.stages); i++ {
+		prev := p.stages[i-1].Clone()
+		prev.SetDefaults()
+		out, in := prev.GetOutputArg(0), p.stages[i].GetInputArg(0)
+		// an encoded input reads rate and channels from its header, only raw
+		// PCM takes the defaults the next stage would run with
+		if formats.IsRawPCM(in.AudioFileFormat) {
+			next := p.stages[i].Clone()
+			next.SetDefaults()
+			in = next.GetInputArg(0)
+		}
+		err := formats.Compatible(out, in)
+		if err != nil && !p.AutoAdapt {
+			return nil, fmt.Errorf("pipeline stage %d to %d: %w", i-1, i, err)
+		}
+		if err != nil {
+			adapter := adapterConfig(out, in, prev.FFmpeg)
+			utils.Logger(p.Logger).Info("pipeline adapter inserted",
+				"after_stage", i-1, "from", argsString(out), "to", argsString(adapter.OutputArgs[0]), "reason", err.Error())
+			stages = append(stages, adapter)
+		}
+		stages = append(stages, p.stages[i])
+	}
+	return stages, nil
+}
+
+// adapterConfig converts out into what in expects, values in leaves open keep
+// out's. It only reads the stream layout of out, gain, fades and filters were
+// applied by the stage before. It runs with the ffmpeg options of that stage
+func adapterConfig(out, in formats.AudioArgs, ffmpeg formats.FFmpegOptions) formats.AudioConfig {
+	source := formats.AudioArgs{
+		AudioFileFormat: out.AudioFileFormat,
+		SampleRate:      out.SampleRate,
+		Channels:        out.Channels,
+		ChannelLayout:   out.ChannelLayout,
+	}
+	target := formats.AudioArgs{
+		AudioFileFormat: in.AudioFileFormat,
+		SampleRate:      in.SampleRate,
+		Channels:        in.Channels,
+		ChannelLayout:   in.ChannelLayout,
+	}
+	if target.SampleRate == 0 {
+		target.SampleRate = out.SampleRate
+	}
+	if target.Channels == 0 {
+		target.Channels = out.Channels
+	}
+	return formats.AudioConfig{
+		OpType:     formats.FORMATCONVERT,
+		InputArgs:  []formats.AudioArgs{source},
+		OutputArgs: []formats.AudioArgs{target},
+		FFmpeg:     ffmpeg,
+	}
+}
+
+func argsString(a formats.AudioArgs) string {
+	return fmt.Sprintf("%s %dHz %dch", a.AudioFileFormat, a.SampleRate, a.Channels)
+}
+
+func (p *Pipeline) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.copyErr == nil {
+		p.copyErr = err
+		p.cancel()
+	}
+}
+
+// Stages engines in order, adapters included
+func (p *Pipeline) Stages() []*AudioEngine {
+	return p.engines
+}
+
+// Write feeds the first stage
+func (p *Pipeline) Write(data []byte) error {
+	if p.engines == nil {
+		return errors.New("pipeline not started")
+	}
+	return p.engines[0].WritePrimary(data)
+}
+
+// CloseInput ends the input of the first stage, the end travels down the chain
+func (p *Pipeline) CloseInput() {
+	if p.engines != nil {
+		p.engines[0].CloseInput()
+	}
+}
+
+// Read reads output 0 of the last stage
+func (p *Pipeline) Read(b []byte) (int, error) {
+	if p.engines == nil {
+		return 0, errors.New("pipeline not started")
+	}
+	return p.engines[len(p.engines)-1].ReadLeft(b)
+}
+
+// Wait waits for every stage after the output was read to EOF, returning
+// a failed copy, which cancelled the stages, or else the first failure along the chain
+func (p *Pipeline) Wait() error {
+	if p.engines == nil {
+		return errors.New("pipeline not started")
+	}
+	p.copies.Wait()
+	var first error
+	for i, ae := range p.engines {
+		if err := ae.Wait(); err != nil && first == nil {
+			first = fmt.Errorf("pipeline stage %d: %w", i, err)
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.copyErr != nil {
+		return p.copyErr
+	}
+	return first
+}
+
+// Close stops every stage
+func (p *Pipeline) Close() error {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	var errs []error
+	for _, ae := range p.engines {
+		errs = append(errs, ae.Close())
+	}
+	p.copies.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,219 @@
+package audiogo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// EnginePool keeps started Stream engines per AudioConfig, so short requests
+// skip ffmpeg startup. An engine serves one request: after its input is
+// closed ffmpeg can not be rewound, Put releases it and the pool starts a fresh one
+type EnginePool struct {
+	ctx  context.Context
+	size int
+
+	mu      sync.Mutex
+	idle    map[string][]*AudioEngine
+	filling map[string]bool
+	// out pool key of every checked out engine, so Put needs no re-encoding
+	out    map[*AudioEngine]string
+	closed bool
+	// nice per OpType niceness of engines the pool starts
+	nice map[formats.OpType]int
+}
+
+// NewEnginePool keeps up to size warm engines per config, 2 when size <= 0.
+// Engines are bound to ctx, cancelling it stops every pooled ffmpeg
+func NewEnginePool(ctx context.Context, size int) *EnginePool {
+	if size <= 0 {
+		size = 2
+	}
+	return &EnginePool{
+		ctx:     ctx,
+		size:    size,
+		idle:    make(map[string][]*AudioEngine),
+		filling: make(map[string]bool),
+		out:     make(map[*AudioEngine]string),
+	}
+}
+
+// SetNice niceness of engines the pool starts for op when their config leaves
+// FFmpeg.Nice nil, ahead of formats.SetDefaultNice. Engines already warm keep theirs
+func (p *EnginePool) SetNice(op formats.OpType, nice int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.nice == nil {
+		p.nice = make(map[formats.OpType]int)
+	}
+	p.nice[op] = nice
+}
+
+// Get checks out a started engine for config, a warm one when available.
+// Engines whose ffmpeg is gone are dropped on the way
+func (p *EnginePool) Get(config formats.AudioConfig) (*AudioEngine, error) {
+	config = p.withNice(config)
+	key, err := poolKey(config)
+	if err != nil {
+		return nil, err
+	}
+	var ae *AudioEngine
+	var stale []*AudioEngine
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("engine pool closed")
+	}
+	idle := p.idle[key]
+	for ae == nil && len(idle) > 0 {
+		last := idle[len(idle)-1]
+		idle = idle[:len(idle)-1]
+		if last.alive() {
+			ae = last
+		} else {
+			stale = append(stale, last)
+		}
+	}
+	p.idle[key] = idle
+	refill := !p.filling[key]
+	p.filling[key] = true
+	p.mu.Unlock()
+
+	for _, s := range stale {
+		s.Close()
+	}
+	if refill {
+		go p.fill(key, config)
+	}
+	if ae == nil {
+		if ae, err = p.start(config); err != nil {
+			return nil, err
+		}
+	}
+	p.mu.Lock()
+	p.out[ae] = key
+	p.mu.Unlock()
+	return ae, nil
+}
+
+// Put returns an engine taken from Get. An unused healthy engine goes back
+// to the pool, any other, or one this pool did not hand out, is released.
+// Callers must not use it afterwards
+func (p *EnginePool) Put(ae *AudioEngine) {
+	p.mu.Lock()
+	key, ok := p.out[ae]
+	delete(p.out, ae)
+	p.mu.Unlock()
+	st := ae.Stats()
+	if !ok || st.ChunksIn > 0 || st.ChunksOut > 0 || !ae.alive() {
+		ae.Close()
+		return
+	}
+	p.mu.Lock()
+	if p.closed || len(p.idle[key]) >= p.size {
+		p.mu.Unlock()
+		ae.Close()
+		return
+	}
+	p.idle[key] = append(p.idle[key], ae)
+	p.mu.Unlock()
+}
+
+// Close releases every idle engine, engines checked out stay with their callers
+func (p *EnginePool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = make(map[string][]*AudioEngine)
+	p.mu.Unlock()
+	for _, list := range idle {
+		for _, ae := range list {
+			ae.Close()
+		}
+	}
+}
+
+// fill tops the idle list of key up to size, Get marks key filling so there
+// is one filler per key at a time
+func (p *EnginePool) fill(key string, config formats.AudioConfig) {
+	defer func() {
+		p.mu.Lock()
+		delete(p.filling, key)
+		p.mu.Unlock()
+	}()
+
+	for {
+		p.mu.Lock()
+		full := p.closed || len(p.idle[key]) >= p.size
+		p.mu.Unlock()
+		if full {
+			return
+		}
+		ae, err := p.start(config)
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			ae.Close()
+			return
+		}
+		p.idle[key] = append(p.idle[key], ae)
+		p.mu.Unlock()
+	}
+}
+
+// withNice config with the pool niceness of its OpType, applied before the
+// pool key so Put finds the same key on the engine config
+func (p *EnginePool) withNice(config formats.AudioConfig) formats.AudioConfig {
+	if config.FFmpeg.Nice != nil {
+		return config
+	}
+	op := config.OpType
+	if op == "" {
+		op = formats.FORMATCONVERT
+	}
+	p.mu.Lock()
+	nice, ok := p.nice[op]
+	p.mu.Unlock()
+	if ok {
+		config = config.Clone()
+		config.FFmpeg.Nice = &nice
+	}
+	return config
+}
+
+func (p *EnginePool) start(config formats.AudioConfig) (*AudioEngine, error) {
+	ae := NewAudioEngine(Stream, config)
+	if err := ae.Start(p.ctx); err != nil {
+		return nil, err
+	}
+	return ae, nil
+}
+
+// poolKey configs with equal JSON share warm engines, the key is its
+// SHA-256 so the maps do not keep the encoded configs
+func poolKey(config formats.AudioConfig) (string, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("engine pool key: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return string(sum[:]), nil
+}
+
+// alive engine started and its ffmpeg not known to have exited
+func (ae *AudioEngine) alive() bool {
+	if !ae.running {
+		return false
+	}
+	if p, ok := ae.processor.(interface{ Alive() bool }); ok {
+		return p.Alive()
+	}
+	return true
+}
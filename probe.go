@@ -0,0 +1,166 @@
+package audiogo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+// MediaInfo describes the first audio stream of a media source
+type MediaInfo struct {
+	// FormatName container name reported by ffprobe, e.g. "mp3", "wav"
+	FormatName string
+	Codec      string
+	SampleRate int
+	Channels   int
+	Duration   time.Duration
+	// BitRate in bits per second, 0 when unknown
+	BitRate int
+}
+
+// AudioArgs fills InputArgs from probed info, AudioFileFormat is the
+// FormatName as is when Format does not know it
+func (m *MediaInfo) AudioArgs() formats.AudioArgs {
+	f, err := m.Format()
+	if err != nil {
+		f = formats.AudioFileFormat(m.FormatName)
+	}
+	return formats.AudioArgs{
+		AudioFileFormat: f,
+		SampleRate:      m.SampleRate,
+		Channels:        m.Channels,
+	}
+}
+
+// Format maps the probed container and codec to an AudioFileFormat: ffprobe
+// reports m4a as mov, opus as ogg and the ADPCM WAV variants as wav
+func (m *MediaInfo) Format() (formats.AudioFileFormat, error) {
+	switch m.FormatName {
+	case "mov":
+		if m.Codec == "aac" {
+			return formats.M4A, nil
+		}
+	case "ogg":
+		if m.Codec == "opus" {
+			return formats.OPUS, nil
+		}
+		return formats.OGG, nil
+	case "wav":
+		switch m.Codec {
+		case string(formats.ADPCMIMA):
+			return formats.ADPCMIMA, nil
+		case string(formats.ADPCMMS):
+			return formats.ADPCMMS, nil
+		}
+		return formats.WAV, nil
+	case "amr":
+		switch m.Codec {
+		case "amr_nb":
+			return formats.AMRNB, nil
+		case "amr_wb":
+			return formats.AMRWB, nil
+		}
+	}
+	return formats.ParseAudioFileFormat(m.FormatName)
+}
+
+// Probe shells out to ffprobe and returns media info of path
+func Probe(ctx context.Context, path string) (*MediaInfo, error) {
+	return runProbe(ctx, formats.FFmpegOptions{}, path, nil)
+}
+
+// ProbeWith is Probe finding ffprobe through opts, as an engine with those FFmpeg options would
+func ProbeWith(ctx context.Context, opts formats.FFmpegOptions, path string) (*MediaInfo, error) {
+	return runProbe(ctx, opts, path, nil)
+}
+
+// ProbeReader probes data read from r, raw PCM can not be probed
+func ProbeReader(ctx context.Context, r io.Reader) (*MediaInfo, error) {
+	return runProbe(ctx, formats.FFmpegOptions{}, "pipe:0", r)
+}
+
+func runProbe(ctx context.Context, opts formats.FFmpegOptions, source string, stdin io.Reader) (*MediaInfo, error) {
+	path, err := opts.LookPath("ffprobe")
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams", "-select_streams", "a:0", source}
+	cmd := exec.CommandContext(ctx, path, args...)
+	var stdout bytes.Buffer
+	stderr := &utils.TailBuffer{Limit: 2048}
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errMsg := stderr.String(); errMsg != "" {
+			if kind := utils.ClassifyStderr(errMsg); kind != nil {
+				return nil, fmt.Errorf("ffprobe exit error: %w: %w, stderr: %s", kind, err, errMsg)
+			}
+			return nil, fmt.Errorf("ffprobe exit error: %w, stderr: %s", err, errMsg)
+		}
+		return nil, fmt.Errorf("ffprobe exit error: %w", err)
+	}
+	return parseProbeOutput(stdout.Bytes())
+}
+
+type probeOutput struct {
+	Streams []struct {
+		CodecName  string `json:"codec_name"`
+		SampleRate string `json:"sample_rate"`
+		Channels   int    `json:"channels"`
+		BitRate    string `json:"bit_rate"`
+		Duration   string `json:"duration"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+func parseProbeOutput(data []byte) (*MediaInfo, error) {
+	var out probeOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output: %w", err)
+	}
+	if len(out.Streams) == 0 {
+		return nil, fmt.Errorf("no audio stream found")
+	}
+	st := out.Streams[0]
+	info := &MediaInfo{
+		// format_name may list aliases, e.g. "mov,mp4,m4a"
+		FormatName: strings.Split(out.Format.FormatName, ",")[0],
+		Codec:      st.CodecName,
+		Channels:   st.Channels,
+	}
+	info.SampleRate, _ = strconv.Atoi(st.SampleRate)
+
+	// stream values are more precise, format values are the fallback
+	duration := firstNonEmpty(st.Duration, out.Format.Duration)
+	if secs, err := strconv.ParseFloat(duration, 64); err == nil {
+		info.Duration = time.Duration(secs * float64(time.Second))
+	}
+	info.BitRate, _ = strconv.Atoi(firstNonEmpty(st.BitRate, out.Format.BitRate))
+	return info, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" && v != "N/A" {
+			return v
+		}
+	}
+	return ""
+}
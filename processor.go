@@ -11,4 +11,5 @@ type Processor interface {
 	WriteTo(int, []byte) error
 	ReadFrom(int, []byte) (int, error)
 	CloseInput()
+	CloseInputAt(int) error
 }
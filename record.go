@@ -0,0 +1,263 @@
+package audiogo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// sessionMagic starts a session file, followed by the config JSON length
+// (uint32) and JSON, then records: kind, index, nanoseconds since Start
+// (int64), data length (uint32) and data, all big endian
+const sessionMagic = "AUDIOGO-SESSION1\n"
+
+// record kinds
+const (
+	recWrite byte = iota
+	recRead
+	recCloseInput
+)
+
+// allInputs index of a CloseInput record
+const allInputs = 0xff
+
+// recorder appends engine traffic to a session, the first error stops it
+type recorder struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	err   error
+}
+
+// Record writes every byte written to and read from the engine, with
+// timestamps, to w as a session Replay can feed through a new engine. Must
+// be called before Start, Reset ends the recording. A failed write to w
+// stops it without failing the engine, Close reports it
+func (ae *AudioEngine) Record(w io.Writer) error {
+	if ae.running {
+		return fmt.Errorf("engine already running")
+	}
+	cfg, err := json.Marshal(ae.config)
+	if err != nil {
+		return fmt.Errorf("record config: %w", err)
+	}
+	header := binary.BigEndian.AppendUint32([]byte(sessionMagic), uint32(len(cfg)))
+	if _, err := w.Write(append(header, cfg...)); err != nil {
+		return fmt.Errorf("record: %w", err)
+	}
+	ae.recorder = &recorder{w: w}
+	return nil
+}
+
+// begin sets the time records are stamped against
+func (r *recorder) begin() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.start = time.Now()
+	r.mu.Unlock()
+}
+
+func (r *recorder) record(kind byte, index int, data []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	buf := make([]byte, 0, 14+len(data))
+	buf = append(buf, kind, byte(index))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(time.Since(r.start)))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+	if _, err := r.w.Write(append(buf, data...)); err != nil {
+		r.err = fmt.Errorf("record: %w", err)
+	}
+}
+
+func (r *recorder) error() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// ReplayOptions settings of Replay
+type ReplayOptions struct {
+	// Realtime paces writes by their recorded timestamps, else they go as fast as ffmpeg reads
+	Realtime bool
+	// Config replaces the recorded config, e.g. to try a fix, nil keeps it
+	Config *formats.AudioConfig
+}
+
+// ReplayResult recorded output next to what the new engine produced,
+// indexed by output
+type ReplayResult struct {
+	Recorded [][]byte
+	Replayed [][]byte
+}
+
+// Mismatch first output whose replay differs from the recording and the byte
+// offset where they part, ok false when every output matches
+func (r ReplayResult) Mismatch() (output int, offset int, ok bool) {
+	for i := range r.Recorded {
+		a, b := r.Recorded[i], r.Replayed[i]
+		n := min(len(a), len(b))
+		for j := 0; j < n; j++ {
+			if a[j] != b[j] {
+				return i, j, true
+			}
+		}
+		if len(a) != len(b) {
+			return i, n, true
+		}
+	}
+	return 0, 0, false
+}
+
+type sessionRecord struct {
+	kind  byte
+	index int
+	at    time.Duration
+	data  []byte
+}
+
+// Replay feeds a session written by Record through a new Stream engine,
+// closing inputs where the recording did, and reads every recorded output to EOF
+func Replay(ctx context.Context, session io.Reader, opts ReplayOptions) (ReplayResult, error) {
+	var result ReplayResult
+	br := bufio.NewReader(session)
+	cfg, err := readSessionHeader(br)
+	if err != nil {
+		return result, err
+	}
+	if opts.Config != nil {
+		cfg = opts.Config.Clone()
+	}
+	var records []sessionRecord
+	for {
+		rec, err := readSessionRecord(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		records = append(records, rec)
+	}
+	for _, rec := range records {
+		if rec.kind != recRead {
+			continue
+		}
+		for len(result.Recorded) <= rec.index {
+			result.Recorded = append(result.Recorded, nil)
+		}
+		result.Recorded[rec.index] = append(result.Recorded[rec.index], rec.data...)
+	}
+	result.Replayed = make([][]byte, len(result.Recorded))
+
+	ae := NewAudioEngine(Stream, cfg)
+	if err := ae.Start(ctx); err != nil {
+		return result, err
+	}
+	defer ae.Close()
+	var wg sync.WaitGroup
+	for i := range result.Recorded {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var out bytes.Buffer
+			io.Copy(&out, ae.OutputReader(i))
+			result.Replayed[i] = out.Bytes()
+		}()
+	}
+
+	start := time.Now()
+	var feedErr error
+	for _, rec := range records {
+		if rec.kind == recRead {
+			continue
+		}
+		if opts.Realtime {
+			select {
+			case <-time.After(rec.at - time.Since(start)):
+			case <-ctx.Done():
+				feedErr = ctx.Err()
+			}
+		}
+		if feedErr != nil {
+			break
+		}
+		switch {
+		case rec.kind == recCloseInput && rec.index == allInputs:
+			ae.CloseInput()
+		case rec.kind == recCloseInput:
+			feedErr = ae.processor.CloseInputAt(rec.index)
+		default:
+			feedErr = ae.write(rec.index, rec.data)
+		}
+		if feedErr != nil {
+			break
+		}
+	}
+	// inputs the recording left open would keep ffmpeg waiting
+	ae.CloseInput()
+	wg.Wait()
+	err = ae.Wait()
+	if err == nil && feedErr != nil {
+		err = fmt.Errorf("replay: %w", feedErr)
+	}
+	return result, err
+}
+
+func readSessionHeader(r io.Reader) (formats.AudioConfig, error) {
+	var cfg formats.AudioConfig
+	header := make([]byte, len(sessionMagic)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return cfg, fmt.Errorf("session header: %w", err)
+	}
+	if string(header[:len(sessionMagic)]) != sessionMagic {
+		return cfg, errors.New("not an audio-go session")
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header[len(sessionMagic):]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return cfg, fmt.Errorf("session config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("session config: %w", err)
+	}
+	return cfg, nil
+}
+
+func readSessionRecord(r io.Reader) (sessionRecord, error) {
+	var head [14]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("session truncated: %w", err)
+		}
+		return sessionRecord{}, err
+	}
+	rec := sessionRecord{
+		kind:  head[0],
+		index: int(head[1]),
+		at:    time.Duration(binary.BigEndian.Uint64(head[2:])),
+		data:  make([]byte, binary.BigEndian.Uint32(head[10:])),
+	}
+	if _, err := io.ReadFull(r, rec.data); err != nil {
+		return rec, fmt.Errorf("session truncated: %w", err)
+	}
+	return rec, nil
+}
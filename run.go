@@ -0,0 +1,70 @@
+package audiogo
+
+import (
+	"context"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/QuincyGao/audio-go/file"
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// Result summary of a finished File mode run
+type Result struct {
+	OpType      formats.OpType
+	InputFiles  []string
+	OutputFiles []string
+	// OutputSizes bytes of every output file, same order as OutputFiles
+	OutputSizes []int64
+	Elapsed     time.Duration
+	// TraceID of the config
+	TraceID string
+}
+
+// RunFile runs cfg in File mode and blocks until ffmpeg exits
+func RunFile(ctx context.Context, cfg formats.AudioConfig) (Result, error) {
+	result := Result{
+		OpType:      cfg.OpType,
+		InputFiles:  cfg.InputFiles,
+		OutputFiles: cfg.OutputFiles,
+		TraceID:     cfg.TraceID,
+	}
+	if result.OpType == "" {
+		result.OpType = formats.FORMATCONVERT
+	}
+	start := time.Now()
+
+	engine := NewAudioEngine(File, cfg)
+	if err := engine.Start(ctx); err != nil {
+		return result, err
+	}
+	defer engine.Done()
+	err := engine.Wait()
+	result.Elapsed = time.Since(start)
+	if fh, ok := engine.processor.(*file.FileHandle); ok {
+		// OverwriteAutoRename may have picked other names
+		result.OutputFiles = fh.OutputFiles()
+	}
+	if err != nil {
+		return result, err
+	}
+
+	for _, path := range result.OutputFiles {
+		var size int64
+		if info, statErr := os.Stat(path); statErr == nil {
+			size = info.Size()
+		}
+		result.OutputSizes = append(result.OutputSizes, size)
+	}
+	return result, nil
+}
+
+// RunWithFiles runs the engine config as a template in File mode against in/out.
+// The template is left untouched, so one engine can serve concurrent runs
+func (ae *AudioEngine) RunWithFiles(ctx context.Context, in, out []string) (Result, error) {
+	cfg := ae.config.Clone()
+	cfg.InputFiles = slices.Clone(in)
+	cfg.OutputFiles = slices.Clone(out)
+	return RunFile(ctx, cfg)
+}
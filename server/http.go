@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	audiogo "github.com/QuincyGao/audio-go"
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// Handler converts uploads over HTTP: POST a multipart form whose "config"
+// part, or config query parameter, holds a JSON formats.AudioConfig and
+// whose "file" part, after the config, holds the audio. The converted
+// output 0 is the response body. Bad requests get 400, uploads over
+// MaxUpload 413 and failed conversions 422. A Stream conversion failing
+// after output was sent aborts the response so it is not taken as complete
+type Handler struct {
+	// Engine Stream pipes the upload through ffmpeg as it arrives, File
+	// stores it in TempDir first for containers ffmpeg must seek in, e.g. m4a
+	Engine audiogo.AudioEngineType
+	// TempDir of File mode uploads, empty uses os.TempDir
+	TempDir string
+	// MaxUpload request body limit in bytes, default 100 MiB
+	MaxUpload int64
+}
+
+// maxConfigSize bytes of a config part
+const maxConfigSize = 1 << 20
+
+// contentTypes response Content-Type per output format, others are octet streams
+var contentTypes = map[formats.AudioFileFormat]string{
+	formats.WAV:  "audio/wav",
+	formats.MP3:  "audio/mpeg",
+	formats.AAC:  "audio/aac",
+	formats.M4A:  "audio/mp4",
+	formats.FLAC: "audio/flac",
+	formats.OGG:  "audio/ogg",
+	formats.OPUS: "audio/ogg",
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "POST a multipart form", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := h.MaxUpload
+	if limit <= 0 {
+		limit = 100 << 20
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var cfg formats.AudioConfig
+	haveConfig := false
+	if q := r.URL.Query().Get("config"); q != "" {
+		if cfg, err = decodeConfig([]byte(q)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		haveConfig = true
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				err = errors.New("form has no file part")
+			}
+			httpError(w, err, http.StatusBadRequest)
+			return
+		}
+		switch part.FormName() {
+		case "config":
+			data, err := io.ReadAll(io.LimitReader(part, maxConfigSize))
+			if err == nil {
+				cfg, err = decodeConfig(data)
+			}
+			if err != nil {
+				httpError(w, err, http.StatusBadRequest)
+				return
+			}
+			haveConfig = true
+		case "file":
+			if !haveConfig {
+				http.Error(w, "config must come before the file part", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", contentType(cfg.GetOutputArg(0).AudioFileFormat))
+			if h.Engine == audiogo.File {
+				h.convertFile(r.Context(), w, cfg, part)
+			} else {
+				convertStream(r.Context(), w, cfg, part)
+			}
+			return
+		}
+	}
+}
+
+// convertStream pipes the upload through a Stream engine into the response
+func convertStream(ctx context.Context, w http.ResponseWriter, cfg formats.AudioConfig, part *multipart.Part) {
+	// the response starts while the upload is still read
+	http.NewResponseController(w).EnableFullDuplex()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	ae := audiogo.NewAudioEngine(audiogo.Stream, cfg)
+	if err := ae.Start(ctx); err != nil {
+		httpError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	defer ae.Close()
+
+	inDone := make(chan struct{})
+	go func() {
+		defer close(inDone)
+		in := ae.InputWriter(0)
+		if _, err := io.Copy(in, part); err != nil {
+			cancel(fmt.Errorf("upload: %w", err))
+			return
+		}
+		in.Close()
+	}()
+	cw := &countingWriter{w: w}
+	if _, err := io.Copy(cw, ae.OutputReader(0)); err != nil {
+		cancel(err)
+	}
+	<-inDone
+	err := ae.Wait()
+	if cause := context.Cause(ctx); cause != nil {
+		err = cause
+	}
+	if err == nil {
+		return
+	}
+	if cw.n > 0 {
+		panic(http.ErrAbortHandler)
+	}
+	httpError(w, err, http.StatusUnprocessableEntity)
+}
+
+// convertFile stores the upload, runs it in File mode and sends the output file
+func (h *Handler) convertFile(ctx context.Context, w http.ResponseWriter, cfg formats.AudioConfig, part *multipart.Part) {
+	dir, err := os.MkdirTemp(h.TempDir, "audiogo-*")
+	if err != nil {
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "input")
+	if ext := filepath.Ext(part.FileName()); ext != "" {
+		in += ext
+	}
+	f, err := os.Create(in)
+	if err != nil {
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	_, err = io.Copy(f, part)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		httpError(w, fmt.Errorf("upload: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	cfg.InputFiles = []string{in}
+	cfg.OutputFiles = []string{filepath.Join(dir, "output."+string(cfg.GetOutputArg(0).AudioFileFormat))}
+	res, err := audiogo.RunFile(ctx, cfg)
+	if err != nil {
+		httpError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	out, err := os.Open(res.OutputFiles[0])
+	if err != nil {
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer out.Close()
+	if len(res.OutputSizes) > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(res.OutputSizes[0], 10))
+	}
+	io.Copy(w, out)
+}
+
+func contentType(f formats.AudioFileFormat) string {
+	if ct, ok := contentTypes[f]; ok {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// httpError replies with status, 413 when the body outgrew MaxUpload
+func httpError(w http.ResponseWriter, err error, status int) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		status = http.StatusRequestEntityTooLarge
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// countingWriter bytes already sent, once > 0 the status is out
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
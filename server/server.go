@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	audiogo "github.com/QuincyGao/audio-go"
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// Request getters of the ConvertRequest message generated from convert.proto
+type Request interface {
+	GetConfig() []byte
+	GetAudio() []byte
+}
+
+// Stream server side of a bidirectional call, the stream generated by
+// protoc-gen-go-grpc for AudioGo.Convert satisfies it
+type Stream[Req Request, Resp any] interface {
+	Context() context.Context
+	Recv() (Req, error)
+	Send(Resp) error
+}
+
+// ChunkSize bytes of output per response
+const ChunkSize = 4096
+
+// limits on remote configs, each unit costs the server memory, an ffmpeg
+// round trip or a pipe
+const (
+	maxOutputBuffer = 4 << 20
+	maxDegradeTimes = 4
+	maxMergeInputs  = 8
+)
+
+// Convert serves one AudioGo.Convert call: the config of the first request
+// builds a Stream engine, audio of later requests feeds input 0 and output 0
+// goes back through newResponse. The server implementation only wraps it:
+//
+//	func (s *srv) Convert(stream pb.AudioGo_ConvertServer) error {
+//		return server.Convert(stream, func(b []byte) *pb.ConvertResponse {
+//			return &pb.ConvertResponse{Audio: b}
+//		})
+//	}
+func Convert[Req Request, Resp any](stream Stream[Req, Resp], newResponse func(audio []byte) Resp) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	cfg, err := decodeConfig(first.GetConfig())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancelCause(stream.Context())
+	defer cancel(nil)
+	ae := audiogo.NewAudioEngine(audiogo.Stream, cfg)
+	if err := ae.Start(ctx); err != nil {
+		return err
+	}
+	defer ae.Close()
+
+	inDone := make(chan struct{})
+	go func() {
+		defer close(inDone)
+		in := ae.InputWriter(0)
+		if audio := first.GetAudio(); len(audio) > 0 {
+			if _, err := in.Write(audio); err != nil {
+				return
+			}
+		}
+		for {
+			req, err := stream.Recv()
+			if err == io.EOF {
+				in.Close()
+				return
+			}
+			if err != nil {
+				cancel(fmt.Errorf("receive: %w", err))
+				return
+			}
+			if _, err := in.Write(req.GetAudio()); err != nil {
+				// ffmpeg is gone, Wait reports why
+				return
+			}
+		}
+	}()
+
+	out := ae.OutputReader(0)
+	buf := make([]byte, ChunkSize)
+	for {
+		n, err := out.Read(buf)
+		if n > 0 {
+			// the message owns its bytes until sent
+			if err := stream.Send(newResponse(append([]byte(nil), buf[:n]...))); err != nil {
+				cancel(fmt.Errorf("send: %w", err))
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	<-inDone
+	err = ae.Wait()
+	if cause := context.Cause(ctx); cause != nil {
+		err = cause
+	}
+	return err
+}
+
+// decodeConfig parses a client config. Clients are remote: fields touching
+// the server's files or choosing the binary it runs are refused, so are raw
+// filter strings, filters like amovie or ametadata=file= read and write
+// server paths. Typed settings (Gain, EQ, Loudness...) stay available
+func decodeConfig(data []byte) (formats.AudioConfig, error) {
+	var cfg formats.AudioConfig
+	if len(data) == 0 {
+		return cfg, errors.New("first request carries no config")
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("config: %w", err)
+	}
+	switch {
+	case len(cfg.InputFiles) > 0 || len(cfg.OutputFiles) > 0 || cfg.SDPFile != "":
+		return cfg, errors.New("config: InputFiles, OutputFiles and SDPFile are not allowed over the network")
+	case cfg.FFmpeg.Path != "" || len(cfg.FFmpeg.SearchPaths) > 0:
+		return cfg, errors.New("config: FFmpeg.Path and FFmpeg.SearchPaths are not allowed over the network")
+	case hasRawFilter(cfg):
+		return cfg, errors.New("config: raw Filters and Filter strings are not allowed over the network, use the typed settings")
+	case cfg.OutputBuffer != nil && cfg.OutputBuffer.Size > maxOutputBuffer:
+		return cfg, fmt.Errorf("config: OutputBuffer.Size over %d bytes is not allowed over the network", maxOutputBuffer)
+	case cfg.Degrade != nil && cfg.Degrade.Times > maxDegradeTimes:
+		return cfg, fmt.Errorf("config: Degrade.Times over %d is not allowed over the network", maxDegradeTimes)
+	case cfg.MergeInputs > maxMergeInputs:
+		return cfg, fmt.Errorf("config: MergeInputs over %d is not allowed over the network", maxMergeInputs)
+	}
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("config: %w", err)
+	}
+	return cfg, nil
+}
+
+// hasRawFilter cfg carries a hand written filter string anywhere
+func hasRawFilter(cfg formats.AudioConfig) bool {
+	if len(cfg.Filters) > 0 {
+		return true
+	}
+	if cfg.Degrade != nil && cfg.Degrade.Codec.Filter != "" {
+		return true
+	}
+	for _, arg := range slices.Concat(cfg.InputArgs, cfg.OutputArgs) {
+		if arg.Filter != "" {
+			return true
+		}
+	}
+	return false
+}
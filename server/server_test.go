@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+type request struct{ config, audio []byte }
+
+func (r *request) GetConfig() []byte { return r.config }
+func (r *request) GetAudio() []byte  { return r.audio }
+
+// fakeStream replays reqs, then io.EOF, and collects responses
+type fakeStream struct {
+	reqs []*request
+	out  []byte
+}
+
+func (s *fakeStream) Context() context.Context { return context.Background() }
+
+func (s *fakeStream) Recv() (*request, error) {
+	if len(s.reqs) == 0 {
+		return nil, io.EOF
+	}
+	r := s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return r, nil
+}
+
+func (s *fakeStream) Send(b []byte) error {
+	s.out = append(s.out, b...)
+	return nil
+}
+
+func TestConvert(t *testing.T) {
+	cfg, _ := json.Marshal(formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.ALAW}},
+	})
+	s := &fakeStream{reqs: []*request{{config: cfg}, {audio: make([]byte, 640)}, {audio: make([]byte, 160)}}}
+	if err := Convert(s, func(b []byte) []byte { return b }); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.out) != 400 {
+		t.Errorf("received %d bytes, want 400", len(s.out))
+	}
+
+	bad, _ := json.Marshal(formats.AudioConfig{
+		InputArgs:   []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.ALAW}},
+		OutputFiles: []string{"/etc/passwd"},
+	})
+	s = &fakeStream{reqs: []*request{{config: bad}}}
+	if err := Convert(s, func(b []byte) []byte { return b }); err == nil {
+		t.Error("config writing a server file accepted")
+	}
+
+	for _, cfg := range []formats.AudioConfig{
+		{Filters: []string{"amovie=/etc/passwd"}},
+		{InputArgs: []formats.AudioArgs{{AudioFileFormat: formats.S16LE, Filter: "ametadata=mode=print:file=/tmp/x"}}},
+		{OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.ALAW, Filter: "anull"}}},
+		{Degrade: &formats.Degrade{Codec: formats.AudioArgs{AudioFileFormat: formats.MP3, Filter: "anull"}}},
+	} {
+		data, _ := json.Marshal(cfg)
+		s = &fakeStream{reqs: []*request{{config: data}}}
+		if err := Convert(s, func(b []byte) []byte { return b }); err == nil {
+			t.Errorf("raw filter accepted: %s", data)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	cfg, _ := json.Marshal(formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+	})
+	srv := httptest.NewServer(&Handler{})
+	defer srv.Close()
+
+	post := func(parts ...[2]string) *http.Response {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for _, p := range parts {
+			pw, _ := mw.CreateFormFile(p[0], p[0])
+			pw.Write([]byte(p[1]))
+		}
+		mw.Close()
+		resp, err := http.Post(srv.URL, mw.FormDataContentType(), &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := post([2]string{"config", string(cfg)}, [2]string{"file", string(make([]byte, 800))})
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(data) != 400 {
+		t.Errorf("status %d, %d bytes, want 200 and 400", resp.StatusCode, len(data))
+	}
+
+	resp = post([2]string{"file", "x"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("file without config: status %d", resp.StatusCode)
+	}
+
+	evil, _ := json.Marshal(formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.MULAW}},
+		Filters:    []string{"amovie=/etc/passwd"},
+	})
+	resp = post([2]string{"config", string(evil)}, [2]string{"file", "x"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("raw filter config: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestConvertLimits(t *testing.T) {
+	base := func() formats.AudioConfig {
+		return formats.AudioConfig{
+			InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+			OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.ALAW}},
+		}
+	}
+	for name, set := range map[string]func(*formats.AudioConfig){
+		"OutputBuffer.Size": func(c *formats.AudioConfig) { c.OutputBuffer = &formats.OutputBuffer{Size: 1 << 40} },
+		"Degrade.Times": func(c *formats.AudioConfig) {
+			c.Degrade = &formats.Degrade{Codec: formats.AudioArgs{AudioFileFormat: formats.MP3}, Times: 1 << 20}
+		},
+		"MergeInputs": func(c *formats.AudioConfig) { c.MergeInputs = 1 << 20 },
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := base()
+			set(&cfg)
+			data, _ := json.Marshal(cfg)
+			s := &fakeStream{reqs: []*request{{config: data}}}
+			err := Convert(s, func(b []byte) []byte { return b })
+			if err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("Convert = %v, want %s refused", err, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package signals
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// Kind generated test signal type
+type Kind string
+
+const (
+	// Tone 1 kHz sine at -6 dBFS
+	Tone Kind = "tone"
+	// Sweep logarithmic sine sweep from 20 Hz to 0.45 * SampleRate
+	Sweep Kind = "sweep"
+	// SpeechNoise pink-ish noise gated at a syllabic rate, a stand-in for speech
+	SpeechNoise Kind = "speech_noise"
+	// Silence digital zero
+	Silence Kind = "silence"
+)
+
+// Kinds lists every signal GetTestSignal can generate
+func Kinds() []Kind {
+	return []Kind{Tone, Sweep, SpeechNoise, Silence}
+}
+
+// AudioArgs input args matching the PCM returned by GetTestSignal
+func AudioArgs(rate, channels int) formats.AudioArgs {
+	return formats.AudioArgs{AudioFileFormat: formats.S16LE, SampleRate: rate, Channels: channels}
+}
+
+// GetTestSignal returns dur of s16le interleaved PCM, every channel carries the same signal.
+// Output is deterministic so it can be compared across runs
+func GetTestSignal(kind Kind, rate, channels int, dur time.Duration) ([]byte, error) {
+	if rate <= 0 || channels <= 0 || dur <= 0 {
+		return nil, fmt.Errorf("invalid signal params: rate=%d channels=%d dur=%v", rate, channels, dur)
+	}
+	var gen func(i int) float64
+	switch kind {
+	case Tone:
+		gen = func(i int) float64 {
+			return 0.5 * math.Sin(2*math.Pi*1000*float64(i)/float64(rate))
+		}
+	case Sweep:
+		gen = sweep(rate, dur)
+	case SpeechNoise:
+		gen = speechNoise(rate)
+	case Silence:
+		gen = func(int) float64 { return 0 }
+	default:
+		return nil, fmt.Errorf("unknown signal kind: %s", kind)
+	}
+
+	n := int(int64(dur) * int64(rate) / int64(time.Second))
+	buf := make([]byte, n*channels*2)
+	for i := 0; i < n; i++ {
+		v := int16(math.Max(-1, math.Min(1, gen(i))) * math.MaxInt16)
+		for c := 0; c < channels; c++ {
+			binary.LittleEndian.PutUint16(buf[(i*channels+c)*2:], uint16(v))
+		}
+	}
+	return buf, nil
+}
+
+func sweep(rate int, dur time.Duration) func(int) float64 {
+	f0, f1 := 20.0, 0.45*float64(rate)
+	t1 := dur.Seconds()
+	k := math.Log(f1 / f0)
+	return func(i int) float64 {
+		t := float64(i) / float64(rate)
+		phase := 2 * math.Pi * f0 * t1 / k * (math.Exp(t/t1*k) - 1)
+		return 0.5 * math.Sin(phase)
+	}
+}
+
+// speechNoise Paul Kellet's pink filter over seeded white noise,
+// amplitude modulated at 4 Hz with short pauses
+func speechNoise(rate int) func(int) float64 {
+	rng := rand.New(rand.NewPCG(1, 2))
+	var b0, b1, b2 float64
+	return func(i int) float64 {
+		white := rng.Float64()*2 - 1
+		b0 = 0.99765*b0 + white*0.0990460
+		b1 = 0.96300*b1 + white*0.2965164
+		b2 = 0.57000*b2 + white*1.0526913
+		pink := (b0 + b1 + b2 + white*0.1848) * 0.11
+		t := float64(i) / float64(rate)
+		envelope := math.Max(0, math.Sin(2*math.Pi*4*t))
+		return pink * envelope
+	}
+}
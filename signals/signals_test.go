@@ -0,0 +1,114 @@
+package signals
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/pcm"
+)
+
+// channel samples of one channel of s16le interleaved PCM
+func channel(data []byte, channels, c int) []int16 {
+	var out []int16
+	for i := c * 2; i+2 <= len(data); i += channels * 2 {
+		out = append(out, int16(binary.LittleEndian.Uint16(data[i:])))
+	}
+	return out
+}
+
+// crossings sign changes from negative to non-negative
+func crossings(s []int16) int {
+	n := 0
+	for i := 1; i < len(s); i++ {
+		if s[i-1] < 0 && s[i] >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTone(t *testing.T) {
+	data, err := GetTestSignal(Tone, 8000, 2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 8000*2*2 {
+		t.Fatalf("got %d bytes, want %d", len(data), 8000*2*2)
+	}
+	left, right := channel(data, 2, 0), channel(data, 2, 1)
+	// 1 kHz at 8 kHz repeats every 8 samples: 0, peak, 0, -peak, ...
+	want := []int16{0, 11584, 16383, 11584, 0, -11584, -16383, -11584}
+	for i, v := range want {
+		if left[i] != v {
+			t.Errorf("sample %d = %d, want %d", i, left[i], v)
+		}
+	}
+	if !slices.Equal(left, right) {
+		t.Error("channels differ")
+	}
+	if n := crossings(left); n < 999 || n > 1000 {
+		t.Errorf("%d cycles in 1s, want 1000", n)
+	}
+	// a -6 dBFS peak sine has an RMS of -9 dBFS
+	if level := pcm.LevelDB(data, formats.S16LE); math.Abs(level+9.03) > 0.05 {
+		t.Errorf("level = %.2f dBFS, want -9.03", level)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	data, err := GetTestSignal(Sweep, 16000, 1, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := channel(data, 1, 0)
+	tenth := len(s) / 10
+	low, high := crossings(s[:tenth]), crossings(s[len(s)-tenth:])
+	// 20 Hz rising to 7.2 kHz: a few cycles in the first 200ms, thousands in the last
+	if low > 20 || high < 1000 {
+		t.Errorf("crossings first/last tenth = %d/%d, want a rising sweep", low, high)
+	}
+}
+
+func TestSpeechNoise(t *testing.T) {
+	a, err := GetTestSignal(SpeechNoise, 8000, 1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := GetTestSignal(SpeechNoise, 8000, 1, time.Second)
+	if !bytes.Equal(a, b) {
+		t.Fatal("two runs differ")
+	}
+	s := channel(a, 1, 0)
+	// the 4 Hz envelope is silent over the second half of each 250ms period
+	for _, i := range []int{1000 + 10, 3000 + 10, 5000 + 10} {
+		for _, v := range s[i : i+900] {
+			if v != 0 {
+				t.Fatalf("sample in a pause near %d is %d, want 0", i, v)
+			}
+		}
+	}
+	if level := pcm.LevelDB(a, formats.S16LE); level < -40 || level > -10 {
+		t.Errorf("level = %.2f dBFS, want speech-like", level)
+	}
+}
+
+func TestSilenceAndErrors(t *testing.T) {
+	data, err := GetTestSignal(Silence, 8000, 1, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, make([]byte, 1600)) {
+		t.Error("silence is not digital zero")
+	}
+	if _, err := GetTestSignal("chirp", 8000, 1, time.Second); err == nil {
+		t.Error("unknown kind accepted")
+	}
+	if _, err := GetTestSignal(Tone, 0, 1, time.Second); err == nil {
+		t.Error("zero rate accepted")
+	}
+}
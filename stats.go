@@ -0,0 +1,211 @@
+package audiogo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// Stats engine counters, CPU fields are filled once Wait returns
+type Stats struct {
+	BytesIn   int64
+	BytesOut  int64
+	ChunksIn  int64
+	ChunksOut int64
+	// WallTime from Start to Wait, or to now while running
+	WallTime time.Duration
+	// UserCPU/SystemCPU of every ffmpeg process of the engine
+	UserCPU   time.Duration
+	SystemCPU time.Duration
+	// TraceID of the config, e.g. as a metrics label
+	TraceID string
+	// Inputs/Outputs counters per stream index
+	Inputs  []StreamStats
+	Outputs []StreamStats
+	// DurationIn/DurationOut audio processed over all inputs and outputs,
+	// counted for raw PCM streams only
+	DurationIn  time.Duration
+	DurationOut time.Duration
+}
+
+// StreamStats counters of one input or output. Samples and Duration derive
+// from the byte count and the stream format, 0 for encoded formats
+type StreamStats struct {
+	Bytes int64
+	// Samples per channel
+	Samples  int64
+	Duration time.Duration
+}
+
+type engineStats struct {
+	bytesIn, bytesOut   atomic.Int64
+	chunksIn, chunksOut atomic.Int64
+
+	mu         sync.Mutex
+	startedAt  time.Time
+	finishedAt time.Time
+	userCPU    time.Duration
+	systemCPU  time.Duration
+	// in/out bytes per stream index, config defaulted at start for their formats
+	in, out map[int]int64
+	config  formats.AudioConfig
+}
+
+func (s *engineStats) start(config formats.AudioConfig) {
+	config = config.Clone()
+	config.SetDefaults()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.startedAt = time.Now()
+	s.config = config
+}
+
+// count adds n bytes to the stream index of dir
+func (s *engineStats) count(dir *map[int]int64, index int, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if *dir == nil {
+		*dir = make(map[int]int64)
+	}
+	(*dir)[index] += int64(n)
+}
+
+// streams per index counters of one direction, indexes never used stay zero
+func streams(bytes map[int]int64, arg func(int) formats.AudioArgs) ([]StreamStats, time.Duration) {
+	if len(bytes) == 0 {
+		return nil, 0
+	}
+	out := make([]StreamStats, slices.Max(slices.Collect(maps.Keys(bytes)))+1)
+	var total time.Duration
+	for i, n := range bytes {
+		a := arg(i)
+		out[i] = StreamStats{Bytes: n, Samples: pcmSamples(n, a), Duration: pcmDuration(n, a)}
+		total += out[i].Duration
+	}
+	return out, total
+}
+
+// finish records wall time and rusage of exited processes
+func (s *engineStats) finish(p Processor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finishedAt = time.Now()
+	src, ok := p.(interface{ ProcessStates() []*os.ProcessState })
+	if !ok {
+		return
+	}
+	for _, state := range src.ProcessStates() {
+		if state != nil {
+			s.userCPU += state.UserTime()
+			s.systemCPU += state.SystemTime()
+		}
+	}
+}
+
+// Stats returns a snapshot, safe to call from any goroutine
+func (ae *AudioEngine) Stats() Stats {
+	st := &ae.stats
+	out := Stats{
+		BytesIn:   st.bytesIn.Load(),
+		BytesOut:  st.bytesOut.Load(),
+		ChunksIn:  st.chunksIn.Load(),
+		ChunksOut: st.chunksOut.Load(),
+		TraceID:   ae.config.TraceID,
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	switch {
+	case st.startedAt.IsZero():
+	case st.finishedAt.IsZero():
+		out.WallTime = time.Since(st.startedAt)
+	default:
+		out.WallTime = st.finishedAt.Sub(st.startedAt)
+	}
+	out.UserCPU = st.userCPU
+	out.SystemCPU = st.systemCPU
+	out.Inputs, out.DurationIn = streams(st.in, st.config.GetInputArg)
+	out.Outputs, out.DurationOut = streams(st.out, st.config.GetOutputArg)
+	return out
+}
+
+func (ae *AudioEngine) write(index int, data []byte) error {
+	return ae.writeContext(context.Background(), index, data)
+}
+
+// writeContext uses WriteToContext when the processor can abandon a stalled
+// write, a processor that can not fails a cancellable ctx with errors.ErrUnsupported
+func (ae *AudioEngine) writeContext(ctx context.Context, index int, data []byte) error {
+	if ae.processor == nil {
+		return ae.errUnknownType()
+	}
+	p, ok := ae.processor.(interface {
+		WriteToContext(context.Context, int, []byte) error
+	})
+	if !ok && ctx.Done() != nil {
+		return fmt.Errorf("write with a context: %w", errors.ErrUnsupported)
+	}
+	data, fault := ae.faults.beforeWrite(data)
+	var err error
+	if len(data) > 0 || fault == nil {
+		if ok {
+			err = p.WriteToContext(ctx, index, data)
+		} else {
+			err = ae.processor.WriteTo(index, data)
+		}
+		if err == nil {
+			ae.recorder.record(recWrite, index, data)
+			ae.stats.bytesIn.Add(int64(len(data)))
+			ae.stats.chunksIn.Add(1)
+			ae.stats.count(&ae.stats.in, index, len(data))
+		}
+	}
+	if fault != nil && err == nil {
+		ae.kill()
+		err = fault
+	}
+	return err
+}
+
+func (ae *AudioEngine) read(index int, p []byte) (int, error) {
+	return ae.readContext(context.Background(), index, p)
+}
+
+// readContext uses ReadFromContext when the processor supports read deadlines,
+// a processor that does not fails a cancellable ctx with errors.ErrUnsupported
+func (ae *AudioEngine) readContext(ctx context.Context, index int, p []byte) (int, error) {
+	if ae.processor == nil {
+		return 0, ae.errUnknownType()
+	}
+	r, ok := ae.processor.(interface {
+		ReadFromContext(context.Context, int, []byte) (int, error)
+	})
+	if !ok && ctx.Done() != nil {
+		return 0, fmt.Errorf("read with a context: %w", errors.ErrUnsupported)
+	}
+	p, err := ae.faults.limitRead(index, p)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	if ok {
+		n, err = r.ReadFromContext(ctx, index, p)
+	} else {
+		n, err = ae.processor.ReadFrom(index, p)
+	}
+	if n > 0 {
+		ae.faults.countRead(index, n)
+		ae.recorder.record(recRead, index, p[:n])
+		ae.stats.bytesOut.Add(int64(n))
+		ae.stats.chunksOut.Add(1)
+		ae.stats.count(&ae.stats.out, index, n)
+	}
+	return n, err
+}
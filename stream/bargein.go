@@ -0,0 +1,73 @@
+package stream
+
+import (
+	"sync"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/pcm"
+)
+
+// BargeInEvent input energy crossed the threshold while a prompt played
+type BargeInEvent struct {
+	// At input position where talking reached MinDuration
+	At time.Duration
+	// LevelDB RMS of the chunk that fired
+	LevelDB float64
+	// TraceID of the config
+	TraceID string
+}
+
+// bargeIn analyzes raw input 0 chunks before they reach ffmpeg, so the
+// event costs one chunk of latency instead of the whole pipeline
+type bargeIn struct {
+	cfg     formats.BargeIn
+	input   formats.AudioArgs
+	traceID string
+
+	mu    sync.Mutex
+	fn    func(BargeInEvent)
+	pos   time.Duration
+	above time.Duration
+	fired bool
+}
+
+// analyze returns true when the event fired on this chunk
+func (b *bargeIn) analyze(data []byte, playing bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	size := formats.SampleBytes(b.input.AudioFileFormat)
+	n := len(data) / size
+	dur := time.Duration(n/max(b.input.Channels, 1)) * time.Second / time.Duration(b.input.SampleRate)
+	b.pos += dur
+	if !playing {
+		b.above, b.fired = 0, false
+		return false
+	}
+	level := pcm.LevelDB(data[:n*size], b.input.AudioFileFormat)
+	if level < *b.cfg.ThresholdDB {
+		b.above = 0
+		return false
+	}
+	b.above += dur
+	if b.fired || b.above < b.cfg.MinDuration {
+		return false
+	}
+	b.fired = true
+	if b.fn != nil {
+		b.fn(BargeInEvent{At: b.pos, LevelDB: level, TraceID: b.traceID})
+	}
+	return true
+}
+
+// OnBargeIn registers fn for barge-in events, fn runs on the writing goroutine
+// and must return quickly. Requires BargeIn in the config
+func (s *StreamHandle) OnBargeIn(fn func(BargeInEvent)) {
+	s.bargeFn = fn
+}
+
+// SetPromptPlaying marks a prompt played outside Inject, e.g. by the caller's
+// own player, so barge-in is armed while it lasts
+func (s *StreamHandle) SetPromptPlaying(playing bool) {
+	s.promptPlaying.Store(playing)
+}
@@ -0,0 +1,109 @@
+package stream
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// chunk20ms s16le mono 8kHz samples alternating between v and -v, -32768 stays full scale
+func chunk20ms(v int16) []byte {
+	buf := make([]byte, 320)
+	for i := 0; i < 160; i++ {
+		s := v
+		if i%2 == 1 && v != -32768 {
+			s = -v
+		}
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(s))
+	}
+	return buf
+}
+
+func newTestBargeIn(threshold float64, events *[]BargeInEvent) *bargeIn {
+	return &bargeIn{
+		cfg:   formats.BargeIn{ThresholdDB: &threshold, MinDuration: 40 * time.Millisecond},
+		input: formats.AudioArgs{AudioFileFormat: formats.S16LE, SampleRate: 8000, Channels: 1},
+		fn:    func(ev BargeInEvent) { *events = append(*events, ev) },
+	}
+}
+
+func TestBargeInThreshold(t *testing.T) {
+	var events []BargeInEvent
+	b := newTestBargeIn(-30, &events)
+	// about -50 dBFS, below the threshold however long it lasts
+	for range 10 {
+		if b.analyze(chunk20ms(100), true) {
+			t.Fatal("fired below ThresholdDB")
+		}
+	}
+	// -6 dBFS, fires once MinDuration is reached
+	if b.analyze(chunk20ms(16384), true) {
+		t.Error("fired before MinDuration")
+	}
+	if !b.analyze(chunk20ms(16384), true) {
+		t.Error("did not fire after MinDuration")
+	}
+	if len(events) != 1 || events[0].At != 240*time.Millisecond || events[0].LevelDB < -7 {
+		t.Errorf("events = %+v, want one at 240ms near -6 dBFS", events)
+	}
+}
+
+func TestBargeInHold(t *testing.T) {
+	var events []BargeInEvent
+	b := newTestBargeIn(-30, &events)
+	// a quiet chunk between loud ones restarts MinDuration
+	for _, v := range []int16{16384, 100, 16384, 100} {
+		if b.analyze(chunk20ms(v), true) {
+			t.Fatal("fired on talking shorter than MinDuration")
+		}
+	}
+	// talking not over a prompt never counts
+	for range 5 {
+		if b.analyze(chunk20ms(16384), false) {
+			t.Fatal("fired without a prompt playing")
+		}
+	}
+	if len(events) != 0 {
+		t.Errorf("events = %+v, want none", events)
+	}
+}
+
+func TestBargeInRearm(t *testing.T) {
+	var events []BargeInEvent
+	b := newTestBargeIn(-30, &events)
+	fires := func() int {
+		n := 0
+		for range 5 {
+			if b.analyze(chunk20ms(16384), true) {
+				n++
+			}
+		}
+		return n
+	}
+	if n := fires(); n != 1 {
+		t.Fatalf("fired %d times during one prompt, want once", n)
+	}
+	// the prompt ends, the next one arms again
+	b.analyze(chunk20ms(0), false)
+	if n := fires(); n != 1 {
+		t.Errorf("fired %d times during the next prompt, want once", n)
+	}
+	if len(events) != 2 {
+		t.Errorf("got %d events, want 2", len(events))
+	}
+}
+
+func TestBargeInFullScale(t *testing.T) {
+	var events []BargeInEvent
+	b := newTestBargeIn(0, &events)
+	b.analyze(chunk20ms(16384), true)
+	if b.analyze(chunk20ms(16384), true) {
+		t.Error("-6 dBFS fired with ThresholdDB 0")
+	}
+	b.analyze(chunk20ms(-32768), true)
+	if !b.analyze(chunk20ms(-32768), true) {
+		t.Error("full scale did not fire with ThresholdDB 0")
+	}
+}
@@ -0,0 +1,107 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/pcm"
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+// pipeWriter adapts writePipe for the keepalive writer
+type pipeWriter struct {
+	s     *StreamHandle
+	ctx   context.Context
+	index int
+}
+
+func (w pipeWriter) Write(p []byte) (int, error) {
+	if err := w.s.writePipe(w.ctx, w.index, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writePipe writes data to input index, interrupted through a write deadline
+// when ctx ends. Pipes without deadlines, e.g. the windows loopback, block as before
+func (s *StreamHandle) writePipe(ctx context.Context, index int, data []byte) error {
+	w := s.stdins[index]
+	carried := len(s.pending[index])
+	if carried > 0 {
+		data = append(s.pending[index], data...)
+		s.pending[index] = nil
+	}
+	dl, ok := w.(interface{ SetWriteDeadline(time.Time) error })
+	if ok && ctx.Done() != nil {
+		fired := make(chan struct{})
+		stop := context.AfterFunc(ctx, func() {
+			// a deadline in the past wakes the blocked Write
+			dl.SetWriteDeadline(time.Unix(1, 0))
+			close(fired)
+		})
+		defer func() {
+			if !stop() {
+				<-fired
+			}
+			dl.SetWriteDeadline(time.Time{})
+		}()
+	}
+
+	n, err := w.Write(data)
+	if index < len(s.written) {
+		s.written[index].Add(int64(n))
+	}
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return err
+	}
+	// keep the byte stream aligned: finish what was started, drop the rest
+	switch {
+	case n < carried:
+		s.pending[index] = append([]byte(nil), data[n:carried]...)
+	case n > carried:
+		if frame := s.inputFrameSize(index); frame > 1 {
+			if part := (n - carried) % frame; part > 0 {
+				end := min(n+frame-part, len(data))
+				s.pending[index] = append([]byte(nil), data[n:end]...)
+			}
+		}
+	}
+	return fmt.Errorf("%w: %w", utils.ErrWriteStalled, context.Cause(ctx))
+}
+
+// inputFrameSize bytes per frame of raw PCM input index, 0 for encoded input
+func (s *StreamHandle) inputFrameSize(index int) int {
+	in := s.config.GetInputArg(index)
+	if formats.SampleBytes(in.AudioFileFormat) == 0 {
+		return 0
+	}
+	return pcm.FrameSize(in.AudioFileFormat, in.Channels)
+}
+
+// readPipe reads r, interrupted through a read deadline when ctx ends
+func readPipe(ctx context.Context, r io.Reader, p []byte) (int, error) {
+	dl, ok := r.(interface{ SetReadDeadline(time.Time) error })
+	if ok && ctx.Done() != nil {
+		fired := make(chan struct{})
+		stop := context.AfterFunc(ctx, func() {
+			dl.SetReadDeadline(time.Unix(1, 0))
+			close(fired)
+		})
+		defer func() {
+			if !stop() {
+				<-fired
+			}
+			dl.SetReadDeadline(time.Time{})
+		}()
+	}
+	n, err := r.Read(p)
+	if n == 0 && errors.Is(err, os.ErrDeadlineExceeded) {
+		return 0, fmt.Errorf("%w: %w", utils.ErrNoData, context.Cause(ctx))
+	}
+	return n, err
+}
@@ -0,0 +1,128 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+func TestWritePipeStalled(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	s := &StreamHandle{stdins: []io.WriteCloser{pw}, pending: make([][]byte, 1), written: make([]atomic.Int64, 1)}
+	// 6 byte frames, so a pipe buffer of a power of two ends inside one
+	s.config.InputArgs = []formats.AudioArgs{{AudioFileFormat: formats.S24LE, Channels: 2}}
+
+	// nobody reads, the pipe buffer fills up and the write must give up
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	chunk := make([]byte, 1<<20)
+	err = s.writePipe(ctx, 0, chunk)
+	if !errors.Is(err, utils.ErrWriteStalled) {
+		t.Fatalf("expected ErrWriteStalled, got %v", err)
+	}
+	// only the rest of the frame the write broke off is kept, the chunk is dropped
+	n, pending := int(s.written[0].Load()), len(s.pending[0])
+	if pending >= 6 || (n+pending)%6 != 0 {
+		t.Errorf("wrote %d, pending %d bytes, want the rest of the last frame only", n, pending)
+	}
+
+	// the deadline is cleared, a drained pipe accepts writes again
+	go io.Copy(io.Discard, pr)
+	if err := s.writePipe(context.Background(), 0, []byte{1, 2}); err != nil {
+		t.Errorf("write after stall failed: %v", err)
+	}
+	if len(s.pending[0]) != 0 {
+		t.Errorf("pending should be flushed, got %d bytes", len(s.pending[0]))
+	}
+}
+
+func TestReadPipeNoData(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pw.Close()
+	defer pr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := readPipe(ctx, pr, make([]byte, 16)); !errors.Is(err, utils.ErrNoData) {
+		t.Fatalf("expected ErrNoData, got %v", err)
+	}
+
+	pw.Write([]byte("ok"))
+	p := make([]byte, 16)
+	if n, err := readPipe(context.Background(), pr, p); err != nil || string(p[:n]) != "ok" {
+		t.Errorf("read after timeout = %q, %v", p[:n], err)
+	}
+}
+
+func TestWatchDeadlock(t *testing.T) {
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inR.Close()
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outW.Close()
+	defer outR.Close()
+	// ffmpeg wrote output nobody reads and stopped reading its input
+	outW.Write(make([]byte, 100))
+
+	s := &StreamHandle{
+		stdins:  []io.WriteCloser{inW},
+		stdouts: []io.ReadCloser{outR},
+		pending: make([][]byte, 1),
+		written: make([]atomic.Int64, 1),
+		read:    make([]atomic.Int64, 1),
+	}
+	s.config.DeadlockTimeout = 20 * time.Millisecond
+	ctx, stop := s.watchDeadlock(context.Background(), 0)
+	defer stop()
+	err = s.writePipe(ctx, 0, make([]byte, 1<<20))
+	var dl *DeadlockError
+	if !errors.Is(err, utils.ErrDeadlock) || !errors.As(err, &dl) {
+		t.Fatalf("expected a DeadlockError, got %v", err)
+	}
+	if out := dl.Pipes[1]; out.Name != "output 0" || (out.Buffered != 100 && out.Buffered != -1) {
+		t.Errorf("output pipe state %+v", out)
+	}
+}
+
+func TestKeepaliveFlushesPending(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+	s := &StreamHandle{stdins: []io.WriteCloser{pw}, pending: [][]byte{{7, 7}}, written: make([]atomic.Int64, 1)}
+	in := formats.AudioArgs{AudioFileFormat: formats.S16LE, SampleRate: 8000, Channels: 1}
+	k := newKeepalive(formats.Keepalive{After: time.Millisecond, Frame: 10 * time.Millisecond}, in)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go k.run(ctx, pipeWriter{s, ctx, 0}, func(b []byte) []byte { return b })
+
+	// the rest of the broken frame comes before the first filler frame
+	p := make([]byte, 2+160)
+	if _, err := io.ReadFull(pr, p); err != nil {
+		t.Fatal(err)
+	}
+	if p[0] != 7 || p[1] != 7 || p[2] != 0 {
+		t.Errorf("keepalive output starts %v, want the pending bytes first", p[:4])
+	}
+}
@@ -0,0 +1,132 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+// PipeState one pipe of a DeadlockError
+type PipeState struct {
+	// Name e.g. "input 0" or "output 1"
+	Name string
+	// Bytes written to the input or read from the output so far
+	Bytes int64
+	// Buffered output bytes waiting for a reader, -1 when the platform can not tell
+	Buffered int
+}
+
+// DeadlockError a write blocked for Blocked while ffmpeg output sat unread:
+// ffmpeg waits for its output to be read and stops reading input. Matches ErrDeadlock
+type DeadlockError struct {
+	Input   int
+	Blocked time.Duration
+	Pipes   []PipeState
+}
+
+func (e *DeadlockError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v: write to input %d blocked for %v while no output was read;", utils.ErrDeadlock, e.Input, e.Blocked)
+	for _, p := range e.Pipes {
+		fmt.Fprintf(&b, " %s %d bytes", p.Name, p.Bytes)
+		if p.Buffered >= 0 {
+			fmt.Fprintf(&b, " (%d buffered)", p.Buffered)
+		}
+		b.WriteByte(',')
+	}
+	return strings.TrimSuffix(b.String(), ",")
+}
+
+func (e *DeadlockError) Unwrap() error {
+	return utils.ErrDeadlock
+}
+
+// watchDeadlock checks every DeadlockTimeout while a write to input index
+// blocks, the returned ctx ends with a DeadlockError once no output was read
+// for a whole period and some output has data waiting
+func (s *StreamHandle) watchDeadlock(ctx context.Context, index int) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	go func() {
+		period := s.config.DeadlockTimeout
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		last := s.outputBytes()
+		for blocked := period; ; blocked += period {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+			now := s.outputBytes()
+			if now == last {
+				if err := s.diagnose(index, blocked); err != nil {
+					cancel(err)
+					return
+				}
+			}
+			last = now
+		}
+	}()
+	return ctx, func() {
+		close(done)
+		cancel(nil)
+	}
+}
+
+// outputBytes bytes read from every output so far
+func (s *StreamHandle) outputBytes() int64 {
+	var n int64
+	for i := range s.read {
+		n += s.read[i].Load()
+	}
+	return n
+}
+
+// diagnose reports the pipes when some output holds unread data, nil without evidence
+func (s *StreamHandle) diagnose(index int, blocked time.Duration) error {
+	e := &DeadlockError{Input: index, Blocked: blocked}
+	backedUp := false
+	for i := range s.written {
+		e.Pipes = append(e.Pipes, PipeState{Name: fmt.Sprintf("input %d", i), Bytes: s.written[i].Load(), Buffered: -1})
+	}
+	for i := range s.read {
+		buffered := s.outputBuffered(i)
+		backedUp = backedUp || buffered > 0
+		e.Pipes = append(e.Pipes, PipeState{Name: fmt.Sprintf("output %d", i), Bytes: s.read[i].Load(), Buffered: buffered})
+	}
+	if !backedUp {
+		return nil
+	}
+	return e
+}
+
+// outputBuffered unread bytes of output i in its ring and pipe, -1 when unknown
+func (s *StreamHandle) outputBuffered(i int) int {
+	n := 0
+	if i < len(s.rings) && s.rings[i] != nil {
+		r := s.rings[i]
+		n = int(r.tail.Load() - r.head.Load())
+	}
+	f, ok := s.stdouts[i].(*os.File)
+	if !ok {
+		if n > 0 {
+			return n
+		}
+		return -1
+	}
+	queued, ok := pipeQueued(f)
+	if !ok {
+		if n > 0 {
+			return n
+		}
+		return -1
+	}
+	return n + queued
+}
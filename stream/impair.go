@@ -0,0 +1,35 @@
+package stream
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// impairer decides per chunk whether to drop or delay it, one per input
+// so concurrent writers stay reproducible
+type impairer struct {
+	cfg formats.Impairment
+	rng *rand.Rand
+}
+
+func newImpairer(cfg formats.Impairment, index int) *impairer {
+	return &impairer{
+		cfg: cfg,
+		rng: rand.New(rand.NewPCG(cfg.Seed, uint64(index))),
+	}
+}
+
+// next returns whether the chunk is dropped and how long to hold it back
+func (im *impairer) next() (drop bool, delay time.Duration) {
+	// always draw all three values so the sequence does not depend on the outcome
+	dropRoll, delayRoll, delayLen := im.rng.Float64(), im.rng.Float64(), im.rng.Float64()
+	if dropRoll < im.cfg.DropRate {
+		return true, 0
+	}
+	if delayRoll < im.cfg.DelayRate {
+		return false, time.Duration(delayLen * float64(im.cfg.MaxDelay))
+	}
+	return false, 0
+}
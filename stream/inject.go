@@ -0,0 +1,150 @@
+package stream
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// InjectMode how an injected clip meets the live program
+type InjectMode int
+
+const (
+	// InjectDuck lowers the program by duckGain and mixes the clip on top
+	InjectDuck InjectMode = iota
+	// InjectReplace mutes the program while the clip plays
+	InjectReplace
+)
+
+// duckGain -12 dB
+var duckGain = math.Pow(10, -12.0/20)
+
+// injectSlack how far a clip may fall behind the wall clock before the part
+// nobody wrote input for is skipped
+const injectSlack = 200 * time.Millisecond
+
+// injector mixes queued clips into the primary s16le input before it reaches ffmpeg
+type injector struct {
+	mu   sync.Mutex
+	clip []byte
+	mode InjectMode
+	// started when the clip was injected, played clip bytes since, rate in
+	// bytes per second and frame bytes of the primary input
+	started time.Time
+	played  int
+	rate    float64
+	frame   int
+	// carry odd trailing byte of the last chunk, held back so program and
+	// clip samples stay aligned
+	carry []byte
+}
+
+// Inject queues clip, s16le PCM at the primary input SampleRate/Channels,
+// into the primary input. A clip injected while another plays replaces it.
+// The clip keeps wall-clock time: what falls into a gap of more than 200ms
+// between writes is skipped, use Keepalive to hear it through such gaps
+func (s *StreamHandle) Inject(clip []byte, mode InjectMode) error {
+	in := s.config.GetInputArg(0)
+	if in.AudioFileFormat != formats.S16LE {
+		return fmt.Errorf("inject needs a S16LE primary input, got %s", in.AudioFileFormat)
+	}
+	s.inject.mu.Lock()
+	defer s.inject.mu.Unlock()
+	s.inject.clip = append([]byte(nil), clip...)
+	s.inject.mode = mode
+	s.inject.started, s.inject.played = time.Now(), 0
+	s.inject.frame = 2 * max(in.Channels, 1)
+	s.inject.rate = float64(in.SampleRate * s.inject.frame)
+	return nil
+}
+
+// InjectFile decodes path with ffmpeg to the primary input format and injects it
+func (s *StreamHandle) InjectFile(ctx context.Context, path string, mode InjectMode) error {
+	in := s.config.GetInputArg(0)
+	if in.AudioFileFormat != formats.S16LE {
+		return fmt.Errorf("inject needs a S16LE primary input, got %s", in.AudioFileFormat)
+	}
+	bin, err := s.config.FFmpeg.LookPath("ffmpeg")
+	if err != nil {
+		return err
+	}
+	args := []string{"-v", "error", "-i", path}
+	args = append(args, formats.BuildOutputArgs(formats.AudioArgs{AudioFileFormat: formats.S16LE, SampleRate: in.SampleRate, Channels: in.Channels}, "pipe:1")...)
+	clip, err := exec.CommandContext(ctx, bin, args...).Output()
+	if err != nil {
+		return fmt.Errorf("decode inject clip %s: %w", path, err)
+	}
+	return s.Inject(clip, mode)
+}
+
+// mix returns data with the pending clip mixed in, data itself is never
+// modified. While a clip plays an odd trailing byte is held back for the next call
+func (j *injector) mix(data []byte) []byte {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.clip) == 0 && len(j.carry) == 0 {
+		return data
+	}
+	out := make([]byte, 0, len(j.carry)+len(data))
+	out = append(append(out, j.carry...), data...)
+	j.carry = nil
+	if len(j.clip) == 0 {
+		return out
+	}
+	if whole := len(out) &^ 1; whole < len(out) {
+		j.carry = []byte{out[whole]}
+		out = out[:whole]
+	}
+	j.catchUp(len(out))
+	n := min(len(out), len(j.clip)) &^ 1
+	for i := 0; i < n; i += 2 {
+		program := float64(int16(binary.LittleEndian.Uint16(out[i:])))
+		clip := float64(int16(binary.LittleEndian.Uint16(j.clip[i:])))
+		switch j.mode {
+		case InjectReplace:
+			program = 0
+		default:
+			program *= duckGain
+		}
+		v := max(math.MinInt16, min(math.MaxInt16, program+clip))
+		binary.LittleEndian.PutUint16(out[i:], uint16(int16(v)))
+	}
+	j.clip, j.played = j.clip[n:], j.played+n
+	if len(j.clip) < 2 {
+		j.clip = nil
+	}
+	return out
+}
+
+// catchUp skips the part of the clip that was due while nobody wrote, so
+// the n bytes about to be mixed end at the clip's wall-clock position
+func (j *injector) catchUp(n int) {
+	if j.rate <= 0 {
+		return
+	}
+	due := int(time.Since(j.started).Seconds() * j.rate)
+	if behind := due - n - j.played; behind > int(injectSlack.Seconds()*j.rate) {
+		skip := min(behind/j.frame*j.frame, len(j.clip))
+		j.clip, j.played = j.clip[skip:], j.played+skip
+	}
+}
+
+// playing a clip is still being mixed in
+func (j *injector) playing() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.clip) > 0
+}
+
+// stop drops the rest of the current clip
+func (j *injector) stop() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.clip = nil
+}
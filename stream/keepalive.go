@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/pcm"
+)
+
+// keepalive serializes writes to input 0 and fills stalls with silence or noise
+type keepalive struct {
+	cfg   formats.Keepalive
+	input formats.AudioArgs
+	rng   *rand.Rand
+
+	mu        sync.Mutex
+	lastWrite time.Time
+	// floorDB tracked input noise floor, 0 until measured
+	floorDB float64
+}
+
+// floorRiseDB how far the floor may climb per chunk, so speech does not lift it
+const floorRiseDB = 0.1
+
+func newKeepalive(cfg formats.Keepalive, input formats.AudioArgs) *keepalive {
+	return &keepalive{
+		cfg:   cfg,
+		input: input,
+		rng:   rand.New(rand.NewPCG(1, 2)),
+	}
+}
+
+// write forwards caller data through mix and restarts the stall timer
+func (k *keepalive) write(w io.Writer, data []byte, mix func([]byte) []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.lastWrite = time.Now()
+	if k.cfg.MatchNoiseFloor {
+		k.trackFloor(data)
+	}
+	_, err := w.Write(mix(data))
+	return err
+}
+
+// trackFloor minimum follower over chunk RMS: drops at once, rises slowly,
+// digital silence is ignored so muted input does not pin it
+func (k *keepalive) trackFloor(data []byte) {
+	db := pcm.LevelDB(data, k.input.AudioFileFormat)
+	if math.IsInf(db, -1) {
+		return
+	}
+	if k.floorDB == 0 || db < k.floorDB {
+		k.floorDB = db
+	} else {
+		k.floorDB = min(db, k.floorDB+floorRiseDB)
+	}
+}
+
+// noiseDB comfort noise level, the measured floor when matching
+func (k *keepalive) noiseDB() float64 {
+	if k.cfg.MatchNoiseFloor && k.floorDB != 0 {
+		return k.floorDB
+	}
+	return k.cfg.NoiseDB
+}
+
+// run writes a filler frame every Frame once input stalled for After,
+// it returns when ctx ends or the pipe is closed
+func (k *keepalive) run(ctx context.Context, w io.Writer, mix func([]byte) []byte) {
+	k.mu.Lock()
+	k.lastWrite = time.Now()
+	k.mu.Unlock()
+	ticker := time.NewTicker(k.cfg.Frame)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		k.mu.Lock()
+		var err error
+		if time.Since(k.lastWrite) >= k.cfg.After {
+			_, err = w.Write(mix(k.frame()))
+		}
+		k.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// frame one Frame of filler, uniform noise scaled to noiseDB RMS or zeros
+func (k *keepalive) frame() []byte {
+	buf := make([]byte, k.cfg.FrameBytes(k.input))
+	if !k.cfg.Noise {
+		return buf
+	}
+	f := k.input.AudioFileFormat
+	peak := math.Pow(10, k.noiseDB()/20) * math.Sqrt(3)
+	for i := range len(buf) / formats.SampleBytes(f) {
+		pcm.PutSample(buf, f, i, (k.rng.Float64()*2-1)*peak)
+	}
+	return buf
+}
@@ -0,0 +1,123 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/pcm"
+)
+
+// chunkRecorder keeps every write as one chunk
+type chunkRecorder struct {
+	mu     sync.Mutex
+	chunks [][]byte
+}
+
+func (r *chunkRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chunks = append(r.chunks, bytes.Clone(p))
+	return len(p), nil
+}
+
+func (r *chunkRecorder) snapshot() [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]byte(nil), r.chunks...)
+}
+
+var keepaliveInput = formats.AudioArgs{AudioFileFormat: formats.S16LE, SampleRate: 8000, Channels: 1}
+
+func noMix(b []byte) []byte { return b }
+
+func TestKeepaliveFrame(t *testing.T) {
+	k := newKeepalive(formats.Keepalive{Frame: 20 * time.Millisecond}, keepaliveInput)
+	if f := k.frame(); len(f) != 320 || !bytes.Equal(f, make([]byte, 320)) {
+		t.Errorf("silence frame = %d bytes, want 320 zero bytes", len(f))
+	}
+	k = newKeepalive(formats.Keepalive{Frame: 20 * time.Millisecond, Noise: true, NoiseDB: -40}, keepaliveInput)
+	var frames []byte
+	for range 50 {
+		frames = append(frames, k.frame()...)
+	}
+	if level := pcm.LevelDB(frames, formats.S16LE); math.Abs(level+40) > 1 {
+		t.Errorf("comfort noise at %.2f dBFS, want -40", level)
+	}
+}
+
+func TestKeepaliveStall(t *testing.T) {
+	k := newKeepalive(formats.Keepalive{After: 150 * time.Millisecond, Frame: 10 * time.Millisecond}, keepaliveInput)
+	var out chunkRecorder
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go k.run(ctx, &out, noMix)
+
+	// a writer keeping pace gets no filler
+	speech := bytes.Repeat([]byte{1}, 80)
+	for range 10 {
+		if err := k.write(&out, speech, noMix); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for i, c := range out.snapshot() {
+		if !bytes.Equal(c, speech) {
+			t.Fatalf("chunk %d is filler while input kept flowing", i)
+		}
+	}
+	// once it stalls past After, silence frames follow
+	deadline := time.Now().Add(2 * time.Second)
+	for len(out.snapshot()) < 13 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	chunks := out.snapshot()
+	if len(chunks) < 13 {
+		t.Fatalf("got %d chunks, want filler after the stall", len(chunks))
+	}
+	for _, c := range chunks[10:] {
+		if !bytes.Equal(c, make([]byte, 160)) {
+			t.Fatalf("filler chunk %v, want 160 zero bytes", c[:4])
+		}
+	}
+}
+
+func TestKeepaliveNoiseFloor(t *testing.T) {
+	cfg := formats.Keepalive{Frame: 20 * time.Millisecond, Noise: true, NoiseDB: -60, MatchNoiseFloor: true}
+	k := newKeepalive(cfg, keepaliveInput)
+	if k.noiseDB() != -60 {
+		t.Errorf("noise before any input = %v, want NoiseDB", k.noiseDB())
+	}
+	var out chunkRecorder
+	// about -50 dBFS background, digital silence does not count
+	k.write(&out, chunk20ms(100), noMix)
+	k.write(&out, chunk20ms(0), noMix)
+	floor := k.noiseDB()
+	if math.Abs(floor+50.3) > 0.5 {
+		t.Fatalf("floor = %.2f, want about -50.3", floor)
+	}
+	// speech lifts the floor by floorRiseDB per chunk only
+	for range 5 {
+		k.write(&out, chunk20ms(16384), noMix)
+	}
+	if got := k.noiseDB(); math.Abs(got-(floor+5*floorRiseDB)) > 1e-9 {
+		t.Errorf("floor after speech = %.2f, want %.2f", got, floor+5*floorRiseDB)
+	}
+	// a quieter chunk drops it at once
+	k.write(&out, chunk20ms(30), noMix)
+	if got := k.noiseDB(); got > -60 {
+		t.Errorf("floor after a quiet chunk = %.2f, want it dropped", got)
+	}
+	// the filler follows the measured floor
+	var frames []byte
+	for range 50 {
+		frames = append(frames, k.frame()...)
+	}
+	if got := pcm.LevelDB(frames, formats.S16LE); math.Abs(got-k.noiseDB()) > 1 {
+		t.Errorf("comfort noise at %.2f dBFS, want the floor %.2f", got, k.noiseDB())
+	}
+}
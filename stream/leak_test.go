@@ -0,0 +1,63 @@
+package stream
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// openFDs counts the descriptors of this process, -1 without /proc
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+func TestNoFDLeakWithoutRun(t *testing.T) {
+	if openFDs() < 0 {
+		t.Skip("needs /proc/self/fd")
+	}
+	// Init only resolves the binary, it never runs
+	bin := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := formats.AudioConfig{
+		OpType:     formats.CHANNELSPLIT,
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE, SampleRate: 8000, Channels: 2}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		FFmpeg:     formats.FFmpegOptions{Path: bin},
+	}
+
+	before := openFDs()
+	s := NewStreamHandle(cfg.Clone())
+	if err := s.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if openFDs() <= before {
+		t.Fatal("Init opened no pipes")
+	}
+	s.Done()
+	if after := openFDs(); after != before {
+		t.Errorf("Done without Run leaked %d fds", after-before)
+	}
+
+	before = openFDs()
+	s = NewStreamHandle(cfg.Clone())
+	if err := s.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Start fails once the binary is gone
+	os.Remove(bin)
+	if err := s.Run(); err == nil {
+		t.Fatal("Run started a removed binary")
+	}
+	if after := openFDs(); after != before {
+		t.Errorf("failed Run leaked %d fds", after-before)
+	}
+}
@@ -0,0 +1,143 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+// extraPipe a split output or merge input beyond stdin/stdout
+type extraPipe struct {
+	// target url ffmpeg opens, e.g. pipe:3
+	target string
+	// child end passed through ExtraFiles, nil when ffmpeg connects by itself
+	child *os.File
+	// parent end behind WriteTo/ReadFrom
+	parent io.ReadWriteCloser
+}
+
+// isDirectOutput output i goes to OutputFiles[i] instead of a pipe: a sound
+// device, an HLS playlist, a network or push url, a named FIFO or a unix socket
+func (s *StreamHandle) isDirectOutput(i int) bool {
+	if f := s.config.GetOutputArg(i).AudioFileFormat; formats.IsSoundDevice(f) || f == formats.HLS {
+		return true
+	}
+	if i >= len(s.config.OutputFiles) {
+		return false
+	}
+	path := s.config.OutputFiles[i]
+	return formats.IsNetworkURL(path) || formats.IsPushURL(path) || utils.IsFIFO(path) || utils.IsSocket(path)
+}
+
+// outputTarget ffmpeg url of output i: its device or socket, pipe:1 or its
+// extra pipe, FIFOs are written through the fd the engine opened
+func (s *StreamHandle) outputTarget(i int) string {
+	switch {
+	case s.isDirectOutput(i) && s.fifo(i) == nil:
+		return directTarget(s.config.OutputFiles[i], s.config.PacketSize)
+	case i == 0:
+		return "pipe:1"
+	}
+	return s.extraOuts[i].target
+}
+
+// directTarget ffmpeg url of a device, network or unix socket output
+func directTarget(path string, packetSize int) string {
+	if utils.IsSocket(path) {
+		return "unix:" + path
+	}
+	return formats.NetworkTarget(path, packetSize)
+}
+
+// fifo opened FIFO of output i, nil for other outputs
+func (s *StreamHandle) fifo(i int) *os.File {
+	if i < len(s.fifos) {
+		return s.fifos[i]
+	}
+	return nil
+}
+
+// openFIFOs opens every named FIFO output once its reader is there, so
+// ffmpeg never blocks in open and a missing reader fails Init when ctx ends
+func (s *StreamHandle) openFIFOs(ctx context.Context) error {
+	s.fifos = make([]*os.File, len(s.config.OutputFiles))
+	for i, path := range s.config.OutputFiles {
+		if !utils.IsFIFO(path) {
+			continue
+		}
+		f, err := utils.OpenFIFO(ctx, path)
+		if err != nil {
+			utils.CloseFiles(s.fifos)
+			return err
+		}
+		s.fifos[i] = f
+	}
+	return nil
+}
+
+// allocExtraPipes creates the transports for every extra live input or
+// output, it runs before args are built since they carry the targets
+func (s *StreamHandle) allocExtraPipes() error {
+	switch s.config.OpType {
+	case formats.CHANNELSPLIT, formats.FANOUT:
+		s.extraOuts = make([]*extraPipe, s.config.OutputCount())
+		fd := 3
+		for i := 1; i < len(s.extraOuts); i++ {
+			if f := s.fifo(i); f != nil {
+				s.extraOuts[i] = &extraPipe{target: fmt.Sprintf("pipe:%d", fd), child: f}
+				fd++
+				continue
+			}
+			if s.isDirectOutput(i) {
+				continue
+			}
+			p, err := newExtraPipe(fd, false)
+			if err != nil {
+				return fmt.Errorf("create output pipe %d: %w", i, err)
+			}
+			s.extraOuts[i] = p
+			fd++
+		}
+	case formats.AUDIOMERGE:
+		s.extraIns = make([]*extraPipe, s.config.MergeInputCount())
+		fd := 3
+		for i := 1; i < len(s.extraIns); i++ {
+			if s.isFileInput(i) {
+				continue
+			}
+			p, err := newExtraPipe(fd, true)
+			if err != nil {
+				return fmt.Errorf("create input pipe %d: %w", i, err)
+			}
+			s.extraIns[i] = p
+			fd++
+		}
+	}
+	return nil
+}
+
+// OutputFile read end of output index as *os.File, to hand ffmpeg output to
+// another process (exec.Cmd Stdin or ExtraFiles) without copying it through Go.
+// The engine keeps ownership and closes it once ffmpeg is waited for or Done
+// runs: do not Close it and do not mix it with ReadFrom. Not available with
+// OutputBuffer or VAD, which read the pipe themselves, so CHANNELSPLIT needs
+// UnbufferedOutputs, nor for windows extra outputs, which are sockets
+func (s *StreamHandle) OutputFile(index int) (*os.File, error) {
+	switch {
+	case s.vad != nil || s.config.OutputBuffer != nil:
+		return nil, fmt.Errorf("output %d is read by the engine", index)
+	case index < len(s.stdouts) && s.isDirectOutput(index):
+		return nil, fmt.Errorf("output %d goes to %s", index, s.config.OutputFiles[index])
+	case index >= len(s.stdouts) || s.stdouts[index] == nil:
+		return nil, fmt.Errorf("stdout index %d out of range", index)
+	}
+	f, ok := s.stdouts[index].(*os.File)
+	if !ok {
+		return nil, fmt.Errorf("output %d is no os pipe on this platform", index)
+	}
+	return f, nil
+}
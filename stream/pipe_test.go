@@ -0,0 +1,64 @@
+//go:build !windows
+
+package stream
+
+import (
+	"io"
+	"testing"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+func TestExtraPipes(t *testing.T) {
+	mono := formats.AudioArgs{AudioFileFormat: formats.S16LE, SampleRate: 8000, Channels: 1}
+	s := NewStreamHandle(formats.AudioConfig{
+		OpType:     formats.FANOUT,
+		InputArgs:  []formats.AudioArgs{mono},
+		OutputArgs: []formats.AudioArgs{mono, mono, mono},
+	})
+	if err := s.allocExtraPipes(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.release()
+	if len(s.extraOuts) != 3 || s.extraOuts[0] != nil {
+		t.Fatalf("extraOuts = %v, want outputs 1 and 2", s.extraOuts)
+	}
+	for i, want := range map[int]string{1: "pipe:3", 2: "pipe:4"} {
+		p := s.extraOuts[i]
+		if p.target != want || p.child == nil {
+			t.Errorf("output %d: target %q child %v, want %s through ExtraFiles", i, p.target, p.child, want)
+		}
+		// ffmpeg writes the child end, the engine reads the parent end
+		if _, err := p.child.Write([]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(p.parent, b); err != nil || b[0] != byte(i) {
+			t.Errorf("output %d read %v, %v", i, b, err)
+		}
+	}
+
+	m := NewStreamHandle(formats.AudioConfig{
+		OpType:      formats.AUDIOMERGE,
+		MergeMode:   formats.Mix,
+		InputArgs:   []formats.AudioArgs{mono},
+		OutputArgs:  []formats.AudioArgs{mono},
+		MergeInputs: 2,
+	})
+	if err := m.allocExtraPipes(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.release()
+	p := m.extraIns[1]
+	if p == nil || p.target != "pipe:3" {
+		t.Fatalf("merge input 1 = %+v, want pipe:3", p)
+	}
+	// the engine writes the parent end, ffmpeg reads the child end
+	if _, err := p.parent.Write([]byte{9}); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(p.child, b); err != nil || b[0] != 9 {
+		t.Errorf("merge input read %v, %v", b, err)
+	}
+}
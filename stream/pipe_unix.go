@@ -0,0 +1,20 @@
+//go:build !windows
+
+package stream
+
+import (
+	"fmt"
+	"os"
+)
+
+// newExtraPipe an os.Pipe whose child end becomes ffmpeg fd
+func newExtraPipe(fd int, input bool) (*extraPipe, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	if input {
+		return &extraPipe{target: fmt.Sprintf("pipe:%d", fd), child: pr, parent: pw}, nil
+	}
+	return &extraPipe{target: fmt.Sprintf("pipe:%d", fd), child: pw, parent: pr}, nil
+}
@@ -0,0 +1,61 @@
+//go:build windows
+
+package stream
+
+import (
+	"net"
+)
+
+// newExtraPipe windows ignores ExtraFiles, so ffmpeg connects to a
+// loopback listener instead and the accepted conn carries the audio
+func newExtraPipe(_ int, _ bool) (*extraPipe, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return &extraPipe{target: "tcp://" + ln.Addr().String(), parent: newLoopbackConn(ln)}, nil
+}
+
+// loopbackConn accepts a single connection, Read/Write block until it arrives
+type loopbackConn struct {
+	ln    net.Listener
+	ready chan struct{}
+	conn  net.Conn
+	err   error
+}
+
+func newLoopbackConn(ln net.Listener) *loopbackConn {
+	c := &loopbackConn{ln: ln, ready: make(chan struct{})}
+	go func() {
+		c.conn, c.err = ln.Accept()
+		ln.Close()
+		close(c.ready)
+	}()
+	return c
+}
+
+func (c *loopbackConn) Read(p []byte) (int, error) {
+	<-c.ready
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.conn.Read(p)
+}
+
+func (c *loopbackConn) Write(p []byte) (int, error) {
+	<-c.ready
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.conn.Write(p)
+}
+
+// Close stops a pending Accept and closes the conn, which ffmpeg sees as EOF
+func (c *loopbackConn) Close() error {
+	c.ln.Close()
+	<-c.ready
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
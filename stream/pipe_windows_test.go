@@ -0,0 +1,46 @@
+//go:build windows
+
+package stream
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestLoopbackPipe(t *testing.T) {
+	p, err := newExtraPipe(3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.child != nil || !strings.HasPrefix(p.target, "tcp://127.0.0.1:") {
+		t.Fatalf("pipe = %+v, want a loopback target and no ExtraFiles", p)
+	}
+	// ffmpeg connects and writes, the engine reads the accepted conn
+	conn, err := net.Dial("tcp", strings.TrimPrefix(p.target, "tcp://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("pcm")); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	got, err := io.ReadAll(p.parent)
+	if err != nil || string(got) != "pcm" {
+		t.Errorf("read %q, %v", got, err)
+	}
+	p.parent.Close()
+
+	// Close before ffmpeg connected unblocks the accept
+	p, err = newExtraPipe(4, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.parent.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.parent.Write([]byte{1}); err == nil {
+		t.Error("write after Close succeeded")
+	}
+}
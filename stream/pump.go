@@ -0,0 +1,53 @@
+package stream
+
+import (
+	"io"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// startPumps drains every output into its ring buffer
+func (s *StreamHandle) startPumps() {
+	cfg := s.config.OutputBuffer
+	for i, out := range s.stdouts {
+		if out == nil {
+			s.rings = append(s.rings, nil)
+			continue
+		}
+		r := newRing(cfg.Size)
+		s.rings = append(s.rings, r)
+		frame := 1
+		if cfg.Overflow == formats.OverflowDrop {
+			arg := s.config.GetOutputArg(i)
+			frame = formats.SampleBytes(arg.AudioFileFormat) * max(arg.Channels, 1)
+		}
+		s.pumped.Add(1)
+		go s.pump(i, out, r, frame, cfg.Overflow)
+	}
+}
+
+// pump copies whole frames so a dropped chunk never splits a sample
+func (s *StreamHandle) pump(index int, src io.Reader, r *ring, frame int, policy formats.OverflowPolicy) {
+	defer s.pumped.Done()
+	chunk := max(int(r.capacity())/4/frame*frame, frame)
+	buf := make([]byte, chunk)
+	fill := 0
+	for {
+		n, err := src.Read(buf[fill:])
+		fill += n
+		if whole := fill / frame * frame; whole > 0 {
+			r.write(buf[:whole], policy)
+			fill = copy(buf, buf[whole:fill])
+		}
+		if err != nil {
+			if dropped := r.dropped.Load(); dropped > 0 {
+				s.logger.Debug("output buffer overflow", "output", index, "dropped_bytes", dropped)
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			r.finish(err)
+			return
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package stream
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// pipeQueued bytes waiting in the kernel pipe buffer of f (FIONREAD)
+func pipeQueued(f *os.File) (int, bool) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	var n int32
+	var errno syscall.Errno
+	// Control keeps the fd non-blocking, unlike Fd
+	err = rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCINQ, uintptr(unsafe.Pointer(&n)))
+	})
+	if err != nil || errno != 0 {
+		return 0, false
+	}
+	return int(n), true
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package stream
+
+import "os"
+
+// pipeQueued the kernel buffer of a pipe is only visible on linux
+func pipeQueued(f *os.File) (int, bool) {
+	return 0, false
+}
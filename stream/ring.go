@@ -0,0 +1,158 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+// ring single producer single consumer byte ring. Positions only grow and
+// each is stored by one side, so the data path takes no lock; the channels
+// only wake a blocked side. Growing swaps in a bigger buffer holding every
+// unread byte, the old one is never written again, so a reader still on it
+// sees valid data up to the tail it loaded
+type ring struct {
+	data atomic.Pointer[[]byte]
+	// head read position, tail write position
+	head atomic.Uint64
+	tail atomic.Uint64
+
+	readable chan struct{}
+	writable chan struct{}
+	// done closed by the producer after its last write, err is set before
+	done chan struct{}
+	err  error
+	// stop closed by close, unblocks both sides
+	stop     chan struct{}
+	stopOnce sync.Once
+	dropped  atomic.Int64
+}
+
+// newRing capacity is size rounded up to a power of two
+func newRing(size int) *ring {
+	buf := make([]byte, 1<<bits.Len(uint(size-1)))
+	r := &ring{
+		readable: make(chan struct{}, 1),
+		writable: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stop:     make(chan struct{}),
+	}
+	r.data.Store(&buf)
+	return r
+}
+
+// capacity current buffer size, a power of two
+func (r *ring) capacity() uint64 {
+	return uint64(len(*r.data.Load()))
+}
+
+// grow doubles the buffer until need more bytes fit, producer side only
+func (r *ring) grow(need uint64) {
+	old := *r.data.Load()
+	size := uint64(len(old))
+	t, h := r.tail.Load(), r.head.Load()
+	for size-(t-h) < need {
+		size *= 2
+	}
+	buf := make([]byte, size)
+	for pos := h; pos < t; {
+		start := pos & uint64(len(old)-1)
+		c := copy(buf[pos&(size-1):], old[start:start+min(t-pos, uint64(len(old))-start)])
+		pos += uint64(c)
+	}
+	r.data.Store(&buf)
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// write copies p in when it fits, otherwise per policy waits for room, drops p
+// whole or grows the buffer
+func (r *ring) write(p []byte, policy formats.OverflowPolicy) {
+	for len(p) > 0 {
+		t := r.tail.Load()
+		free := r.capacity() - (t - r.head.Load())
+		if free < uint64(len(p)) {
+			switch policy {
+			case formats.OverflowDrop:
+				r.dropped.Add(int64(len(p)))
+				return
+			case formats.OverflowGrow:
+				r.grow(uint64(len(p)))
+				continue
+			}
+		}
+		if free == 0 {
+			select {
+			case <-r.writable:
+				continue
+			case <-r.stop:
+				return
+			}
+		}
+		buf := *r.data.Load()
+		n := min(free, uint64(len(p)))
+		start := t & uint64(len(buf)-1)
+		c := copy(buf[start:], p[:n])
+		copy(buf, p[c:n])
+		r.tail.Store(t + n)
+		notify(r.readable)
+		p = p[n:]
+	}
+}
+
+// finish marks the end of data, readers get err (io.EOF when nil) once drained
+func (r *ring) finish(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	r.err = err
+	close(r.done)
+}
+
+func (r *ring) read(p []byte) (int, error) {
+	return r.readContext(context.Background(), p)
+}
+
+// readContext returns ErrNoData when ctx ends before data arrives
+func (r *ring) readContext(ctx context.Context, p []byte) (int, error) {
+	for {
+		h := r.head.Load()
+		if avail := r.tail.Load() - h; avail > 0 {
+			// loaded after the tail, so it holds every byte before it
+			buf := *r.data.Load()
+			n := min(avail, uint64(len(p)))
+			start := h & uint64(len(buf)-1)
+			c := copy(p[:n], buf[start:])
+			copy(p[c:n], buf)
+			r.head.Store(h + n)
+			notify(r.writable)
+			return int(n), nil
+		}
+		select {
+		case <-r.readable:
+		case <-r.done:
+			if r.tail.Load() == r.head.Load() {
+				return 0, r.err
+			}
+		case <-r.stop:
+			return 0, io.ErrClosedPipe
+		case <-ctx.Done():
+			return 0, fmt.Errorf("%w: %w", utils.ErrNoData, context.Cause(ctx))
+		}
+	}
+}
+
+func (r *ring) close() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
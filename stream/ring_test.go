@@ -0,0 +1,100 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+func TestRingWrap(t *testing.T) {
+	r := newRing(6)
+	if r.capacity() != 8 {
+		t.Fatalf("size = %d, want 8", r.capacity())
+	}
+	var want []byte
+	go func() {
+		for i := 0; i < 50; i++ {
+			r.write([]byte{byte(i), byte(i + 1), byte(i + 2)}, formats.OverflowBlock)
+		}
+		r.finish(nil)
+	}()
+	for i := 0; i < 50; i++ {
+		want = append(want, byte(i), byte(i+1), byte(i+2))
+	}
+
+	var got bytes.Buffer
+	p := make([]byte, 5)
+	for {
+		n, err := r.read(p)
+		got.Write(p[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("read %x, want %x", got.Bytes(), want)
+	}
+}
+
+func TestRingDrop(t *testing.T) {
+	r := newRing(8)
+	r.write([]byte{1, 2, 3, 4, 5, 6}, formats.OverflowDrop)
+	// does not fit whole, dropped
+	r.write([]byte{7, 8, 9, 10}, formats.OverflowDrop)
+	r.finish(nil)
+
+	got, _ := io.ReadAll(readerFunc(r.read))
+	if !bytes.Equal(got, []byte{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("read %v", got)
+	}
+	if r.dropped.Load() != 4 {
+		t.Errorf("dropped = %d, want 4", r.dropped.Load())
+	}
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestRingGrowSequential(t *testing.T) {
+	// one producer feeding two outputs in turn, as ffmpeg does for FANOUT,
+	// read one after another: a blocking ring would deadlock on the second
+	rings := []*ring{newRing(64 << 10), newRing(64 << 10)}
+	const total = 300 << 10
+	go func() {
+		chunk := make([]byte, 4<<10)
+		for off := 0; off < total; off += len(chunk) {
+			for i := range chunk {
+				chunk[i] = byte(off + i)
+			}
+			for _, r := range rings {
+				r.write(chunk, formats.OverflowGrow)
+			}
+		}
+		for _, r := range rings {
+			r.finish(nil)
+		}
+	}()
+	for i, r := range rings {
+		got, err := io.ReadAll(readerFunc(r.read))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != total {
+			t.Fatalf("output %d read %d bytes, want %d", i, len(got), total)
+		}
+		for j, b := range got {
+			if b != byte(j) {
+				t.Fatalf("output %d byte %d = %d, want %d", i, j, b, byte(j))
+			}
+		}
+	}
+	if c := rings[1].capacity(); c < total {
+		t.Errorf("capacity = %d, want at least %d", c, total)
+	}
+}
@@ -4,11 +4,17 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"os/exec"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/QuincyGao/audio-go/formats"
 	"github.com/QuincyGao/audio-go/utils"
+	"github.com/QuincyGao/audio-go/vad"
 )
 
 type StreamHandle struct {
@@ -19,6 +25,39 @@ type StreamHandle struct {
 	ctx     context.Context
 	cancel  context.CancelFunc
 	stderr  *utils.TailBuffer
+	// exited closed by the reaper once ffmpeg exited, waitErr is cmd.Wait's result
+	exited  chan struct{}
+	waitErr error
+	logger  *slog.Logger
+	vad     *vad.Detector
+	// stages codec round trip processes chained before cmd
+	stages []*exec.Cmd
+	links  []*os.File
+	// impairers per input, empty when Impairment is disabled
+	impairers []*impairer
+	// inject mixes prompt clips into the primary input
+	inject injector
+	// keepalive fills input 0 stalls, nil when Keepalive is disabled
+	keepalive *keepalive
+	// extraIns/extraOuts transports of live inputs/outputs past index 0, by index
+	extraIns  []*extraPipe
+	extraOuts []*extraPipe
+	// fifos named FIFO outputs opened by the engine, by output index
+	fifos []*os.File
+	// childEnds ffmpeg's ends of the stdin/stdout pipes, closed here once it runs
+	childEnds []*os.File
+	// bargeIn watches input 0 while a prompt plays, nil when BargeIn is disabled
+	bargeIn       *bargeIn
+	bargeFn       func(BargeInEvent)
+	promptPlaying atomic.Bool
+	// rings per output when OutputBuffer is set, ReadFrom reads them instead of stdouts
+	rings  []*ring
+	pumped sync.WaitGroup
+	// pending rest of a frame a timed out write left behind, per input
+	pending [][]byte
+	// written/read bytes moved through each input/output, for deadlock reports
+	written []atomic.Int64
+	read    []atomic.Int64
 }
 
 func NewStreamHandle(cfg formats.AudioConfig) *StreamHandle {
@@ -28,14 +67,32 @@ func NewStreamHandle(cfg formats.AudioConfig) *StreamHandle {
 }
 
 func (s *StreamHandle) Init(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil {
+			// pipes, FIFOs and stage links opened before the failure
+			s.release()
+		}
+	}()
 	s.config.SetDefaults()
 	if err := s.config.Validate(); err != nil {
 		return fmt.Errorf("configuration error: %w", err)
 	}
 
-	path, err := exec.LookPath("ffmpeg")
+	if s.config.VerifyDuration > 0 {
+		in, out := s.config.GetInputArg(0), s.config.GetOutputArg(0)
+		if !formats.IsRawPCM(in.AudioFileFormat) || !formats.IsRawPCM(out.AudioFileFormat) {
+			return fmt.Errorf("VerifyDuration needs raw PCM input and output in Stream mode, got %s to %s", in.AudioFileFormat, out.AudioFileFormat)
+		}
+	}
+	for i := range s.config.OutputArgs {
+		if out := s.config.GetOutputArg(i); out.SeekableOutput() {
+			return fmt.Errorf("OutputArgs[%d]: %s output needs a seekable file and can not be streamed, use File mode", i, out.AudioFileFormat)
+		}
+	}
+
+	path, err := s.config.FFmpeg.LookPath("ffmpeg")
 	if err != nil {
-		return fmt.Errorf("ffmpeg not found")
+		return err
 	}
 	s.stderr = &utils.TailBuffer{Limit: 2048}
 	var args []string
@@ -43,38 +100,93 @@ func (s *StreamHandle) Init(ctx context.Context) (err error) {
 	fastArgs := []string{"-analyzeduration", "0", "-probesize", "32", "-fflags", "+nobuffer", "-flags", "+low_delay"}
 	args = append(args, fastArgs...)
 
+	if err := s.openFIFOs(ctx); err != nil {
+		return err
+	}
+	if err := s.allocExtraPipes(); err != nil {
+		return err
+	}
 	switch s.config.OpType {
-	case formats.FORMATCONVERT:
+	case formats.FORMATCONVERT, formats.DEGRADE:
 		args = s.buildConvertArgs(args)
-	case formats.CHANNELSPLIT:
+	case formats.CHANNELSPLIT, formats.FANOUT:
 		args = s.buildSplitArgs(args)
 	case formats.AUDIOMERGE:
 		args = s.buildMergeArgs(args)
+	case formats.VADSEGMENT:
+		args = s.buildConvertArgs(args)
+		s.vad = s.newDetector()
 	default:
 		return fmt.Errorf("unsupported opType: %s", s.config.OpType)
 	}
 
 	s.ctx, s.cancel = context.WithCancel(ctx)
-	fmt.Printf("args: %+v\n", args)
+	s.logger = utils.TraceLogger(s.logger, s.config.TraceID)
+	s.logger.Debug("ffmpeg command", "path", path, "args", args)
+	errOut := io.MultiWriter(s.stderr, &utils.LogWriter{Logger: s.logger, Msg: "ffmpeg stderr"})
 	s.cmd = exec.CommandContext(s.ctx, path, args...)
-	s.cmd.Stderr = s.stderr
+	s.cmd.Stderr = errOut
+	for i, stageArgs := range formats.BuildStagesArgs(&s.config, s.primarySource()) {
+		if i == 0 {
+			stageArgs = append(s.liveArgs(0), stageArgs...)
+		}
+		// a copy per stage, appending to shared spare capacity would let stages overwrite each other's args
+		stage := exec.CommandContext(s.ctx, path, append(slices.Clone(fastArgs), stageArgs...)...)
+		s.logger.Debug("ffmpeg stage command", "args", stage.Args[1:])
+		stage.Stderr = errOut
+		s.stages = append(s.stages, stage)
+	}
 	if err := s.setupPipes(); err != nil {
 		return err
 	}
+	if s.config.Impairment != nil {
+		for i := range s.stdins {
+			s.impairers = append(s.impairers, newImpairer(*s.config.Impairment, i))
+		}
+	}
+	if s.config.Keepalive != nil && len(s.stdins) > 0 && s.stdins[0] != nil {
+		s.keepalive = newKeepalive(*s.config.Keepalive, s.config.GetInputArg(0))
+	}
+	s.pending = make([][]byte, len(s.stdins))
+	s.written = make([]atomic.Int64, len(s.stdins))
+	s.read = make([]atomic.Int64, len(s.stdouts))
+	if s.config.BargeIn != nil {
+		s.bargeIn = &bargeIn{cfg: *s.config.BargeIn, input: s.config.GetInputArg(0), traceID: s.config.TraceID, fn: s.bargeFn}
+	}
 	return nil
 }
 
 // non-block
 func (s *StreamHandle) Run() error {
-	if err := s.cmd.Start(); err != nil {
-		s.closeAllPipes()
+	if err := utils.StartStages(append(s.stages, s.cmd)); err != nil {
+		s.release()
 		return err
 	}
-	for _, f := range s.cmd.ExtraFiles {
-		if f != nil {
-			f.Close()
+	// ffmpeg holds its own copies now
+	s.closeChildEnds()
+	// reap at once, so Alive sees a crash before anyone calls Wait
+	s.exited = make(chan struct{})
+	go func() {
+		s.waitErr = s.cmd.Wait()
+		close(s.exited)
+	}()
+	if nice, ok := s.config.Nice(); ok {
+		if err := utils.Renice(append(s.stages, s.cmd), nice); err != nil {
+			s.logger.Debug("renice ffmpeg", "nice", nice, "err", err)
 		}
 	}
+	if s.vad != nil {
+		go s.runDetector()
+	}
+	if s.config.OutputBuffer != nil && s.vad == nil {
+		s.startPumps()
+	}
+	if s.keepalive != nil {
+		// through writePipe like caller data, so a frame a stalled write left
+		// pending is completed before any filler
+		go s.keepalive.run(s.ctx, pipeWriter{s, s.ctx, 0}, s.inject.mix)
+	}
+	s.logger.Debug("ffmpeg started", "pid", s.cmd.Process.Pid)
 	return nil
 }
 
@@ -83,89 +195,292 @@ func (s *StreamHandle) Wait() error {
 		return nil
 	}
 
-	err := s.cmd.Wait()
+	// the pumps finish with ffmpeg's last output
+	s.pumped.Wait()
+	if s.exited == nil {
+		// never ran, cmd.Wait reports it
+		return s.cmd.Wait()
+	}
+	<-s.exited
+	err := s.waitErr
+	if stageErr := utils.WaitStages(s.stages); err == nil {
+		err = stageErr
+	}
+	s.logger.Debug("ffmpeg exited", "err", err)
 	if err != nil {
 		if s.ctx.Err() != nil {
 			return s.ctx.Err()
 		}
-		errMsg := s.stderr.String()
-		if errMsg != "" {
-			return fmt.Errorf("ffmpeg exit error: %w, stderr: %s", err, errMsg)
-		}
-		return fmt.Errorf("ffmpeg exit error: %w", err)
+		return utils.ExitError(err, s.stderr.String())
 	}
 	return nil
 }
 
 func (s *StreamHandle) buildConvertArgs(args []string) []string {
-	args = append(args, formats.BuildInputArgs(s.config.GetInputArg(0), "pipe:0")...)
-	if custom := s.config.GetFilterString(); custom != "" {
+	source := "pipe:0"
+	if len(s.config.CodecStages()) == 0 {
+		args = append(args, s.liveArgs(0)...)
+		source = s.primarySource()
+	}
+	args = append(args, formats.BuildInputArgs(s.config.MainInputArg(0), source)...)
+	if custom := formats.BuildConvertFilter(&s.config); custom != "" {
 		args = append(args, "-af", custom)
 	}
-	args = append(args, formats.BuildOutputArgs(s.config.GetOutputArg(0), "pipe:1")...)
+	args = append(args, s.config.BuildOutput(0, s.outputTarget(0))...)
 	return args
 }
 
 func (s *StreamHandle) buildSplitArgs(args []string) []string {
-	args = append(args, formats.BuildInputArgs(s.config.GetInputArg(0), "pipe:0")...)
+	args = append(args, s.liveArgs(0)...)
+	args = append(args, formats.BuildInputArgs(s.config.GetInputArg(0), s.primarySource())...)
 	fStr, tags := formats.BuildFilterComplex(&s.config)
 	args = append(args, "-filter_complex", fStr)
-	// 映射输出
-	args = append(args, "-map", tags[0])
-	args = append(args, formats.BuildOutputArgs(s.config.GetOutputArg(0), "pipe:1")...)
-	args = append(args, "-map", tags[1])
-	args = append(args, formats.BuildOutputArgs(s.config.GetOutputArg(1), "pipe:3")...)
+	// 映射输出: pipe:1, then pipe:3, pipe:4...
+	for i, tag := range tags {
+		args = append(args, "-map", tag)
+		args = append(args, s.config.BuildOutput(i, s.outputTarget(i))...)
+	}
 	return args
 }
 
 func (s *StreamHandle) buildMergeArgs(args []string) []string {
-	for i := 0; i < 2; i++ {
-		src := "pipe:0"
-		if i > 0 {
-			src = fmt.Sprintf("pipe:%d", i+2)
-		}
+	for i, src := range s.mergeSources() {
+		args = append(args, s.liveArgs(i)...)
 		args = append(args, formats.BuildInputArgs(s.config.GetInputArg(i), src)...)
 	}
 	fStr, tags := formats.BuildFilterComplex(&s.config)
 	args = append(args, "-filter_complex", fStr, "-map", tags[0])
-	args = append(args, formats.BuildOutputArgs(s.config.GetOutputArg(0), "pipe:1")...)
+	args = append(args, s.config.BuildOutput(0, s.outputTarget(0))...)
 	return args
 }
 
+// isFileInput input i reads InputFiles[i] instead of a live pipe: merge
+// inputs, SimulateLive, capture devices and sockets
+func (s *StreamHandle) isFileInput(i int) bool {
+	if i >= len(s.config.InputFiles) || s.config.InputFiles[i] == "" {
+		return false
+	}
+	return (s.config.OpType == formats.AUDIOMERGE && s.config.MergeFileInputs) || s.config.SimulateLive || s.isLiveSource(i)
+}
+
+// isLiveSource input i is a capture device, a socket or an RTP session, already real-time
+func (s *StreamHandle) isLiveSource(i int) bool {
+	if formats.IsSoundDevice(s.config.GetInputArg(i).AudioFileFormat) {
+		return true
+	}
+	if i >= len(s.config.InputFiles) {
+		return false
+	}
+	return formats.IsNetworkURL(s.config.InputFiles[i]) || formats.IsSDP(s.config.InputFiles[i])
+}
+
+// primarySource ffmpeg url of input 0, its file, device or pipe:0
+func (s *StreamHandle) primarySource() string {
+	if s.isFileInput(0) {
+		return s.config.InputFiles[0]
+	}
+	return "pipe:0"
+}
+
+// liveArgs file inputs are read at native rate, so they keep pace with live inputs and readers
+func (s *StreamHandle) liveArgs(i int) []string {
+	if s.isFileInput(i) && !s.isLiveSource(i) {
+		return []string{"-re"}
+	}
+	return nil
+}
+
+// mergeSources live inputs get pipe:0 for input 0, then their extra pipe
+// (pipe:3, pipe:4... or a loopback url on windows), file inputs read their InputFiles entry
+func (s *StreamHandle) mergeSources() []string {
+	var sources []string
+	for i := 0; i < s.config.MergeInputCount(); i++ {
+		switch {
+		case s.isFileInput(i):
+			sources = append(sources, s.config.InputFiles[i])
+		case i == 0:
+			sources = append(sources, "pipe:0")
+		default:
+			sources = append(sources, s.extraIns[i].target)
+		}
+	}
+	return sources
+}
+
 func (s *StreamHandle) setupPipes() error {
-	in0, _ := s.cmd.StdinPipe()
-	out0, _ := s.cmd.StdoutPipe()
+	// with codec stages pipe:0 belongs to the first stage: stdin -> stages -> cmd
+	first := s.cmd
+	if len(s.stages) > 0 {
+		first = s.stages[0]
+		links, err := utils.LinkStages(append(s.stages, s.cmd))
+		if err != nil {
+			return err
+		}
+		s.links = links
+	}
+	// own pipes instead of StdinPipe/StdoutPipe: exec only releases those
+	// through Start and Wait, a handle that never runs would leak them
+	var in0 io.WriteCloser
+	if !s.isFileInput(0) {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		first.Stdin = pr
+		s.childEnds = append(s.childEnds, pr)
+		in0 = pw
+	}
+	var out0 io.ReadCloser
+	if f := s.fifo(0); f != nil {
+		s.cmd.Stdout = f
+	} else if !s.isDirectOutput(0) {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		s.cmd.Stdout = pw
+		s.childEnds = append(s.childEnds, pw)
+		out0 = pr
+	}
 	s.stdins = append(s.stdins, in0)
 	s.stdouts = append(s.stdouts, out0)
 
-	if s.config.OpType == formats.CHANNELSPLIT {
-		pr, pw, _ := os.Pipe()
-		s.cmd.ExtraFiles = append(s.cmd.ExtraFiles, pw) // PW send FFmpeg (fd:3)
-		s.stdouts = append(s.stdouts, pr)
+	// child ends keep the fd order: ExtraFiles[0] is fd 3
+	for _, p := range s.extraOuts[min(1, len(s.extraOuts)):] {
+		if p == nil {
+			s.stdouts = append(s.stdouts, nil)
+			continue
+		}
+		if p.child != nil {
+			s.cmd.ExtraFiles = append(s.cmd.ExtraFiles, p.child)
+		}
+		s.stdouts = append(s.stdouts, p.parent)
 	}
-
-	if s.config.OpType == formats.AUDIOMERGE {
-		pr, pw, _ := os.Pipe()
-		s.cmd.ExtraFiles = append(s.cmd.ExtraFiles, pr) // PR send FFmpeg (fd:3)
-		s.stdins = append(s.stdins, pw)
+	for _, p := range s.extraIns[min(1, len(s.extraIns)):] {
+		if p == nil {
+			s.stdins = append(s.stdins, nil)
+			continue
+		}
+		if p.child != nil {
+			s.cmd.ExtraFiles = append(s.cmd.ExtraFiles, p.child)
+		}
+		s.stdins = append(s.stdins, p.parent)
 	}
 
 	return nil
 }
 
+func (s *StreamHandle) newDetector() *vad.Detector {
+	cfg := vad.Config{}
+	if s.config.VAD != nil {
+		cfg = *s.config.VAD
+	}
+	cfg.SampleRate = s.config.GetOutputArg(0).SampleRate
+	cfg.TraceID = s.config.TraceID
+	return vad.NewDetector(cfg)
+}
+
+// runDetector drains pipe:1 into the detector, segments channel closes on EOF
+func (s *StreamHandle) runDetector() {
+	defer s.vad.Close()
+	io.Copy(s.vad, s.stdouts[0])
+}
+
+// Segments speech segments of a VADSEGMENT stream, nil for other ops
+func (s *StreamHandle) Segments() <-chan vad.Segment {
+	if s.vad == nil {
+		return nil
+	}
+	return s.vad.Segments()
+}
+
+// Utterances end-of-utterance events of a VADSEGMENT stream, nil unless VAD.EndOfUtterance is set
+func (s *StreamHandle) Utterances() <-chan vad.Utterance {
+	if s.vad == nil {
+		return nil
+	}
+	return s.vad.Utterances()
+}
+
 func (s *StreamHandle) WriteTo(index int, data []byte) error {
+	return s.WriteToContext(context.Background(), index, data)
+}
+
+// WriteToContext writes input index, giving up with ErrWriteStalled once ctx
+// or WriteTimeout ends. A frame cut short is completed by the next write
+func (s *StreamHandle) WriteToContext(ctx context.Context, index int, data []byte) error {
+	if s.config.WriteTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.WriteTimeout)
+		defer cancel()
+	}
+	if s.config.DeadlockTimeout > 0 && index < len(s.stdins) {
+		var stop func()
+		ctx, stop = s.watchDeadlock(ctx, index)
+		defer stop()
+	}
+	if index < len(s.impairers) {
+		drop, delay := s.impairers[index].next()
+		if drop {
+			return nil
+		}
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-s.ctx.Done():
+				return s.ctx.Err()
+			}
+		}
+	}
+	if s.isFileInput(index) {
+		return fmt.Errorf("input %d reads file %s, it can not be written", index, s.config.InputFiles[index])
+	}
+	if index == 0 {
+		if s.bargeIn != nil {
+			playing := s.promptPlaying.Load() || s.inject.playing()
+			if s.bargeIn.analyze(data, playing) && s.bargeIn.cfg.StopPrompt {
+				s.inject.stop()
+			}
+		}
+		if s.keepalive != nil {
+			// mixed under the keepalive lock, so a filler frame can not take
+			// the byte the injector held back
+			return utils.PipeError(s.keepalive.write(pipeWriter{s, ctx, 0}, data, s.inject.mix))
+		}
+		data = s.inject.mix(data)
+	}
 	if index < len(s.stdins) && s.stdins[index] != nil {
-		_, err := s.stdins[index].Write(data)
-		return err
+		return utils.PipeError(s.writePipe(ctx, index, data))
 	}
 	return fmt.Errorf("stdin index %d out of range", index)
 }
 
 func (s *StreamHandle) ReadFrom(index int, p []byte) (int, error) {
-	if index < len(s.stdouts) && s.stdouts[index] != nil {
-		return s.stdouts[index].Read(p)
+	return s.ReadFromContext(context.Background(), index, p)
+}
+
+// ReadFromContext reads output index, returning ErrNoData when ctx ends before any output
+func (s *StreamHandle) ReadFromContext(ctx context.Context, index int, p []byte) (int, error) {
+	if s.vad != nil {
+		return 0, fmt.Errorf("output is consumed by VAD, use Segments")
 	}
-	return 0, fmt.Errorf("stdout index %d out of range", index)
+	if index < len(s.stdouts) && s.isDirectOutput(index) {
+		return 0, fmt.Errorf("output %d goes to %s and can not be read", index, s.config.OutputFiles[index])
+	}
+	var n int
+	var err error
+	switch {
+	case index < len(s.rings) && s.rings[index] != nil:
+		n, err = s.rings[index].readContext(ctx, p)
+	case index < len(s.stdouts) && s.stdouts[index] != nil:
+		n, err = readPipe(ctx, s.stdouts[index], p)
+	default:
+		return 0, fmt.Errorf("stdout index %d out of range", index)
+	}
+	if index < len(s.read) {
+		s.read[index].Add(int64(n))
+	}
+	return n, err
 }
 
 func (s *StreamHandle) CloseInput() {
@@ -176,8 +491,90 @@ func (s *StreamHandle) CloseInput() {
 	}
 }
 
+func (s *StreamHandle) CloseInputAt(index int) error {
+	if index < len(s.stdins) && s.stdins[index] != nil {
+		return s.stdins[index].Close()
+	}
+	return fmt.Errorf("stdin index %d out of range", index)
+}
+
+// ProcessStates exit states of ffmpeg and its stages, valid after Wait
+func (s *StreamHandle) ProcessStates() []*os.ProcessState {
+	var states []*os.ProcessState
+	for _, cmd := range append(s.stages, s.cmd) {
+		if cmd != nil {
+			states = append(states, cmd.ProcessState)
+		}
+	}
+	return states
+}
+
+// Alive ffmpeg was started, has not been cancelled and has not exited
+func (s *StreamHandle) Alive() bool {
+	if s.ctx == nil || s.ctx.Err() != nil || s.exited == nil {
+		return false
+	}
+	select {
+	case <-s.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// Kill kills ffmpeg without cancelling the handle, as a crash would
+func (s *StreamHandle) Kill() error {
+	if s.cmd == nil || s.cmd.Process == nil {
+		return nil
+	}
+	return s.cmd.Process.Kill()
+}
+
+// SetLogger receives the command line, lifecycle events and ffmpeg stderr
+// lines at debug level, call it before Init
+func (s *StreamHandle) SetLogger(l *slog.Logger) {
+	s.logger = l
+}
+
 func (s *StreamHandle) Done() {
-	s.cancel()
+	utils.Logger(s.logger).Debug("engine done")
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.cmd != nil && s.cmd.Process == nil {
+		// initialized but never run
+		s.release()
+		return
+	}
+	s.closeAllPipes()
+}
+
+// closeChildEnds closes the parent's copies of the pipe ends ffmpeg and its
+// stages use, once they run or when they never will
+func (s *StreamHandle) closeChildEnds() {
+	utils.CloseFiles(s.childEnds)
+	utils.CloseFiles(s.links)
+	utils.CloseFiles(s.fifos)
+	if s.cmd != nil {
+		utils.CloseFiles(s.cmd.ExtraFiles)
+	}
+	s.childEnds, s.links, s.fifos = nil, nil, nil
+}
+
+// release closes everything Init opened, for a handle that fails to start
+func (s *StreamHandle) release() {
+	s.closeChildEnds()
+	for _, p := range slices.Concat(s.extraIns, s.extraOuts) {
+		if p == nil {
+			continue
+		}
+		if p.child != nil {
+			p.child.Close()
+		}
+		if p.parent != nil {
+			p.parent.Close()
+		}
+	}
 	s.closeAllPipes()
 }
 
@@ -192,4 +589,7 @@ func (s *StreamHandle) closeAllPipes() {
 			out.Close()
 		}
 	}
+	for _, r := range s.rings {
+		r.close()
+	}
 }
@@ -0,0 +1,285 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+func TestMergeSources(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := formats.AudioConfig{
+		OpType:     formats.AUDIOMERGE,
+		MergeMode:  formats.Mix,
+		InputArgs:  []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs: []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		InputFiles: []string{"", "music.mp3", ""},
+		FFmpeg:     formats.FFmpegOptions{Path: bin},
+	}
+	sources := func(cfg formats.AudioConfig) []string {
+		s := NewStreamHandle(cfg)
+		if err := s.Init(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer s.Done()
+		return s.mergeSources()
+	}
+
+	// without the opt-in every input stays a live pipe
+	got := sources(cfg.Clone())
+	if len(got) != 3 || got[0] != "pipe:0" || got[1] == "music.mp3" {
+		t.Errorf("sources without MergeFileInputs = %v", got)
+	}
+	cfg.MergeFileInputs = true
+	got = sources(cfg.Clone())
+	if len(got) != 3 || got[0] != "pipe:0" || got[1] != "music.mp3" {
+		t.Errorf("sources with MergeFileInputs = %v", got)
+	}
+}
+
+func TestInjectOddChunks(t *testing.T) {
+	sample := func(v int16) []byte {
+		return binary.LittleEndian.AppendUint16(nil, uint16(v))
+	}
+	for _, mode := range []InjectMode{InjectDuck, InjectReplace} {
+		s := &StreamHandle{config: formats.AudioConfig{InputArgs: []formats.AudioArgs{{AudioFileFormat: formats.S16LE, SampleRate: 8000, Channels: 1}}}}
+		program := bytes.Repeat(sample(1000), 6)
+		if err := s.Inject(bytes.Repeat(sample(2000), 6), mode); err != nil {
+			t.Fatal(err)
+		}
+		// odd chunk sizes split samples between writes
+		var out []byte
+		for _, n := range []int{3, 1, 5, 3} {
+			out = append(out, s.inject.mix(program[:n])...)
+			program = program[n:]
+		}
+		want := int16(2000)
+		if mode == InjectDuck {
+			want = int16(1000*duckGain + 2000)
+		}
+		if !bytes.Equal(out, bytes.Repeat(sample(want), 6)) {
+			t.Errorf("mode %d: output %v, want 6 samples of %d", mode, out, want)
+		}
+		if s.inject.playing() {
+			t.Errorf("mode %d: clip not used up", mode)
+		}
+	}
+}
+
+func TestInjectWallClock(t *testing.T) {
+	s := &StreamHandle{config: formats.AudioConfig{InputArgs: []formats.AudioArgs{{AudioFileFormat: formats.S16LE, SampleRate: 8000, Channels: 1}}}}
+	if err := s.Inject(make([]byte, 32000), InjectDuck); err != nil {
+		t.Fatal(err)
+	}
+	// nobody wrote for the first second of the 2s clip
+	s.inject.started = time.Now().Add(-time.Second)
+	s.inject.mix(make([]byte, 320))
+	if left := len(s.inject.clip); left > 16100 || left < 15900 {
+		t.Errorf("%d clip bytes left after a 1s gap, want about 16000", left)
+	}
+}
+
+func TestVerifyDurationEncoded(t *testing.T) {
+	s := NewStreamHandle(formats.AudioConfig{
+		VerifyDuration: 50 * time.Millisecond,
+		InputArgs:      []formats.AudioArgs{{AudioFileFormat: formats.S16LE}},
+		OutputArgs:     []formats.AudioArgs{{AudioFileFormat: formats.MP3}},
+	})
+	if err := s.Init(context.Background()); err == nil || !strings.Contains(err.Error(), "VerifyDuration") {
+		t.Errorf("Init = %v, want a VerifyDuration error for mp3 output", err)
+	}
+}
+
+func TestImpairerSeed(t *testing.T) {
+	cfg := formats.Impairment{DropRate: 0.3, DelayRate: 0.4, MaxDelay: 50 * time.Millisecond, Seed: 42}
+	type decision struct {
+		drop  bool
+		delay time.Duration
+	}
+	run := func(cfg formats.Impairment, index int) []decision {
+		im := newImpairer(cfg, index)
+		var got []decision
+		for range 200 {
+			drop, delay := im.next()
+			got = append(got, decision{drop, delay})
+		}
+		return got
+	}
+	a, b := run(cfg, 0), run(cfg, 0)
+	drops, delays := 0, 0
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("chunk %d: %+v then %+v with the same Seed", i, a[i], b[i])
+		}
+		if a[i].drop {
+			drops++
+		} else if a[i].delay > 0 {
+			delays++
+		}
+		if a[i].delay > cfg.MaxDelay {
+			t.Errorf("chunk %d delay %v over MaxDelay", i, a[i].delay)
+		}
+	}
+	if drops == 0 || delays == 0 {
+		t.Errorf("drops = %d, delays = %d, want both", drops, delays)
+	}
+	// another input or Seed gets its own sequence
+	if slices.Equal(a, run(cfg, 1)) {
+		t.Errorf("input 1 repeats the sequence of input 0")
+	}
+	cfg.Seed++
+	if slices.Equal(a, run(cfg, 0)) {
+		t.Errorf("Seed %d repeats the sequence of Seed 42", cfg.Seed)
+	}
+}
+
+func TestSimulateLive(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pcm := formats.AudioArgs{AudioFileFormat: formats.S16LE, SampleRate: 8000, Channels: 1}
+	cfg := formats.AudioConfig{
+		OpType:       formats.FORMATCONVERT,
+		InputArgs:    []formats.AudioArgs{pcm},
+		OutputArgs:   []formats.AudioArgs{pcm},
+		InputFiles:   []string{"call.pcm"},
+		SimulateLive: true,
+		FFmpeg:       formats.FFmpegOptions{Path: bin},
+	}
+	// the file is read at native rate in place of pipe:0
+	readsLive := func(args []string) bool {
+		joined := strings.Join(args, " ")
+		re, in := strings.Index(joined, "-re "), strings.Index(joined, "-i call.pcm")
+		return re >= 0 && in > re && !strings.Contains(joined, "-i pipe:0")
+	}
+	init := func(cfg formats.AudioConfig) *StreamHandle {
+		s := NewStreamHandle(cfg)
+		if err := s.Init(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Done() })
+		return s
+	}
+
+	s := init(cfg.Clone())
+	if !readsLive(s.cmd.Args) {
+		t.Errorf("args %q do not read call.pcm live", s.cmd.Args)
+	}
+
+	// with codec stages the first stage reads the file instead
+	stages := cfg.Clone()
+	stages.PhoneSimulation = &formats.PhoneSimulation{G711: formats.MULAW}
+	s = init(stages)
+	if len(s.stages) == 0 || !readsLive(s.stages[0].Args) {
+		t.Fatalf("first stage does not read call.pcm live: %v", s.stages)
+	}
+	if slices.Contains(s.cmd.Args, "-re") {
+		t.Errorf("main process paced as well: %q", s.cmd.Args)
+	}
+
+	cfg.InputFiles = nil
+	if err := NewStreamHandle(cfg).Init(context.Background()); err == nil || !strings.Contains(err.Error(), "SimulateLive") {
+		t.Errorf("Init without InputFiles = %v", err)
+	}
+}
+
+func TestDeviceOutput(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pcm := formats.AudioArgs{AudioFileFormat: formats.S16LE, SampleRate: 8000, Channels: 1}
+	s := NewStreamHandle(formats.AudioConfig{
+		OpType:      formats.FANOUT,
+		InputArgs:   []formats.AudioArgs{pcm},
+		OutputArgs:  []formats.AudioArgs{pcm, {AudioFileFormat: formats.ALSA, SampleRate: 48000, Channels: 2}},
+		OutputFiles: []string{"", "hw:0,0"},
+		FFmpeg:      formats.FFmpegOptions{Path: bin},
+	})
+	if err := s.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Done()
+	if got := s.outputTarget(1); got != "hw:0,0" {
+		t.Errorf("outputTarget(1) = %q, want the device", got)
+	}
+	if !strings.Contains(strings.Join(s.cmd.Args, " "), "-f alsa hw:0,0") {
+		t.Errorf("args %q do not play to hw:0,0", s.cmd.Args)
+	}
+	if len(s.stdouts) > 1 && s.stdouts[1] != nil {
+		t.Error("the device output got a pipe")
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "ffmpeg")
+	// writes its output, then runs until its input ends
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\nprintf 'from ffmpeg'\ncat >/dev/null\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pcm := formats.AudioArgs{AudioFileFormat: formats.S16LE, SampleRate: 8000, Channels: 1}
+	cfg := formats.AudioConfig{
+		InputArgs:  []formats.AudioArgs{pcm},
+		OutputArgs: []formats.AudioArgs{pcm},
+		FFmpeg:     formats.FFmpegOptions{Path: bin},
+	}
+	s := NewStreamHandle(cfg.Clone())
+	if err := s.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Done()
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := s.OutputFile(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the pipe handed to a child reads ffmpeg output without going through Go
+	child := exec.Command("cat")
+	child.Stdin = f
+	var got bytes.Buffer
+	child.Stdout = &got
+	if err := child.Start(); err != nil {
+		t.Fatal(err)
+	}
+	s.CloseInput()
+	if err := child.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "from ffmpeg" {
+		t.Errorf("child read %q", got.String())
+	}
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	// engine read outputs have no pipe to hand out
+	buffered := cfg.Clone()
+	buffered.OutputBuffer = &formats.OutputBuffer{}
+	vadCfg := cfg.Clone()
+	vadCfg.OpType = formats.VADSEGMENT
+	for name, cfg := range map[string]formats.AudioConfig{"OutputBuffer": buffered, "VAD": vadCfg} {
+		s := NewStreamHandle(cfg)
+		if err := s.Init(context.Background()); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := s.OutputFile(0); err == nil || !strings.Contains(err.Error(), "read by the engine") {
+			t.Errorf("%s: OutputFile = %v, want rejected", name, err)
+		}
+		s.Done()
+	}
+}
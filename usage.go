@@ -0,0 +1,96 @@
+package audiogo
+
+import (
+	"context"
+	"time"
+
+	"github.com/QuincyGao/audio-go/file"
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// Usage final metering record of one engine run
+type Usage struct {
+	TraceID string
+	OpType  formats.OpType
+	// InputSeconds/OutputSeconds audio over all inputs and outputs: Stream
+	// mode counts raw PCM streams, File mode takes file sizes or ffprobe
+	InputSeconds  float64
+	OutputSeconds float64
+	// InputCodec/OutputCodec of input and output 0, the Codec when set, else the format
+	InputCodec  string
+	OutputCodec string
+	// CPUSeconds user plus system time of every ffmpeg process
+	CPUSeconds float64
+	WallTime   time.Duration
+	// Err the run ended with, nil on success and when Close cancelled it
+	Err error
+}
+
+// UsageEmitter receives one Usage per engine run, e.g. to forward it to a
+// billing queue. Emit runs on the goroutine calling Wait or Close
+type UsageEmitter interface {
+	Emit(Usage)
+}
+
+// UsageEmitterFunc adapts a function to UsageEmitter
+type UsageEmitterFunc func(Usage)
+
+func (f UsageEmitterFunc) Emit(u Usage) { f(u) }
+
+// WithUsage emits one Usage per run when it ends, in the first Wait or in
+// Close of a run never waited for. Kept by Reset, nil disables it
+func (ae *AudioEngine) WithUsage(e UsageEmitter) *AudioEngine {
+	ae.usage = e
+	return ae
+}
+
+// emitUsage sends the record of the run that just ended
+func (ae *AudioEngine) emitUsage(err error) {
+	ae.mu.Lock()
+	sent := ae.usageSent
+	ae.usageSent = true
+	ae.mu.Unlock()
+	if ae.usage == nil || sent {
+		return
+	}
+	cfg := ae.config.Clone()
+	cfg.SetDefaults()
+	st := ae.Stats()
+	u := Usage{
+		TraceID:     cfg.TraceID,
+		OpType:      cfg.OpType,
+		InputCodec:  codecName(cfg.GetInputArg(0)),
+		OutputCodec: codecName(cfg.GetOutputArg(0)),
+		CPUSeconds:  (st.UserCPU + st.SystemCPU).Seconds(),
+		WallTime:    st.WallTime,
+		Err:         err,
+	}
+	if fh, ok := ae.processor.(*file.FileHandle); ok {
+		ctx, cancel := ae.probeContext()
+		defer cancel()
+		u.InputSeconds = filesSeconds(ctx, cfg.FFmpeg, cfg.InputFiles, cfg.GetInputArg)
+		u.OutputSeconds = filesSeconds(ctx, cfg.FFmpeg, fh.OutputFiles(), cfg.GetOutputArg)
+	} else {
+		u.InputSeconds = st.DurationIn.Seconds()
+		u.OutputSeconds = st.DurationOut.Seconds()
+	}
+	ae.usage.Emit(u)
+}
+
+// filesSeconds total duration of files, those that can not be measured count 0
+func filesSeconds(ctx context.Context, ffmpeg formats.FFmpegOptions, paths []string, arg func(int) formats.AudioArgs) float64 {
+	var total time.Duration
+	for i, path := range paths {
+		if d, err := fileDuration(ctx, ffmpeg, path, arg(i)); err == nil {
+			total += d
+		}
+	}
+	return total.Seconds()
+}
+
+func codecName(a formats.AudioArgs) string {
+	if a.Codec != "" {
+		return a.Codec
+	}
+	return string(a.AudioFileFormat)
+}
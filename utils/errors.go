@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Sentinel errors classified from ffmpeg stderr, match them with errors.Is
+var (
+	ErrUnknownFormat    = errors.New("unknown or unsupported format")
+	ErrInvalidData      = errors.New("invalid or corrupted input data")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrBrokenPipe       = errors.New("broken pipe")
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrCodecNotFound    = errors.New("encoder or decoder not found")
+)
+
+// ErrWriteStalled a write did not complete before its context or WriteTimeout ended,
+// the chunk was dropped and the caller may move on
+var ErrWriteStalled = errors.New("write stalled")
+
+// ErrNoData a read found no output before its context ended, poll again later
+var ErrNoData = errors.New("no data available")
+
+// ErrDurationMismatch output duration differs from the input beyond VerifyDuration
+var ErrDurationMismatch = errors.New("output duration does not match input")
+
+// ErrDeadlock a write blocked while ffmpeg output sat unread, see DeadlockTimeout
+var ErrDeadlock = errors.New("deadlock: input blocked while output is not read")
+
+// ErrMaxRuntime a run outlived the engine's WithMaxRuntime cap and was cancelled
+var ErrMaxRuntime = errors.New("max runtime exceeded")
+
+// ErrOutputExists an output file exists and OverwritePolicy is OverwriteFail
+var ErrOutputExists = errors.New("output file already exists")
+
+// stderrSignatures most specific first, ffmpeg often ends with a generic "Invalid argument"
+var stderrSignatures = []struct {
+	err      error
+	patterns []string
+}{
+	{ErrCodecNotFound, []string{"Decoder not found", "Encoder not found", "Unknown decoder", "Unknown encoder", "codec not currently supported"}},
+	{ErrUnknownFormat, []string{"Unknown input format", "Requested output format", "Unable to find a suitable output format", "not a suitable output format"}},
+	{ErrPermissionDenied, []string{"Permission denied"}},
+	{ErrOutputExists, []string{"already exists. Exiting"}},
+	{ErrInvalidData, []string{"Invalid data found when processing input"}},
+	{ErrBrokenPipe, []string{"Broken pipe"}},
+	{ErrInvalidArgument, []string{"Invalid argument", "Unrecognized option", "Option not found", "Error parsing options"}},
+}
+
+// ClassifyStderr returns the sentinel matching ffmpeg stderr, nil if none matches
+func ClassifyStderr(stderr string) error {
+	for _, sig := range stderrSignatures {
+		for _, p := range sig.patterns {
+			if strings.Contains(stderr, p) {
+				return sig.err
+			}
+		}
+	}
+	return nil
+}
+
+// ExitError wraps a failed ffmpeg run, the result matches both err and the classified sentinel
+func ExitError(err error, stderr string) error {
+	if stderr == "" {
+		return fmt.Errorf("ffmpeg exit error: %w", err)
+	}
+	if kind := ClassifyStderr(stderr); kind != nil {
+		return fmt.Errorf("ffmpeg exit error: %w: %w, stderr: %s", kind, err, stderr)
+	}
+	return fmt.Errorf("ffmpeg exit error: %w, stderr: %s", err, stderr)
+}
+
+// PipeError marks write errors caused by ffmpeg closing its end as ErrBrokenPipe
+func PipeError(err error) error {
+	if err == nil || errors.Is(err, ErrBrokenPipe) {
+		return err
+	}
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, os.ErrClosed) || errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("%w: %w", ErrBrokenPipe, err)
+	}
+	return err
+}
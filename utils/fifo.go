@@ -0,0 +1,15 @@
+package utils
+
+import "os"
+
+// IsFIFO path is an existing named pipe
+func IsFIFO(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// IsSocket path is an existing unix domain socket
+func IsSocket(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// OpenFIFO opens the named FIFO at path for writing once its reader is
+// there, polling until ctx ends. ffmpeg opening it itself would block with
+// no way to cancel when the reading daemon is not up yet
+func OpenFIFO(ctx context.Context, path string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			// ffmpeg expects blocking writes
+			if err := syscall.SetNonblock(int(f.Fd()), false); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("open fifo %s: %w", path, err)
+			}
+			return f, nil
+		}
+		if !errors.Is(err, syscall.ENXIO) {
+			return nil, fmt.Errorf("open fifo %s: %w", path, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("fifo %s has no reader: %w", path, ctx.Err())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
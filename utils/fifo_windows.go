@@ -0,0 +1,14 @@
+//go:build windows
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// OpenFIFO named FIFOs do not exist on windows
+func OpenFIFO(ctx context.Context, path string) (*os.File, error) {
+	return nil, fmt.Errorf("open fifo %s: named FIFOs are not supported on windows", path)
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"bytes"
+	"log/slog"
+	"sync"
+)
+
+// Logger returns l, or a logger discarding everything when l is nil
+func Logger(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return l
+}
+
+// TraceLogger l with a trace_id attribute, l itself when traceID is empty
+func TraceLogger(l *slog.Logger, traceID string) *slog.Logger {
+	l = Logger(l)
+	if traceID == "" {
+		return l
+	}
+	return l.With("trace_id", traceID)
+}
+
+// LogWriter logs every complete line written at debug level, safe for concurrent writers
+type LogWriter struct {
+	Logger  *slog.Logger
+	Msg     string
+	mu      sync.Mutex
+	partial []byte
+}
+
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		// ffmpeg ends progress lines with \r
+		i := bytes.IndexAny(w.partial, "\r\n")
+		if i < 0 {
+			break
+		}
+		if line := bytes.TrimSpace(w.partial[:i]); len(line) > 0 {
+			w.Logger.Debug(w.Msg, "line", string(line))
+		}
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
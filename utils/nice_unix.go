@@ -0,0 +1,18 @@
+//go:build !windows
+
+package utils
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Renice sets the niceness of started cmds, stopping at the first failure
+func Renice(cmds []*exec.Cmd, nice int) error {
+	for _, cmd := range cmds {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, cmd.Process.Pid, nice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
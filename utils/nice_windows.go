@@ -0,0 +1,10 @@
+//go:build windows
+
+package utils
+
+import "os/exec"
+
+// Renice niceness is a unix notion, windows keeps the default priority class
+func Renice(cmds []*exec.Cmd, nice int) error {
+	return nil
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+)
+
+// LinkStages connects stdout of every cmd to stdin of the next one.
+// The returned files are the parent's copies, close them once all cmds started
+func LinkStages(cmds []*exec.Cmd) ([]*os.File, error) {
+	var files []*os.File
+	for i := 0; i+1 < len(cmds); i++ {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			CloseFiles(files)
+			return nil, err
+		}
+		cmds[i].Stdout = pw
+		cmds[i+1].Stdin = pr
+		files = append(files, pr, pw)
+	}
+	return files, nil
+}
+
+// StartStages starts stages in order, already started ones are killed on failure
+func StartStages(cmds []*exec.Cmd) error {
+	for i, cmd := range cmds {
+		if err := cmd.Start(); err != nil {
+			for _, started := range cmds[:i] {
+				started.Process.Kill()
+				started.Wait()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitStages waits for every stage and returns the first error
+func WaitStages(cmds []*exec.Cmd) error {
+	var first error
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func CloseFiles(files []*os.File) {
+	for _, f := range files {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
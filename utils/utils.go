@@ -1,11 +1,17 @@
 package utils
 
+import "sync"
+
+// TailBuffer keeps the last Limit bytes written, safe for concurrent writers
 type TailBuffer struct {
 	Limit int
+	mu    sync.Mutex
 	data  []byte
 }
 
 func (b *TailBuffer) Write(p []byte) (n int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	n = len(p)
 	b.data = append(b.data, p...)
 	if len(b.data) > b.Limit {
@@ -15,5 +21,14 @@ func (b *TailBuffer) Write(p []byte) (n int, err error) {
 }
 
 func (b *TailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	return string(b.data)
 }
+
+// Reset drops the kept bytes
+func (b *TailBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = nil
+}
@@ -0,0 +1,217 @@
+package vad
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const frameDuration = 20 * time.Millisecond
+
+// Config energy-based detector settings
+type Config struct {
+	// SampleRate of the s16le mono PCM fed to the detector
+	SampleRate int
+	// ThresholdDB frame RMS in dBFS above which a frame counts as speech
+	ThresholdDB float64
+	// MinSilence a pause must last this long to close a segment
+	MinSilence time.Duration
+	// MinSpeech segments shorter than this are dropped
+	MinSpeech time.Duration
+	// EndOfUtterance silence after the last segment that completes an utterance,
+	// at least MinSilence. 0 disables Utterances
+	EndOfUtterance time.Duration
+	// TraceID copied into every Segment and Utterance, Stream mode sets it
+	// from the AudioConfig
+	TraceID string
+}
+
+// SetDefaults fills in missing detector values with sensible defaults
+func (c *Config) SetDefaults() {
+	if c.SampleRate <= 0 {
+		c.SampleRate = 8000
+	}
+	if c.ThresholdDB == 0 {
+		c.ThresholdDB = -40
+	}
+	if c.MinSilence <= 0 {
+		c.MinSilence = 300 * time.Millisecond
+	}
+	if c.MinSpeech <= 0 {
+		c.MinSpeech = 100 * time.Millisecond
+	}
+	if c.EndOfUtterance > 0 && c.EndOfUtterance < c.MinSilence {
+		c.EndOfUtterance = c.MinSilence
+	}
+}
+
+// Segment a detected speech span, Start/End are offsets from the first sample
+type Segment struct {
+	Start time.Duration
+	End   time.Duration
+	// Audio s16le mono PCM of the segment
+	Audio []byte
+	// TraceID of the Config
+	TraceID string
+}
+
+// Utterance consecutive segments closed by EndOfUtterance silence. Byte
+// offsets index the s16le stream fed to the detector
+type Utterance struct {
+	Start     time.Duration
+	End       time.Duration
+	StartByte int64
+	EndByte   int64
+	// TraceID of the Config
+	TraceID string
+}
+
+// Detector consumes s16le mono PCM and emits speech segments
+type Detector struct {
+	config     Config
+	frameBytes int
+	segments   chan Segment
+
+	pending    []byte // partial frame carried to the next Write
+	offset     time.Duration
+	inSpeech   bool
+	start      time.Duration
+	silenceRun time.Duration
+	audio      []byte
+
+	utterances chan Utterance
+	utterOpen  bool
+	utterStart time.Duration
+	utterEnd   time.Duration
+}
+
+func NewDetector(cfg Config) *Detector {
+	cfg.SetDefaults()
+	samples := cfg.SampleRate * int(frameDuration) / int(time.Second)
+	d := &Detector{
+		config:     cfg,
+		frameBytes: samples * 2,
+		segments:   make(chan Segment, 16),
+	}
+	if cfg.EndOfUtterance > 0 {
+		d.utterances = make(chan Utterance, 16)
+	}
+	return d
+}
+
+// Utterances is closed after Close, nil when EndOfUtterance is 0
+func (d *Detector) Utterances() <-chan Utterance {
+	return d.utterances
+}
+
+// Segments is closed after Close
+func (d *Detector) Segments() <-chan Segment {
+	return d.segments
+}
+
+// Write feeds PCM, blocks when segments are not consumed
+func (d *Detector) Write(p []byte) (int, error) {
+	d.pending = append(d.pending, p...)
+	for len(d.pending) >= d.frameBytes {
+		d.process(d.pending[:d.frameBytes])
+		d.pending = d.pending[d.frameBytes:]
+	}
+	// compact so the backing array does not grow unbounded
+	d.pending = append([]byte(nil), d.pending...)
+	return len(p), nil
+}
+
+// Close flushes an open segment and closes the segments channel
+func (d *Detector) Close() error {
+	if d.inSpeech {
+		d.emit(d.offset - d.silenceRun)
+	}
+	close(d.segments)
+	if d.utterances != nil {
+		if d.utterOpen {
+			d.emitUtterance()
+		}
+		close(d.utterances)
+	}
+	return nil
+}
+
+func (d *Detector) process(frame []byte) {
+	d.detect(frame)
+	if d.utterOpen && !d.inSpeech && d.offset-d.utterEnd >= d.config.EndOfUtterance {
+		d.emitUtterance()
+	}
+}
+
+func (d *Detector) detect(frame []byte) {
+	voiced := rmsDB(frame) >= d.config.ThresholdDB
+	frameStart := d.offset
+	d.offset += frameDuration
+
+	if !d.inSpeech {
+		if voiced {
+			d.inSpeech = true
+			d.start = frameStart
+			d.silenceRun = 0
+			d.audio = append(d.audio[:0], frame...)
+		}
+		return
+	}
+
+	d.audio = append(d.audio, frame...)
+	if voiced {
+		d.silenceRun = 0
+		return
+	}
+	d.silenceRun += frameDuration
+	if d.silenceRun >= d.config.MinSilence {
+		d.emit(d.offset - d.silenceRun)
+	}
+}
+
+func (d *Detector) emit(end time.Duration) {
+	d.inSpeech = false
+	if end-d.start < d.config.MinSpeech {
+		return
+	}
+	trailing := int(d.silenceRun/frameDuration) * d.frameBytes
+	audio := make([]byte, len(d.audio)-trailing)
+	copy(audio, d.audio)
+	d.segments <- Segment{Start: d.start, End: end, Audio: audio, TraceID: d.config.TraceID}
+	if d.utterances != nil {
+		if !d.utterOpen {
+			d.utterOpen = true
+			d.utterStart = d.start
+		}
+		d.utterEnd = end
+	}
+}
+
+func (d *Detector) emitUtterance() {
+	d.utterOpen = false
+	d.utterances <- Utterance{
+		Start:     d.utterStart,
+		End:       d.utterEnd,
+		StartByte: d.byteOffset(d.utterStart),
+		EndByte:   d.byteOffset(d.utterEnd),
+		TraceID:   d.config.TraceID,
+	}
+}
+
+func (d *Detector) byteOffset(t time.Duration) int64 {
+	return int64(t) * int64(d.config.SampleRate) / int64(time.Second) * 2
+}
+
+// rmsDB returns the RMS level of a s16le frame in dBFS
+func rmsDB(frame []byte) float64 {
+	var sum float64
+	n := len(frame) / 2
+	for i := 0; i < n; i++ {
+		s := float64(int16(binary.LittleEndian.Uint16(frame[i*2:]))) / 32768
+		sum += s * s
+	}
+	if n == 0 || sum == 0 {
+		return math.Inf(-1)
+	}
+	return 10 * math.Log10(sum/float64(n))
+}
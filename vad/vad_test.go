@@ -0,0 +1,99 @@
+package vad
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// pcm builds s16le mono samples at 8kHz, amplitude 0 means silence
+func pcm(d time.Duration, amplitude int16) []byte {
+	n := 8000 * int(d) / int(time.Second)
+	buf := make([]byte, n*2)
+	for i := 0; i < n; i++ {
+		v := amplitude
+		if i%2 == 1 {
+			v = -amplitude
+		}
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(v))
+	}
+	return buf
+}
+
+func TestDetectorSegments(t *testing.T) {
+	d := NewDetector(Config{SampleRate: 8000})
+
+	go func() {
+		d.Write(pcm(200*time.Millisecond, 0))
+		d.Write(pcm(500*time.Millisecond, 8000))
+		d.Write(pcm(400*time.Millisecond, 0))
+		// too short to be kept
+		d.Write(pcm(40*time.Millisecond, 8000))
+		d.Write(pcm(400*time.Millisecond, 0))
+		d.Write(pcm(300*time.Millisecond, 8000))
+		d.Close()
+	}()
+
+	var got []Segment
+	for seg := range d.Segments() {
+		got = append(got, seg)
+	}
+
+	want := []Segment{
+		{Start: 200 * time.Millisecond, End: 700 * time.Millisecond},
+		{Start: 1540 * time.Millisecond, End: 1840 * time.Millisecond},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d segments, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].Start != want[i].Start || got[i].End != want[i].End {
+			t.Errorf("segment %d = [%v, %v], want [%v, %v]", i, got[i].Start, got[i].End, want[i].Start, want[i].End)
+		}
+		if size := len(pcm(want[i].End-want[i].Start, 0)); len(got[i].Audio) != size {
+			t.Errorf("segment %d audio = %d bytes, want %d", i, len(got[i].Audio), size)
+		}
+	}
+}
+
+func TestDetectorUtterances(t *testing.T) {
+	d := NewDetector(Config{SampleRate: 8000, EndOfUtterance: 800 * time.Millisecond, TraceID: "call-7"})
+
+	go func() {
+		d.Write(pcm(500*time.Millisecond, 8000))
+		d.Write(pcm(400*time.Millisecond, 0))
+		// same utterance, the pause is shorter than EndOfUtterance
+		d.Write(pcm(300*time.Millisecond, 8000))
+		d.Write(pcm(1000*time.Millisecond, 0))
+		d.Write(pcm(200*time.Millisecond, 8000))
+		d.Close()
+	}()
+	segTrace := make(chan string, 1)
+	go func() {
+		var trace string
+		for seg := range d.Segments() {
+			trace = seg.TraceID
+		}
+		segTrace <- trace
+	}()
+
+	var got []Utterance
+	for u := range d.Utterances() {
+		got = append(got, u)
+	}
+	want := []Utterance{
+		{Start: 0, End: 1200 * time.Millisecond, StartByte: 0, EndByte: 19200, TraceID: "call-7"},
+		{Start: 2200 * time.Millisecond, End: 2400 * time.Millisecond, StartByte: 35200, EndByte: 38400, TraceID: "call-7"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d utterances, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("utterance %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if trace := <-segTrace; trace != "call-7" {
+		t.Errorf("segment TraceID = %q, want call-7", trace)
+	}
+}
@@ -0,0 +1,88 @@
+package audiogo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/QuincyGao/audio-go/file"
+	"github.com/QuincyGao/audio-go/formats"
+	"github.com/QuincyGao/audio-go/utils"
+)
+
+// verifyDuration compares input and output duration after a successful run.
+// File mode probes the files, Stream mode derives both from raw PCM byte counts
+func (ae *AudioEngine) verifyDuration() error {
+	cfg := ae.config.Clone()
+	cfg.SetDefaults()
+	in, out := cfg.GetInputArg(0), cfg.GetOutputArg(0)
+
+	var inDur, outDur time.Duration
+	if fh, ok := ae.processor.(*file.FileHandle); ok {
+		ctx, cancel := ae.probeContext()
+		defer cancel()
+		var err error
+		if inDur, err = fileDuration(ctx, cfg.FFmpeg, cfg.InputFiles[0], in); err != nil {
+			return fmt.Errorf("verify duration: %w", err)
+		}
+		if outDur, err = fileDuration(ctx, cfg.FFmpeg, fh.OutputFiles()[0], out); err != nil {
+			return fmt.Errorf("verify duration: %w", err)
+		}
+	} else {
+		if !formats.IsRawPCM(in.AudioFileFormat) || !formats.IsRawPCM(out.AudioFileFormat) {
+			return nil
+		}
+		st := ae.Stats()
+		inDur = pcmDuration(st.BytesIn, in)
+		outDur = pcmDuration(st.BytesOut, out)
+	}
+	if gap := (outDur - inDur).Abs(); gap > cfg.VerifyDuration {
+		return fmt.Errorf("%w: output %v, input %v", utils.ErrDurationMismatch, outDur, inDur)
+	}
+	return nil
+}
+
+// probeTimeout bounds each ffprobe run after an engine run
+const probeTimeout = 10 * time.Second
+
+// probeContext the run's ctx bounded by probeTimeout, for probing its files
+func (ae *AudioEngine) probeContext() (context.Context, context.CancelFunc) {
+	ctx := ae.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithTimeout(ctx, probeTimeout)
+}
+
+// fileDuration raw PCM from the file size, anything else from ffprobe
+func fileDuration(ctx context.Context, ffmpeg formats.FFmpegOptions, path string, arg formats.AudioArgs) (time.Duration, error) {
+	if !formats.IsRawPCM(arg.AudioFileFormat) {
+		info, err := ProbeWith(ctx, ffmpeg, path)
+		if err != nil {
+			return 0, err
+		}
+		return info.Duration, nil
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return pcmDuration(st.Size(), arg), nil
+}
+
+func pcmDuration(size int64, arg formats.AudioArgs) time.Duration {
+	if arg.SampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(pcmSamples(size, arg)) / float64(arg.SampleRate) * float64(time.Second))
+}
+
+// pcmSamples samples per channel in size bytes of raw PCM, 0 for encoded formats
+func pcmSamples(size int64, arg formats.AudioArgs) int64 {
+	frame := int64(formats.SampleBytes(arg.AudioFileFormat) * arg.Channels)
+	if frame == 0 {
+		return 0
+	}
+	return size / frame
+}
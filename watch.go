@@ -0,0 +1,228 @@
+package audiogo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// WatchOptions settings of a hot folder
+type WatchOptions struct {
+	// OutputDir receives the converted files, required
+	OutputDir string
+	// Ext output extension without dot, defaults to the template output format name
+	Ext string
+	// DoneDir/FailedDir receive the source after a successful or failed
+	// conversion, empty leaves it in place
+	DoneDir   string
+	FailedDir string
+	// Interval between directory scans, default 1s. A file is picked up once
+	// its size and modification time held for a whole interval
+	Interval time.Duration
+	// Match filters new files, nil takes every regular file not starting with a dot
+	Match func(path string) bool
+	// Workers parallel conversions, default 1
+	Workers int
+	// OnSuccess/OnFailure run on the converting goroutine
+	OnSuccess func(WatchEvent)
+	OnFailure func(WatchEvent)
+}
+
+// WatchEvent outcome of one file, Source is where the source ended up
+type WatchEvent struct {
+	Source string
+	Output string
+	Result Result
+	Err    error
+	// TraceID of the template
+	TraceID string
+}
+
+// fileStamp identifies one version of a file between scans
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// Watch polls dir and converts every new file with template in File mode,
+// writing OutputDir/<name>.<Ext> with AtomicOutput so readers of OutputDir
+// never see partial output. Subdirectories are not watched, OutputDir must
+// lie outside dir. Blocks until ctx ends and the running conversions finish,
+// then returns ctx.Err().
+// Polling instead of fsnotify keeps the module free of dependencies, works on
+// network mounts where change events are not delivered, and the size and
+// modification time check a scan does is needed anyway to see a file was
+// completely written
+func Watch(ctx context.Context, dir string, template formats.AudioConfig, opts WatchOptions) error {
+	if opts.OutputDir == "" {
+		return fmt.Errorf("watch: OutputDir is required")
+	}
+	if inside, err := withinDir(dir, opts.OutputDir); err != nil || inside {
+		return fmt.Errorf("watch: OutputDir %s must lie outside %s", opts.OutputDir, dir)
+	}
+	for _, d := range []string{opts.DoneDir, opts.FailedDir} {
+		if same, err := sameDir(dir, d); err != nil || same {
+			return fmt.Errorf("watch: DoneDir and FailedDir must differ from %s", dir)
+		}
+	}
+	if opts.Ext == "" {
+		opts.Ext = string(template.GetOutputArg(0).AudioFileFormat)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Match == nil {
+		opts.Match = func(path string) bool { return !strings.HasPrefix(filepath.Base(path), ".") }
+	}
+	for _, d := range []string{opts.OutputDir, opts.DoneDir, opts.FailedDir} {
+		if d == "" {
+			continue
+		}
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return fmt.Errorf("watch: %w", err)
+		}
+	}
+
+	var (
+		wg sync.WaitGroup
+		// pending files seen growing or new last scan, handled those already dispatched
+		pending = map[string]fileStamp{}
+		handled = map[string]fileStamp{}
+		sem     = make(chan struct{}, max(opts.Workers, 1))
+	)
+	defer wg.Wait()
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("watch %s: %w", dir, err)
+		}
+		seen := make(map[string]bool, len(entries))
+		for _, e := range entries {
+			path := filepath.Join(dir, e.Name())
+			if !e.Type().IsRegular() || !opts.Match(path) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			seen[path] = true
+			stamp := fileStamp{size: info.Size(), modTime: info.ModTime()}
+			if handled[path] == stamp {
+				continue
+			}
+			if pending[path] != stamp {
+				// new or still being written, check again next scan
+				pending[path] = stamp
+				continue
+			}
+			delete(pending, path)
+			handled[path] = stamp
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				watchFile(ctx, path, template, &opts)
+			}()
+		}
+		for path := range handled {
+			if !seen[path] {
+				delete(handled, path)
+			}
+		}
+		for path := range pending {
+			if !seen[path] {
+				delete(pending, path)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func watchFile(ctx context.Context, path string, template formats.AudioConfig, opts *WatchOptions) {
+	base := filepath.Base(path)
+	name := strings.TrimSuffix(base, filepath.Ext(base)) + "." + opts.Ext
+	ev := WatchEvent{Source: path, Output: filepath.Join(opts.OutputDir, name), TraceID: template.TraceID}
+
+	cfg := template.Clone()
+	cfg.InputFiles = []string{path}
+	cfg.OutputFiles = []string{ev.Output}
+	cfg.AtomicOutput = true
+	ev.Result, ev.Err = RunFile(ctx, cfg)
+	if len(ev.Result.OutputFiles) > 0 {
+		ev.Output = ev.Result.OutputFiles[0]
+	}
+
+	moveTo := opts.DoneDir
+	if ev.Err != nil {
+		moveTo = opts.FailedDir
+	}
+	if moveTo != "" {
+		dst := filepath.Join(moveTo, base)
+		if err := os.Rename(path, dst); err != nil && ev.Err == nil {
+			ev.Err = fmt.Errorf("move source: %w", err)
+		} else if err == nil {
+			ev.Source = dst
+		}
+	}
+
+	if ev.Err != nil {
+		if opts.OnFailure != nil {
+			opts.OnFailure(ev)
+		}
+		return
+	}
+	if opts.OnSuccess != nil {
+		opts.OnSuccess(ev)
+	}
+}
+
+// withinDir path is dir or lies below it
+func withinDir(dir, path string) (bool, error) {
+	rel, err := relPath(dir, path)
+	if err != nil {
+		return false, err
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))), nil
+}
+
+// sameDir path is dir, false for an empty path
+func sameDir(dir, path string) (bool, error) {
+	if path == "" {
+		return false, nil
+	}
+	rel, err := relPath(dir, path)
+	return rel == ".", err
+}
+
+func relPath(dir, path string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(absDir, absPath)
+}
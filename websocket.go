@@ -0,0 +1,126 @@
+package audiogo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/QuincyGao/audio-go/formats"
+)
+
+// WebSocket message types and close codes, RFC 6455
+const (
+	wsBinary        = 2
+	wsClose         = 8
+	wsCloseNormal   = 1000
+	wsCloseInternal = 1011
+)
+
+// WSConn the part of a WebSocket connection BridgeWebSocket uses,
+// *websocket.Conn of gorilla/websocket satisfies it
+type WSConn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+}
+
+// WSOptions settings of BridgeWebSocket
+type WSOptions struct {
+	// Output engine output sent back, default 0
+	Output int
+	// FrameSize bytes per binary message sent, default 20ms of raw PCM output
+	// or 4096 bytes of encoded output. Only the last message may be shorter
+	FrameSize int
+}
+
+func (o *WSOptions) setDefaults(out formats.AudioArgs) {
+	if o.FrameSize > 0 {
+		return
+	}
+	o.FrameSize = formats.SampleBytes(out.AudioFileFormat) * out.SampleRate * out.Channels / 50
+	if o.FrameSize <= 0 {
+		o.FrameSize = 4096
+	}
+}
+
+// BridgeWebSocket feeds binary messages of conn into input 0 of a started
+// Stream engine and sends output back as binary messages, until output
+// ends. Text messages are ignored. An empty binary message ends the input,
+// the converted tail is still sent, then a close frame with 1000, or 1011
+// when ffmpeg failed. A close or read error from the peer stops the engine
+// at once since nobody reads the rest. The caller closes conn afterwards
+func (ae *AudioEngine) BridgeWebSocket(conn WSConn, opts WSOptions) error {
+	if !ae.running {
+		return fmt.Errorf("engine not running")
+	}
+	cfg := ae.config.Clone()
+	cfg.SetDefaults()
+	opts.setDefaults(cfg.GetOutputArg(opts.Output))
+
+	peerErr := make(chan error, 1)
+	go func() {
+		feeding := true
+		for {
+			kind, data, err := conn.ReadMessage()
+			if err != nil {
+				ae.processor.Done()
+				peerErr <- err
+				return
+			}
+			if kind != wsBinary || !feeding {
+				continue
+			}
+			if len(data) == 0 {
+				ae.processor.CloseInput()
+				feeding = false
+				continue
+			}
+			if err := ae.write(0, data); err != nil {
+				// ffmpeg is gone, Wait reports why
+				feeding = false
+			}
+		}
+	}()
+
+	out := ae.OutputReader(opts.Output)
+	buf := make([]byte, opts.FrameSize)
+	var sendErr error
+	for sendErr == nil {
+		n, err := io.ReadFull(out, buf)
+		if n > 0 {
+			sendErr = conn.WriteMessage(wsBinary, buf[:n])
+		}
+		if err != nil {
+			break
+		}
+	}
+	if sendErr != nil {
+		ae.processor.Done()
+	}
+	err := ae.Wait()
+
+	select {
+	case perr := <-peerErr:
+		return fmt.Errorf("websocket closed by peer: %w", perr)
+	default:
+	}
+	if sendErr != nil {
+		return fmt.Errorf("websocket send: %w", sendErr)
+	}
+	code, reason := wsCloseNormal, ""
+	if err != nil {
+		code, reason = wsCloseInternal, err.Error()
+	}
+	if cerr := conn.WriteMessage(wsClose, closePayload(code, reason)); cerr != nil && err == nil {
+		err = fmt.Errorf("websocket close: %w", cerr)
+	}
+	return err
+}
+
+// closePayload code and reason of a close frame, the reason is cut to fit 125 bytes
+func closePayload(code int, reason string) []byte {
+	if len(reason) > 123 {
+		reason = strings.ToValidUTF8(reason[:123], "")
+	}
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}